@@ -7,7 +7,9 @@ import (
     "github.com/herval/cloudsearch/pkg/action"
     "github.com/herval/cloudsearch/pkg/config"
     "os"
+    "os/signal"
     "strings"
+    "syscall"
 )
 
 func main() {
@@ -16,17 +18,69 @@ func main() {
     format := flag.String("format", "plain", "Output format for results (plain, json)")
     debug := flag.Bool("debug", false, "Debug logging")
     log := flag.Bool("log", false, "Output logging to a file")
+    page := flag.String("page", "", "Continue a previous search from the given continuation token")
+    apiAddr := flag.String("apiAddr", "127.0.0.1:65433", "Address the search api listens on (see 'cloudsearch serve')")
+    facets := flag.Bool("facets", false, "Count search results by content type, service, account and month")
+    headless := flag.Bool("headless", false, "Log in w/o a browser on this machine (eg over ssh)")
+    out := flag.String("out", "cloudsearch-bundle.tar.zst", "Where to write the bundle to (see 'cloudsearch export')")
+    withResults := flag.Bool("results", false, "Also export the cached results (see 'cloudsearch export')")
+    profile := flag.String("profile", cloudsearch.DefaultProfile, "Profile to use - each one has its own accounts, cache, config and logs (see 'cloudsearch profiles')")
+    allProfiles := flag.Bool("allProfiles", false, "Search every profile at once")
 
     flag.Parse()
 
-    err := cloudsearch.ConfigureLogging(*debug, *log)
+    mode := flag.Arg(0)
+
+    // profiles are managed on the storage path itself, w/o opening any of them
+    if mode == "profiles" {
+        if err := cloudsearch.ConfigureLogging(*debug, *log, *storagePath); err != nil {
+            panic(err)
+        }
+        action.Profiles(*storagePath, flag.Arg(1), flag.Arg(2), *format)
+        return
+    }
+
+    switch mode {
+    case "", "accounts", "login", "serve", "cache", "doctor", "export", "import", "search", "searches":
+    default:
+        // help doesn't need the profile's storage (or the key for it) either
+        flag.Usage()
+        return
+    }
+
+    terms := []string{}
+    if mode == "search" {
+        for _, a := range flag.Args()[1:] {
+            // also allowed after the command (eg cloudsearch search --facets foo)
+            switch a {
+            case "--facets", "-facets":
+                *facets = true
+            case "--allProfiles", "-allProfiles":
+                *allProfiles = true
+            default:
+                terms = append(terms, a)
+            }
+        }
+        if *allProfiles {
+            searchAllProfiles(strings.Join(terms, " "), *storagePath, *oauthPort, *page, *format, *facets, *debug, *log)
+            return
+        }
+    }
+
+    path, err := cloudsearch.ProfilePath(*storagePath, *profile)
+    if err != nil {
+        fmt.Println(err.Error())
+        os.Exit(1)
+    }
+
+    err = cloudsearch.ConfigureLogging(*debug, *log, path)
     if err != nil {
         panic(err)
     }
 
     env := cloudsearch.Env{
         ServerBase:  "http://localhost",
-        StoragePath: *storagePath,
+        StoragePath: path,
         HttpPort:    *oauthPort,
     }
 
@@ -36,33 +90,129 @@ func main() {
         os.Exit(1)
     }
 
-    mode := flag.Arg(0)
+    // cached results are written in the background, so write what's left on the way out
+    defer c.ResultsStorage.Close()
+    interrupted := make(chan os.Signal, 1)
+    signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-interrupted
+        c.ResultsStorage.Close()
+        os.Exit(1)
+    }()
+
     switch mode {
     case "accounts":
         op := flag.Arg(1)
         acc := flag.Arg(2)
-        action.ListOrRemove(c.AccountsStorage, op, acc, *format)
+        args := []string{}
+        if flag.NArg() > 3 {
+            args = flag.Args()[3:]
+        }
+        action.ListOrRemove(c.AccountsStorage, op, acc, args, *format)
     case "login":
-        accType := flag.Arg(1)
-        action.ConfigureNewAccount(
-            accType,
-            c.Env,
-            c.AccountsStorage,
-            c.Registry,
-            c.AuthService,
-        )
-    case "search":
-        searchString := strings.Join(flag.Args()[1:], " ")
-        action.SearchAll(searchString, c.SearchEngine, c.Registry)
-    default:
-        if len(flag.Args()) == 0 {
-            err := action.InteractiveMode(c.SearchEngine)
-            if err != nil {
-                fmt.Println(err.Error())
-                os.Exit(1)
+        accType := ""
+        for _, a := range flag.Args()[1:] {
+            // also allowed after the command (eg cloudsearch login --headless Google)
+            if a == "--headless" || a == "-headless" {
+                *headless = true
+                continue
             }
+            accType = a
+        }
+        if *headless {
+            action.ConfigureNewAccountHeadless(
+                accType,
+                c.Env,
+                c.AccountsStorage,
+                c.Registry,
+                c.AuthService,
+            )
         } else {
-            flag.Usage()
+            action.ConfigureNewAccount(
+                accType,
+                c.Env,
+                c.AccountsStorage,
+                c.Registry,
+                c.AuthService,
+            )
         }
+    case "serve":
+        action.Serve(c.SearchEngine, c.Registry, *apiAddr)
+    case "cache":
+        op := flag.Arg(1)
+        action.Cache(c, op, *format)
+    case "doctor":
+        action.Doctor(c, *format)
+    case "export":
+        args := flag.Args()[1:]
+        for i := 0; i < len(args); i++ {
+            // also allowed after the command (eg cloudsearch export --out bundle.tar.zst --results)
+            switch a := args[i]; {
+            case a == "--results" || a == "-results":
+                *withResults = true
+            case (a == "--out" || a == "-out") && i+1 < len(args):
+                i++
+                *out = args[i]
+            case strings.HasPrefix(a, "--out=") || strings.HasPrefix(a, "-out="):
+                *out = a[strings.Index(a, "=")+1:]
+            }
+        }
+        action.Export(c, *out, *withResults, *format)
+    case "import":
+        action.Import(c, flag.Arg(1), *format)
+    case "search":
+        action.SearchAll(strings.Join(terms, " "), *page, *format, *facets, c.SearchEngine, c.Registry, profileFlags(*profile))
+    case "searches":
+        args := []string{}
+        if flag.NArg() > 3 {
+            args = flag.Args()[3:]
+        }
+        action.Searches(c, flag.Arg(1), flag.Arg(2), args, *page, *format, *facets, profileFlags(*profile))
+    default:
+        err := action.InteractiveMode(c.SearchEngine)
+        if err != nil {
+            fmt.Println(err.Error())
+            os.Exit(1)
+        }
+    }
+}
+
+// search the engines for every profile at once. Logs go to the default profile.
+func searchAllProfiles(cmd string, storagePath string, oauthPort string, page string, format string, facets bool, debug bool, log bool) {
+    err := cloudsearch.ConfigureLogging(debug, log, storagePath)
+    if err != nil {
+        panic(err)
+    }
+
+    env := cloudsearch.Env{
+        ServerBase:  "http://localhost",
+        StoragePath: storagePath,
+        HttpPort:    oauthPort,
+    }
+
+    search, err := action.AllProfiles(env, func(env cloudsearch.Env) (cloudsearch.Config, error) {
+        return config.NewConfig(env, true)
+    })
+    if err != nil {
+        fmt.Println(err.Error())
+        os.Exit(1)
+    }
+
+    interrupted := make(chan os.Signal, 1)
+    signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        <-interrupted
+        search.Close()
+        os.Exit(1)
+    }()
+
+    action.SearchAll(cmd, page, format, facets, search, search.Engines[cloudsearch.DefaultProfile].Registry(), "-allProfiles ")
+}
+
+// the flags picking the profile, repeated on the command to fetch more results
+func profileFlags(profile string) string {
+    if profile == cloudsearch.DefaultProfile {
+        return ""
     }
+    return "-profile " + profile + " "
 }
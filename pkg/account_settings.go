@@ -0,0 +1,134 @@
+package cloudsearch
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// how long searches on an account can take, and how often it's synced, unless its settings say otherwise
+var (
+	DefaultSearchTimeout = 15 * time.Second
+	DefaultSyncInterval  = 10 * time.Minute
+)
+
+// how an account is searched, kept w/ the account
+type AccountSettings struct {
+	Sources      []string      // the account's sources to search (eg "drive" or "gmail"). All of them when empty.
+	ContentTypes []ContentType // searched when a query doesn't ask for any type. All of them when empty.
+	SyncInterval time.Duration // how often the account is synced (tokens are refreshed whenever they're about to expire)
+	Timeout      time.Duration // how long searches on the account can take
+}
+
+func (s AccountSettings) IsEmpty() bool {
+	return len(s.Sources) == 0 && len(s.ContentTypes) == 0 && s.SyncInterval == 0 && s.Timeout == 0
+}
+
+func (s AccountSettings) SearchTimeout() time.Duration {
+	if s.Timeout > 0 {
+		return s.Timeout
+	}
+	return DefaultSearchTimeout
+}
+
+func (s AccountSettings) SyncPeriod() time.Duration {
+	if s.SyncInterval > 0 {
+		return s.SyncInterval
+	}
+	return DefaultSyncInterval
+}
+
+func (s AccountSettings) Includes(source string) bool {
+	return len(s.Sources) == 0 || StringsContain(s.Sources, source)
+}
+
+func (s AccountSettings) JsonFields() map[string]interface{} {
+	return map[string]interface{}{
+		"sources":      s.Sources,
+		"contentTypes": s.ContentTypes,
+		"syncInterval": s.SyncPeriod().String(),
+		"timeout":      s.SearchTimeout().String(),
+	}
+}
+
+// only the sources included, searching the default content types w/in the timeout. Cached results are always
+// searched, even when the account's sources can't be.
+func (s AccountSettings) apply(fns []SearchFunc, ids []string) ([]SearchFunc, []string) {
+	if s.IsEmpty() {
+		return fns, ids
+	}
+
+	resFns := []SearchFunc{}
+	resIds := []string{}
+	for i, fn := range fns {
+		if s.Includes(ids[i]) || ids[i] == CacheSource {
+			resFns = append(resFns, s.wrap(fn))
+			resIds = append(resIds, ids[i])
+		}
+	}
+	return resFns, resIds
+}
+
+func (s AccountSettings) wrap(fn SearchFunc) SearchFunc {
+	return func(query Query, ctx context.Context) <-chan Result {
+		if len(query.ContentTypes) == 0 {
+			query.ContentTypes = s.ContentTypes
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, s.SearchTimeout())
+		out := make(chan Result)
+		go func() {
+			defer cancel()
+			defer close(out)
+
+			// keep draining the search when it times out, so it can wind down
+			for r := range fn(query, ctx) {
+				select {
+				case out <- r:
+				case <-ctx.Done():
+				}
+			}
+		}()
+		return out
+	}
+}
+
+// change a setting by name (sources, types, sync or timeout). Lists are comma-separated, and an empty value
+// goes back to the default.
+func (s *AccountSettings) Set(name string, value string) error {
+	value = strings.TrimSpace(value)
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	switch name {
+	case "sources":
+		s.Sources = list
+	case "types":
+		s.ContentTypes = nil
+		for _, t := range list {
+			s.ContentTypes = append(s.ContentTypes, ContentType(t))
+		}
+	case "sync", "timeout":
+		var d time.Duration
+		if value != "" {
+			var err error
+			if d, err = time.ParseDuration(value); err != nil || d <= 0 {
+				return errors.New("invalid duration for " + name + ": " + value)
+			}
+		}
+		if name == "sync" {
+			s.SyncInterval = d
+		} else {
+			s.Timeout = d
+		}
+	default:
+		return errors.New("unknown setting: " + name)
+	}
+	return nil
+}
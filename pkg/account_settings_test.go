@@ -0,0 +1,84 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+	"github.com/pkg/errors"
+)
+
+func TestAccountSettings(t *testing.T) {
+	s := cloudsearch.AccountSettings{}
+	if s.SearchTimeout() != cloudsearch.DefaultSearchTimeout || s.SyncPeriod() != cloudsearch.DefaultSyncInterval || !s.Includes("gmail") {
+		t.Fatal("Should default to everything ", s)
+	}
+
+	for name, value := range map[string]string{"sources": "drive, gmail", "types": "Email", "sync": "30m", "timeout": "1s"} {
+		if err := s.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(s.Sources) != 2 || !s.Includes("gmail") || s.Includes("dropbox") || s.ContentTypes[0] != cloudsearch.Email ||
+		s.SyncPeriod() != 30*time.Minute || s.SearchTimeout() != time.Second {
+		t.Fatal("Should change the settings ", s)
+	}
+
+	if err := s.Set("sources", ""); err != nil || !s.Includes("dropbox") {
+		t.Fatal("Should go back to the default ", err, s)
+	}
+	if s.Set("timeout", "soon") == nil || s.Set("foo", "bar") == nil {
+		t.Fatal("Should not take invalid settings")
+	}
+}
+
+func TestSearchBuilderSettings(t *testing.T) {
+	types := [][]cloudsearch.ContentType{}
+	searchable := func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+		types = append(types, query.ContentTypes)
+		res := make(chan cloudsearch.Result)
+		go func() {
+			defer close(res)
+			<-ctx.Done()
+		}()
+		return res
+	}
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Google, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{searchable, searchable}, []string{"drive", "gmail"}, nil
+	}, nil)
+
+	acc := cloudsearch.AccountData{AccountType: cloudsearch.Google, Settings: cloudsearch.AccountSettings{
+		Sources:      []string{"gmail"},
+		ContentTypes: []cloudsearch.ContentType{cloudsearch.Email},
+		Timeout:      time.Millisecond,
+	}}
+	fns, ids, err := reg.SearchBuilder(acc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fns) != 1 || ids[0] != "gmail" {
+		t.Fatal("Should only search the sources on the settings ", ids)
+	}
+
+	// unreachable accounts are only searched on the cache
+	reg.RegisterAccountType(cloudsearch.Dropbox, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{searchable}, []string{cloudsearch.CacheSource}, errors.New("unreachable")
+	}, nil)
+	unreachable := acc
+	unreachable.AccountType = cloudsearch.Dropbox
+	if _, ids, _ := reg.SearchBuilder(unreachable); len(ids) != 1 || ids[0] != cloudsearch.CacheSource {
+		t.Fatal("Should always search cached results ", ids)
+	}
+
+	// times out on its own
+	for range fns[0](cloudsearch.Query{}, context.Background()) {
+	}
+	for range fns[0](cloudsearch.Query{ContentTypes: []cloudsearch.ContentType{cloudsearch.File}}, context.Background()) {
+	}
+	if types[0][0] != cloudsearch.Email || types[1][0] != cloudsearch.File {
+		t.Fatal("Should search the default content types when the query doesn't ask for any ", types)
+	}
+}
@@ -3,6 +3,8 @@ package cloudsearch
 import (
 	"fmt"
 	"time"
+
+	"github.com/herval/cloudsearch/pkg/secrets"
 )
 
 type AccountsStorage interface {
@@ -11,6 +13,7 @@ type AccountsStorage interface {
 	Active() ([]AccountData, error)
 	Save(*AccountData) error
 	Delete(accountId string) error
+	Rekey(keys secrets.KeySource) error // protect tokens w/ a key from another source
 }
 
 type AccountData struct {
@@ -26,6 +29,13 @@ type AccountData struct {
 	Active       bool
 	Description  string
 	Url          string
+
+	// why the account isn't active (eg. it couldn't be refreshed or searched)
+	InactiveReason string
+
+	Alias    string // picked by the user to tell accounts apart, and search them w/ account:<alias>
+	Disabled bool   // turned off by the user - unlike inactive accounts, these aren't searched or retried
+	Settings AccountSettings
 }
 
 func (a *AccountData) String() string {
@@ -36,14 +46,23 @@ func (a *AccountData) ShouldReauth() bool {
 	return !a.Expiry.IsZero() && a.Expiry.Before(time.Now().Add(time.Minute*30))
 }
 
+// the alias, when there's one
+func (a *AccountData) DisplayName() string {
+	return Either(a.Alias, a.Description)
+}
+
 func (a *AccountData) JsonFields() map[string]interface{} {
 	return map[string]interface{}{
 		"id":          a.ID,
 		"type":        a.AccountType,
 		"name":        a.Name,
 		"active":      a.Active,
+		"reason":      a.InactiveReason,
 		"email":       a.Email,
 		"description": a.Description,
 		"url":         a.Url,
+		"alias":       a.Alias,
+		"disabled":    a.Disabled,
+		"settings":    a.Settings.JsonFields(),
 	}
 }
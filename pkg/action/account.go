@@ -1,11 +1,15 @@
 package action
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/herval/cloudsearch/pkg"
 	"github.com/herval/cloudsearch/pkg/auth"
-	"github.com/sirupsen/logrus"
+	"github.com/herval/cloudsearch/pkg/secrets"
+	"github.com/pkg/errors"
 	"os"
+	"regexp"
+	"strings"
 )
 
 func ConfigureNewAccount(
@@ -35,7 +39,7 @@ func ConfigureNewAccount(
 	fmt.Println("\nAuthentication done!")
 }
 
-func ListOrRemove(storage cloudsearch.AccountsStorage, op string, accountId string, format string) {
+func ListOrRemove(storage cloudsearch.AccountsStorage, op string, accountId string, args []string, format string) {
 	switch op {
 	case "list":
 		accts, err := storage.All()
@@ -51,15 +55,19 @@ func ListOrRemove(storage cloudsearch.AccountsStorage, op string, accountId stri
 		case "plain":
 			fmt.Println("Configured accounts:")
 			for _, a := range accts {
-				fmt.Println(fmt.Sprintf("%s - %s (%s)", a.ID, a.Description, a.AccountType))
+				status := ""
+				if a.Disabled {
+					status = " - disabled"
+				}
+				fmt.Println(fmt.Sprintf("%s - %s (%s)%s", a.ID, a.DisplayName(), a.AccountType, status))
 			}
 		case "json":
-			//res := []string{}
+			res := []map[string]interface{}{}
 			for _, a := range accts {
-				// TODO format
-				a.JsonFields()
-				fmt.Println(fmt.Sprintf("%s - %s (%s)", a.ID, a.Description, a.AccountType))
+				res = append(res, a.JsonFields())
 			}
+			d, _ := json.Marshal(res)
+			fmt.Println(string(d))
 		}
 	case "remove":
 		err := storage.Delete(accountId)
@@ -70,12 +78,105 @@ func ListOrRemove(storage cloudsearch.AccountsStorage, op string, accountId stri
 
 		fmt.Println("Account removed!")
 		os.Exit(0)
+	case "rekey":
+		// the account arg is where the new key comes from
+		keys, err := secrets.KeySourceNamed(accountId)
+		if err != nil {
+			fmt.Println("Please provide where the new key comes from (env | keyring | passphrase).\nExample usage:\n> cloudsearch accounts rekey passphrase")
+			os.Exit(1)
+		}
+		if err := storage.Rekey(keys); err != nil {
+			fmt.Println("Could not rekey accounts: ", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Account tokens are now protected w/ a key from " + keys.Name())
+	case "disable", "enable":
+		err := updateAccount(storage, accountId, func(a *cloudsearch.AccountData) error {
+			a.Disabled = op == "disable"
+			return nil
+		})
+		if err != nil {
+			fmt.Println("Could not "+op+" account: ", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Account " + op + "d!")
+	case "rename":
+		alias := strings.Join(args, " ")
+		err := updateAccount(storage, accountId, func(a *cloudsearch.AccountData) error {
+			if err := checkAlias(storage, a.ID, alias); err != nil {
+				return err
+			}
+			a.Alias = alias
+			return nil
+		})
+		if err != nil {
+			fmt.Println("Could not rename account: ", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Account renamed!")
+	case "set":
+		if len(args) == 0 {
+			fmt.Println("Please provide a setting (sources | types | sync | timeout).\nExample usage:\n> cloudsearch accounts set 123456 sources drive\n> cloudsearch accounts set 123456 timeout 30s")
+			os.Exit(1)
+		}
+		err := updateAccount(storage, accountId, func(a *cloudsearch.AccountData) error {
+			return a.Settings.Set(args[0], strings.Join(args[1:], " "))
+		})
+		if err != nil {
+			fmt.Println("Could not change the account's settings: ", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Account settings changed!")
 	default:
-		fmt.Println("Please provide a valid operation. (list | remove).\nExample usage:\n> cloudsearch accounts list\n> cloudsearch accounts remove 123456")
+		fmt.Println("Please provide a valid operation. (list | remove | rekey | disable | enable | rename | set).\nExample usage:\n> cloudsearch accounts list\n> cloudsearch accounts remove 123456\n> cloudsearch accounts rekey keyring\n> cloudsearch accounts disable 123456\n> cloudsearch accounts rename 123456 work\n> cloudsearch accounts set 123456 sources gmail")
 		os.Exit(1)
 	}
 }
 
+// change an account by its id or alias, and save it
+func updateAccount(storage cloudsearch.AccountsStorage, accountId string, update func(a *cloudsearch.AccountData) error) error {
+	accts, err := storage.All()
+	if err != nil {
+		return err
+	}
+	for _, a := range accts {
+		if a.ID == accountId || (a.Alias != "" && a.Alias == accountId) {
+			if err := update(&a); err != nil {
+				return err
+			}
+			return storage.Save(&a)
+		}
+	}
+	return errors.New("no account found for " + accountId)
+}
+
+var aliasFormat = regexp.MustCompile(`^[\w-]*$`)
+
+// aliases can be searched w/ account:<alias>, so they can't have spaces or be taken by another account
+func checkAlias(storage cloudsearch.AccountsStorage, accountId string, alias string) error {
+	if !aliasFormat.MatchString(alias) {
+		return errors.New("aliases can only have letters, numbers, _ and -")
+	}
+	if alias == "" {
+		return nil
+	}
+
+	accts, err := storage.All()
+	if err != nil {
+		return err
+	}
+	for _, a := range accts {
+		if a.ID != accountId && (a.ID == alias || a.Alias == alias) {
+			return errors.New("the alias is taken by " + a.ID)
+		}
+	}
+	return nil
+}
+
 func StartOauthServer(
 	env cloudsearch.Env,
 	accounts cloudsearch.AccountsStorage,
@@ -85,15 +186,15 @@ func StartOauthServer(
 	done := make(chan error)
 
 	a := &auth.Api{
-		env,
-		accounts,
-		reg,
-		authService,
+		Env:          env,
+		Accounts:     accounts,
+		Registry:     reg,
+		OauthService: authService,
 	}
 	go func() {
+		// stops once the login is done
 		if err := a.Start(env.HttpPort, done); err != nil {
-			logrus.Fatal("Could not start server", err)
-			done <- err
+			done <- errors.Wrap(err, "could not start the login server")
 		}
 	}()
 
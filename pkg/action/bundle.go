@@ -0,0 +1,64 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/secrets"
+)
+
+// write accounts, favorites, saved searches and (optionally) the cache to a bundle, w/ tokens protected by a passphrase
+func Export(c cloudsearch.Config, out string, withResults bool, format string) {
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		fmt.Println("Could not create the bundle: ", err)
+		os.Exit(1)
+	}
+
+	fmt.Fprintln(os.Stderr, "Account tokens on the bundle are protected w/ a passphrase, which you'll need to import it")
+	stats, err := cloudsearch.Export(f, c.AccountsStorage, c.ResultsStorage, cloudsearch.SavedSearches{StoragePath: c.Env.StoragePath}, secrets.Passphrase{}, withResults)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out)
+		fmt.Println("Could not export: ", err)
+		os.Exit(1)
+	}
+
+	printBundleStats(stats, format, "Exported", out)
+}
+
+// add what's on a bundle to this machine's accounts, cache and saved searches
+func Import(c cloudsearch.Config, in string, format string) {
+	if in == "" {
+		fmt.Println("Please provide a bundle to import.\nExample usage:\n> cloudsearch import bundle.tar.zst")
+		os.Exit(1)
+	}
+	f, err := os.Open(in)
+	if err != nil {
+		fmt.Println("Could not open the bundle: ", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	stats, err := cloudsearch.Import(f, c.AccountsStorage, c.ResultsStorage, cloudsearch.SavedSearches{StoragePath: c.Env.StoragePath}, secrets.Passphrase{})
+	if err != nil {
+		fmt.Println("Could not import: ", err)
+		os.Exit(1)
+	}
+
+	printBundleStats(stats, format, "Imported", in)
+}
+
+func printBundleStats(stats cloudsearch.BundleStats, format string, done string, path string) {
+	switch format {
+	case "json":
+		d, _ := json.Marshal(stats)
+		fmt.Println(string(d))
+	default:
+		fmt.Println(fmt.Sprintf("%s %d accounts, %d favorites, %d saved searches and %d cached results (%s)", done, stats.Accounts, stats.Favorites, stats.Searches, stats.Results, path))
+	}
+}
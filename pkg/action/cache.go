@@ -0,0 +1,155 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"os"
+	"time"
+)
+
+func Cache(c cloudsearch.Config, op string, format string) {
+	switch op {
+	case "purge-excluded":
+		ids, err := PurgeExcluded(c.ResultsStorage, c.Rules)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		switch format {
+		case "json":
+			d, _ := json.Marshal(map[string]interface{}{"purged": ids})
+			fmt.Println(string(d))
+		default:
+			fmt.Println(fmt.Sprintf("Purged %d excluded results from the cache", len(ids)))
+		}
+	case "verify":
+		stats, err := cloudsearch.VerifyStale(context.Background(), c.ResultsStorage, c.AccountsStorage, c.Registry, c.CacheTTL)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		switch format {
+		case "json":
+			d, _ := json.Marshal(stats)
+			fmt.Println(string(d))
+		default:
+			fmt.Println(fmt.Sprintf("Checked %d stale results: %d removed, %d failed", stats.Checked, stats.Removed, stats.Failed))
+		}
+	case "stats":
+		stats, err := cloudsearch.GetCacheStats(c.ResultsStorage)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		switch format {
+		case "json":
+			d, _ := json.Marshal(stats)
+			fmt.Println(string(d))
+		default:
+			printCacheStats(stats)
+		}
+	case "prune":
+		stats, err := cloudsearch.Prune(c.ResultsStorage, c.AccountsStorage, c.Retention, time.Now())
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+
+		switch format {
+		case "json":
+			d, _ := json.Marshal(stats)
+			fmt.Println(string(d))
+		default:
+			fmt.Println(fmt.Sprintf(
+				"Removed %d results (%d expired, %d from removed accounts, %d evicted) - %s to %s",
+				stats.Removed(), stats.Expired, stats.Orphaned, stats.Evicted,
+				formatSize(stats.SizeBefore), formatSize(stats.SizeAfter),
+			))
+		}
+	case "compact":
+		before, err := c.ResultsStorage.Size()
+		if err == nil {
+			err = c.ResultsStorage.Compact()
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		after, _ := c.ResultsStorage.Size()
+
+		switch format {
+		case "json":
+			d, _ := json.Marshal(map[string]interface{}{"sizeBefore": before, "sizeAfter": after})
+			fmt.Println(string(d))
+		default:
+			fmt.Println(fmt.Sprintf("Compacted the cache - %s to %s", formatSize(before), formatSize(after)))
+		}
+	default:
+		fmt.Println("Please provide a valid operation.\nExample usage:\n> cloudsearch cache stats\n> cloudsearch cache prune\n> cloudsearch cache compact\n> cloudsearch cache purge-excluded\n> cloudsearch cache verify")
+		os.Exit(1)
+	}
+}
+
+// remove cached results matching the exclusion rules (eg after new rules were added)
+func PurgeExcluded(results cloudsearch.ResultsStorage, rules cloudsearch.ExclusionRules) ([]string, error) {
+	purged := []string{}
+	if rules.IsEmpty() {
+		return purged, nil
+	}
+
+	all, err := results.All()
+	if err != nil {
+		return purged, errors.Wrap(err, "listing cached results")
+	}
+
+	// don't delete while iterating, as that shifts the pages under the iterator
+	for r := range all {
+		if rules.Excludes(r) {
+			purged = append(purged, r.Id)
+		}
+	}
+
+	for _, id := range purged {
+		logrus.Debug("Purging excluded result: ", id)
+		if err := results.Delete(id); err != nil {
+			return purged, errors.Wrap(err, "purging "+id)
+		}
+	}
+
+	return purged, nil
+}
+
+func printCacheStats(stats cloudsearch.CacheStats) {
+	fmt.Println(fmt.Sprintf("%d results (%d favorited), %s", stats.Results, stats.Favorited, formatSize(stats.SizeBytes)))
+	if !stats.Oldest.IsZero() {
+		fmt.Println(fmt.Sprintf("From %s to %s", stats.Oldest.Format("2006-01-02"), stats.Newest.Format("2006-01-02")))
+	}
+
+	fmt.Println("\nBy type:")
+	for t, n := range stats.ByType {
+		fmt.Println(fmt.Sprintf("  %s: %d", cloudsearch.Either(string(t), "Unknown"), n))
+	}
+	fmt.Println("\nBy account:")
+	for a, n := range stats.ByAccount {
+		fmt.Println(fmt.Sprintf("  %s: %d", cloudsearch.Either(a, "Unknown"), n))
+	}
+}
+
+func formatSize(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(bytes)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", bytes)
+}
@@ -0,0 +1,69 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/herval/cloudsearch/pkg"
+)
+
+// check every account and the cache for problems, exiting w/ an error if there's any
+func Doctor(c cloudsearch.Config, format string) {
+	report, err := cloudsearch.Diagnose(context.Background(), c.AccountsStorage, c.Registry, c.ResultsStorage)
+	if err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	switch format {
+	case "json":
+		d, _ := json.Marshal(map[string]interface{}{
+			"ok":       report.Ok(),
+			"accounts": report.Accounts,
+			"index":    report.Index,
+		})
+		fmt.Println(string(d))
+	default:
+		printReport(report)
+	}
+
+	if !report.Ok() {
+		os.Exit(1)
+	}
+}
+
+func printReport(report cloudsearch.HealthReport) {
+	if len(report.Accounts) == 0 {
+		fmt.Println("No accounts configured")
+	}
+	for _, a := range report.Accounts {
+		fmt.Println(fmt.Sprintf("%s - %s (%s)", cloudsearch.Either(a.Description, a.AccountId), a.AccountType, a.AccountId))
+		printChecks(a.Checks)
+		fmt.Println()
+	}
+
+	fmt.Println("Index")
+	printChecks(report.Index)
+
+	if report.Ok() {
+		fmt.Println("\nEverything looks fine")
+	} else {
+		fmt.Println("\nSome checks failed")
+	}
+}
+
+func printChecks(checks []cloudsearch.Check) {
+	for _, c := range checks {
+		status := "ok"
+		if !c.Ok {
+			status = "FAILED"
+		}
+		line := fmt.Sprintf("  [%s] %s", status, c.Name)
+		if c.Detail != "" {
+			line += ": " + c.Detail
+		}
+		fmt.Println(line)
+	}
+}
@@ -0,0 +1,116 @@
+package action
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/auth"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// log in w/o a browser on this machine (eg over ssh): w/ the device flow when the service takes it, or by
+// pasting the code back from wherever the login was done
+func ConfigureNewAccountHeadless(
+	accType string,
+	env cloudsearch.Env,
+	storage cloudsearch.AccountsStorage,
+	registry *cloudsearch.Registry,
+	authenticator cloudsearch.OAuth2Authenticator,
+) {
+	acc := cloudsearch.AccountType(accType)
+	if !registry.IsAccountTypeSupported(acc) {
+		fmt.Println("Please provide a valid account type.\nExample usage:\n> cloudsearch login --headless Google")
+		os.Exit(1)
+	}
+
+	account, err := headlessLogin(acc, env, authenticator, os.Stdin)
+	if err == nil {
+		err = linkAccount(*account, storage, registry)
+	}
+	if err != nil {
+		fmt.Println("\nAuthentication failed: ", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Println("\nAuthentication done!")
+}
+
+func headlessLogin(
+	acc cloudsearch.AccountType,
+	env cloudsearch.Env,
+	authenticator cloudsearch.OAuth2Authenticator,
+	in io.Reader,
+) (*cloudsearch.AccountData, error) {
+	if d, ok := authenticator.(cloudsearch.DeviceAuthenticator); ok {
+		code, err := d.DeviceCode(acc)
+		if err == nil {
+			fmt.Println("To log in, go to this link on any device:\n\n    " + code.VerificationUrl + "\n\nand enter the code " + code.UserCode)
+			fmt.Println("\nWaiting for access to be granted...")
+			return d.AccountFromDeviceCode(context.Background(), acc, *code)
+		}
+		if err != cloudsearch.ErrNoDeviceFlow {
+			logrus.Debug("Device flow refused, falling back to pasting the code: ", err)
+		}
+	}
+
+	state, err := auth.NewState()
+	if err != nil {
+		return nil, err
+	}
+	redirectUrl := auth.OauthRedirectUrlFor(env, acc)
+	authUrl, err := authenticator.AuthorizeUrl(acc, redirectUrl, state)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println("To log in, open this link on any browser:\n\n    " + authUrl + "\n")
+	fmt.Println("It ends on a page at " + redirectUrl + " that won't load. Paste its address here:")
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	code, err := codeFrom(line, state)
+	if err != nil {
+		return nil, err
+	}
+	return authenticator.AccountFromCode(acc, code, state, redirectUrl)
+}
+
+// the code from a pasted redirect url (checking it's from this login), or the code by itself
+func codeFrom(pasted string, state string) (string, error) {
+	pasted = strings.TrimSpace(pasted)
+	if u, err := url.Parse(pasted); err == nil && u.RawQuery != "" {
+		q := u.Query()
+		if q.Get("state") != state {
+			return "", errors.New("the address isn't from this login")
+		}
+		if e := q.Get("error"); e != "" {
+			return "", errors.New("login failed: " + e)
+		}
+		pasted = q.Get("code")
+	}
+	if pasted == "" {
+		return "", errors.New("no code given")
+	}
+	return pasted, nil
+}
+
+// fill in who the account belongs to and save it
+func linkAccount(acc cloudsearch.AccountData, storage cloudsearch.AccountsStorage, registry *cloudsearch.Registry) error {
+	identity, err := registry.AuthBuilder(acc.AccountType)
+	if err != nil {
+		return err
+	}
+	a, err := identity.FetchIdentityInfo(acc)
+	if err != nil {
+		return err
+	}
+	return storage.Save(a)
+}
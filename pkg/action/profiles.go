@@ -0,0 +1,75 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/herval/cloudsearch/pkg"
+)
+
+// profiles live on the storage path, so this runs before any profile is opened
+func Profiles(storagePath string, op string, name string, format string) {
+	switch op {
+	case "list":
+		profiles, err := cloudsearch.ListProfiles(storagePath)
+		if err != nil {
+			fmt.Println("Could not list profiles: ", err)
+			os.Exit(1)
+		}
+
+		switch format {
+		case "json":
+			d, _ := json.Marshal(profiles)
+			fmt.Println(string(d))
+		default:
+			fmt.Println("Profiles:")
+			for _, p := range profiles {
+				fmt.Println(p)
+			}
+		}
+	case "create":
+		if err := cloudsearch.CreateProfile(storagePath, name); err != nil {
+			fmt.Println("Could not create profile: ", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Profile created! Use 'cloudsearch --profile " + name + " login <provider>' to add accounts to it")
+	case "delete":
+		if err := cloudsearch.DeleteProfile(storagePath, name); err != nil {
+			fmt.Println("Could not delete profile: ", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Profile deleted!")
+	default:
+		fmt.Println("Please provide a valid operation. (list | create | delete).\nExample usage:\n> cloudsearch profiles list\n> cloudsearch profiles create work\n> cloudsearch profiles delete work")
+		os.Exit(1)
+	}
+}
+
+// open every profile, to search all of them at once
+func AllProfiles(env cloudsearch.Env, open func(env cloudsearch.Env) (cloudsearch.Config, error)) (*cloudsearch.ProfilesSearch, error) {
+	profiles, err := cloudsearch.ListProfiles(env.StoragePath)
+	if err != nil {
+		return nil, err
+	}
+
+	search := &cloudsearch.ProfilesSearch{Engines: map[string]*cloudsearch.SearchEngine{}}
+	for _, p := range profiles {
+		path, err := cloudsearch.ProfilePath(env.StoragePath, p)
+		if err != nil {
+			search.Close()
+			return nil, err
+		}
+		e := env
+		e.StoragePath = path
+		c, err := open(e)
+		if err != nil {
+			search.Close()
+			return nil, err
+		}
+		search.Engines[p] = c.SearchEngine
+	}
+	return search, nil
+}
@@ -2,28 +2,101 @@ package action
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"github.com/herval/cloudsearch/pkg"
 	"github.com/herval/cloudsearch/pkg/gocui"
 	"github.com/sirupsen/logrus"
 	"os"
+	"strings"
 )
 
-func SearchAll(cmd string, search *cloudsearch.SearchEngine, r *cloudsearch.Registry) {
+// the flags picking what to search (eg the profile) are repeated on the command to fetch more results
+func SearchAll(cmd string, continuation string, format string, withFacets bool, search cloudsearch.Searcher, r *cloudsearch.Registry, flags string) {
 	query := cloudsearch.ParseQuery(cmd, cloudsearch.NewId(), r)
+	if continuation != "" {
+		pages, err := cloudsearch.ParseContinuation(continuation)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		query.PageTokens = pages
+	}
+
 	res := search.Search(query, context.Background())
 
-	for {
-		select {
-		case q, ok := <-res:
-			if !ok {
-				logrus.Debug("All done!")
-				os.Exit(0)
+	// grouped results get re-sent as they grow, so only print them once the search is done
+	counter := cloudsearch.NewFacetCounter()
+	results, more := cloudsearch.Collect(res, counter)
+	logrus.Debug("All done!")
+
+	printResults(results, format)
+
+	if withFacets {
+		if !query.IsContinuation() { // cached results are all counted on the first page
+			if err := search.CountCached(query, counter); err != nil {
+				logrus.Error("Couldn't count cached results: ", err)
+			}
+		}
+		printFacets(counter.Facets(), format)
+	}
+
+	if more != "" {
+		switch format {
+		case "json":
+			d, _ := json.Marshal(map[string]string{"continuation": more})
+			fmt.Println(string(d))
+		default:
+			fmt.Println("\nMore results available - to fetch them:\n\n    cloudsearch " + flags + "-page " + more + " search " + cmd + "\n")
+		}
+	}
+	search.Close()
+	os.Exit(0)
+}
+
+func printResults(results []cloudsearch.Result, format string) {
+	switch format {
+	case "json":
+		for _, r := range results {
+			d, err := json.Marshal(r)
+			if err != nil {
+				logrus.Error("Couldn't serialize result: ", err)
+				continue
+			}
+			fmt.Println(string(d))
+		}
+	default:
+		for _, r := range results {
+			if len(r.Members) > 0 {
+				fmt.Println(fmt.Sprintf("%s (%d) - %s", r.Title, r.MemberCount(), r.Permalink))
+				for _, m := range r.Members {
+					fmt.Println(fmt.Sprintf("    %s - %s", m.Title, m.Permalink))
+				}
+			} else {
+				fmt.Println(fmt.Sprintf("%s - %s", r.Title, r.Permalink))
 			}
-			logrus.Info("RESULT ->", q.Title)
 		}
 	}
 }
 
+func printFacets(facets cloudsearch.Facets, format string) {
+	switch format {
+	case "json":
+		d, _ := json.Marshal(map[string]cloudsearch.Facets{"facets": facets})
+		fmt.Println(string(d))
+	default:
+		fmt.Println("\nFacets:")
+		for _, name := range cloudsearch.FacetNames {
+			counts := []string{}
+			for _, c := range facets[name] {
+				counts = append(counts, fmt.Sprintf("%s (%d)", c.Value, c.Count))
+			}
+			if len(counts) > 0 {
+				fmt.Println(fmt.Sprintf("    %s: %s", name, strings.Join(counts, ", ")))
+			}
+		}
+	}
+}
 
 func InteractiveMode(engine *cloudsearch.SearchEngine) error {
 	return gocui.StartSearchApp(engine)
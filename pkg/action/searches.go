@@ -0,0 +1,63 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/herval/cloudsearch/pkg"
+)
+
+// save searches by name, to run them again later
+func Searches(c cloudsearch.Config, op string, name string, args []string, page string, format string, withFacets bool, flags string) {
+	searches := cloudsearch.SavedSearches{StoragePath: c.Env.StoragePath}
+
+	switch op {
+	case "list":
+		all, err := searches.All()
+		if err != nil {
+			fmt.Println("Could not list searches: ", err)
+			os.Exit(1)
+		}
+
+		switch format {
+		case "json":
+			d, _ := json.Marshal(all)
+			fmt.Println(string(d))
+		default:
+			fmt.Println("Saved searches:")
+			for _, s := range all {
+				fmt.Println(s.Name + ": " + s.Query)
+			}
+		}
+	case "save":
+		if err := searches.Save(cloudsearch.SavedSearch{Name: name, Query: strings.Join(args, " ")}); err != nil {
+			fmt.Println("Could not save the search: ", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Search saved! Use 'cloudsearch searches run " + name + "' to run it")
+	case "delete":
+		if err := searches.Delete(name); err != nil {
+			fmt.Println("Could not delete the search: ", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Search deleted!")
+	case "run":
+		s, err := searches.Get(name)
+		if err == nil && s == nil {
+			err = fmt.Errorf("no search named %s", name)
+		}
+		if err != nil {
+			fmt.Println("Could not run the search: ", err)
+			os.Exit(1)
+		}
+
+		SearchAll(s.Query, page, format, withFacets, c.SearchEngine, c.Registry, flags)
+	default:
+		fmt.Println("Please provide a valid operation. (list | save | delete | run).\nExample usage:\n> cloudsearch searches list\n> cloudsearch searches save reports type:Document report\n> cloudsearch searches run reports\n> cloudsearch searches delete reports")
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,21 @@
+package action
+
+import (
+	"fmt"
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/api"
+	"os"
+)
+
+func Serve(engine *cloudsearch.SearchEngine, registry *cloudsearch.Registry, addr string) {
+	a := &api.Api{
+		Engine:   engine,
+		Registry: registry,
+	}
+
+	fmt.Println("Serving the search api on http://" + addr)
+	if err := a.Start(addr); err != nil {
+		fmt.Println("Could not start the api: ", err.Error())
+		os.Exit(1)
+	}
+}
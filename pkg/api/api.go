@@ -0,0 +1,109 @@
+package api
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+// a JSON api for searching, for other tools to build on
+type Api struct {
+	Engine   *cloudsearch.SearchEngine
+	Registry *cloudsearch.Registry
+}
+
+type SearchResponse struct {
+	Results      []cloudsearch.Result `json:"results"`
+	Continuation string               `json:"continuation,omitempty"`
+	Facets       cloudsearch.Facets   `json:"facets,omitempty"`
+}
+
+func (a *Api) Start(port string) error {
+	gin.SetMode(gin.ReleaseMode)
+
+	logrus.Info("Api starting on ", port)
+	return a.Router().Run(port)
+}
+
+func (a *Api) Router() *gin.Engine {
+	s := gin.New()
+
+	s.GET("/search", a.search)
+	s.GET("/facets", a.facets)
+
+	return s
+}
+
+// GET /search?q=<query>[&page=<continuation>][&facets=true]
+func (a *Api) search(ctx *gin.Context) {
+	query, err := a.parseQuery(ctx)
+	if err != nil {
+		renderError(ctx, 400, err)
+		return
+	}
+
+	counter := cloudsearch.NewFacetCounter()
+	results, more := cloudsearch.Collect(a.Engine.Search(query, context.Background()), counter)
+
+	res := SearchResponse{
+		Results:      results,
+		Continuation: more,
+	}
+
+	if ctx.Query("facets") == "true" {
+		if !query.IsContinuation() {
+			if err := a.Engine.CountCached(query, counter); err != nil {
+				renderError(ctx, 500, err)
+				return
+			}
+		}
+		res.Facets = counter.Facets()
+	}
+
+	ctx.JSON(200, res)
+}
+
+// GET /facets?q=<query> - counts of cached results only, w/o searching the services
+func (a *Api) facets(ctx *gin.Context) {
+	query, err := a.parseQuery(ctx)
+	if err != nil {
+		renderError(ctx, 400, err)
+		return
+	}
+
+	facets, err := a.Engine.Facets(query)
+	if err != nil {
+		renderError(ctx, 500, err)
+		return
+	}
+
+	ctx.JSON(200, map[string]interface{}{
+		"facets": facets,
+	})
+}
+
+func (a *Api) parseQuery(ctx *gin.Context) (cloudsearch.Query, error) {
+	query := cloudsearch.ParseQuery(ctx.Query("q"), cloudsearch.NewId(), a.Registry)
+
+	if page := ctx.Query("page"); page != "" {
+		pages, err := cloudsearch.ParseContinuation(page)
+		if err != nil {
+			return query, err
+		}
+		query.PageTokens = pages
+	}
+
+	return query, nil
+}
+
+func renderError(context *gin.Context, status int, err error) {
+	logrus.Debug("Rendering error: ", err)
+	context.JSON(
+		status,
+		map[string]interface{}{
+			"error": err.Error(),
+		},
+	)
+}
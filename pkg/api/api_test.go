@@ -0,0 +1,78 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/api"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+func testApi() *api.Api {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "a", AccountType: cloudsearch.Google, Active: true},
+	)
+	results := test.NewResultsStorage(
+		cloudsearch.Result{Id: "cached", AccountId: "a", AccountType: cloudsearch.Google, ContentType: cloudsearch.Document},
+	)
+
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Google, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{
+			func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+				res := make(chan cloudsearch.Result, 2)
+				res <- cloudsearch.Result{OriginalId: "1", Title: "foo 1", AccountId: a.ID, AccountType: a.AccountType, ContentType: cloudsearch.Email, Timestamp: time.Date(2019, 3, 2, 0, 0, 0, 0, time.UTC)}
+				res <- cloudsearch.Result{OriginalId: "2", Title: "foo 2", AccountId: a.ID, AccountType: a.AccountType, ContentType: cloudsearch.Email, Timestamp: time.Date(2019, 3, 5, 0, 0, 0, 0, time.UTC)}
+				close(res)
+				return res
+			},
+		}, []string{"static"}, nil
+	}, nil)
+
+	return &api.Api{
+		Engine:   cloudsearch.NewMultiSearch(cloudsearch.Env{}, accounts, results, reg, reg.FilterPipeline(nil, nil)),
+		Registry: reg,
+	}
+}
+
+func get(t *testing.T, a *api.Api, url string, out interface{}) int {
+	rec := httptest.NewRecorder()
+	a.Router().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatal(err, rec.Body.String())
+	}
+	return rec.Code
+}
+
+func TestSearchWithFacets(t *testing.T) {
+	res := api.SearchResponse{}
+	if code := get(t, testApi(), "/search?q=foo&facets=true", &res); code != 200 {
+		t.Fatal("Unexpected status: ", code)
+	}
+
+	if len(res.Results) != 2 {
+		t.Fatal("Should return the results: ", res.Results)
+	}
+
+	// live results, merged w/ the cached ones
+	if res.Facets.Get(cloudsearch.FacetType, "Email") != 2 || res.Facets.Get(cloudsearch.FacetType, "Document") != 1 {
+		t.Fatal("Should count results by type: ", res.Facets)
+	}
+	if res.Facets.Get(cloudsearch.FacetMonth, "2019-03") != 2 {
+		t.Fatal("Should count results by month: ", res.Facets)
+	}
+	if res.Facets[cloudsearch.FacetService][0].Macro != "service:Google" {
+		t.Fatal("Should include the macro narrowing down to a facet: ", res.Facets)
+	}
+}
+
+func TestInvalidContinuation(t *testing.T) {
+	res := map[string]string{}
+	if code := get(t, testApi(), "/search?q=foo&page=@@@", &res); code != 400 || res["error"] == "" {
+		t.Fatal("Should reject invalid continuations: ", code, res)
+	}
+}
@@ -1,105 +1,216 @@
 package auth
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"github.com/herval/cloudsearch/pkg"
 	"github.com/herval/cloudsearch/pkg/assets"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
+// how long to wait for a login before giving up
+const DefaultLoginTimeout = 10 * time.Minute
+
+// serves OAuth2 callbacks on the loopback interface while an account is being added
 type Api struct {
 	Env          cloudsearch.Env
 	Accounts     cloudsearch.AccountsStorage
 	Registry     *cloudsearch.Registry
 	OauthService cloudsearch.OAuth2Authenticator
+	Timeout      time.Duration // DefaultLoginTimeout when not set
+
+	lock   sync.Mutex
+	states map[string]cloudsearch.AccountType // logins started, by their state
 }
 
+// serve until a login is done (or times out), then shut the server down. How the login went is sent on done.
 func (a *Api) Start(port string, done chan error) error {
 	gin.SetMode(gin.ReleaseMode)
 
+	addr, err := loopback(port)
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	logins := make(chan error, 1)
+	s := &http.Server{Handler: a.Router(logins)}
+	go func() {
+		if err := s.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logins <- err
+		}
+	}()
+	logrus.Info("Server starting on ", addr)
+
+	timeout := a.Timeout
+	if timeout <= 0 {
+		timeout = DefaultLoginTimeout
+	}
+	select {
+	case err = <-logins:
+	case <-time.After(timeout):
+		err = errors.New("timed out waiting for the login")
+	}
+
+	// let the callback page finish rendering
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if serr := s.Shutdown(ctx); serr != nil {
+		logrus.Error("Couldn't shut the server down: ", serr)
+	}
+
+	done <- err
+	return nil
+}
+
+// only ever listen on 127.0.0.1, whatever the host given
+func loopback(port string) (string, error) {
+	_, p, err := net.SplitHostPort(port)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid port")
+	}
+	return net.JoinHostPort("127.0.0.1", p), nil
+}
+
+// the result of each login that gets to the callback is sent on done. Requests that aren't from a login
+// started here are rejected w/o ending it.
+func (a *Api) Router(done chan<- error) *gin.Engine {
 	s := gin.New()
 
 	s.GET("/oauth/start/:service", a.oauthStart)
 	s.GET("/oauth/callback/:service", a.oauthCallback(done))
 
-	logrus.Info("Server starting on ", port)
-	return s.Run(port)
+	return s
 }
 
 func (a *Api) oauthStart(ctx *gin.Context) {
 	service, err := a.Registry.ParseAccountType(ctx.Param("service"))
 	if err != nil {
-		renderError(ctx, err)
+		renderError(ctx, 404, err)
 		return
 	}
 
-	url, err := a.OauthService.AuthorizeUrl(service, OauthRedirectUrlFor(a.Env, service))
+	state, err := NewState()
+	if err != nil {
+		renderError(ctx, 500, err)
+		return
+	}
+	url, err := a.OauthService.AuthorizeUrl(service, OauthRedirectUrlFor(a.Env, service), state)
 	if err != nil {
-		renderError(ctx, err)
+		renderError(ctx, 500, err)
 		return
 	}
 
+	a.lock.Lock()
+	if a.states == nil {
+		a.states = map[string]cloudsearch.AccountType{}
+	}
+	a.states[state] = service
+	a.lock.Unlock()
+
 	ctx.Redirect(302, url)
 }
 
-func (a *Api) oauthCallback(done chan error) func(ctx *gin.Context) {
-	return func(ctx *gin.Context) {
-		var err error
-		defer func() {
-			done <- err
-		}()
+// whether the state is from a login for the service started here. States are only good once.
+func (a *Api) checkState(state string, service cloudsearch.AccountType) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
 
-		service, err := a.Registry.ParseAccountType(ctx.Param("service"))
-		code := ctx.Query("code")
-		logrus.Debug("Oauth callback for ", service, " - ", code)
+	s, ok := a.states[state]
+	if !ok || s != service {
+		return false
+	}
+	delete(a.states, state)
+	return true
+}
 
-		auth, err := a.Registry.AuthBuilder(service)
+func (a *Api) oauthCallback(done chan<- error) func(ctx *gin.Context) {
+	return func(ctx *gin.Context) {
+		service, err := a.Registry.ParseAccountType(ctx.Param("service"))
 		if err != nil {
-			renderError(ctx, err)
+			renderError(ctx, 404, err)
 			return
 		}
-
-		aa := cloudsearch.AccountType(service)
-		acc, err := a.OauthService.AccountFromCode(
-			aa,
-			code,
-			OauthRedirectUrlFor(a.Env, aa),
-		)
-		if err != nil || acc == nil {
-			renderError(ctx, err)
+		state := ctx.Query("state")
+		if state == "" || !a.checkState(state, service) {
+			renderError(ctx, 403, errors.New("this login wasn't started here"))
 			return
 		}
 
-		acc, err = auth.FetchIdentityInfo(*acc)
-		if err != nil {
-			renderError(ctx, err)
-			return
+		err = a.linkAccount(service, ctx.Query("code"), state, ctx.Query("error"))
+		select {
+		case done <- err:
+		default:
+			// another login got there first
 		}
-
-		err = a.Accounts.Save(acc)
 		if err != nil {
-			renderError(ctx, err)
+			renderError(ctx, 406, err)
 			return
 		}
 
-		logrus.Debug("Account saved: ", acc)
-		//	TODO render html?
-
 		data, err := assets.Static("account_linked.html")
 		if err != nil {
 			logrus.Debug("Data missing: ", err)
 			ctx.Status(500)
+			return
 		}
-
 		ctx.Data(200, "text/html", data)
 	}
 }
 
-func renderError(context *gin.Context, err error) {
+func (a *Api) linkAccount(service cloudsearch.AccountType, code string, state string, authError string) error {
+	if authError != "" {
+		return errors.New("login failed: " + authError)
+	}
+	if code == "" {
+		return errors.New("no code given")
+	}
+	logrus.Debug("Oauth callback for ", service)
+
+	auth, err := a.Registry.AuthBuilder(service)
+	if err != nil {
+		return err
+	}
+
+	acc, err := a.OauthService.AccountFromCode(service, code, state, OauthRedirectUrlFor(a.Env, service))
+	if err != nil {
+		return err
+	}
+	if acc == nil {
+		return errors.New("no account for the code")
+	}
+
+	acc, err = auth.FetchIdentityInfo(*acc)
+	if err != nil {
+		return err
+	}
+
+	if err := a.Accounts.Save(acc); err != nil {
+		return err
+	}
+	logrus.Debug("Account saved: ", acc.ID)
+	return nil
+}
+
+// a random state for a login, to check the redirect back is from it
+func NewState() (string, error) {
+	return randomToken()
+}
+
+func renderError(context *gin.Context, status int, err error) {
 	logrus.Debug("Rendering error: ", err)
 	context.JSON(
-		406,
+		status,
 		map[string]interface{}{
 			"error": err.Error(),
 		},
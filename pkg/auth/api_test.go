@@ -0,0 +1,146 @@
+package auth_test
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/auth"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+// hands out accounts for the code "code"
+type fakeAuthenticator struct {
+	cloudsearch.OAuth2Authenticator
+	exchanges int
+}
+
+func (f *fakeAuthenticator) AuthorizeUrl(acc cloudsearch.AccountType, redirectUrl string, state string) (string, error) {
+	return "https://example.com/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (f *fakeAuthenticator) AccountFromCode(acc cloudsearch.AccountType, code string, state string, redirectUrl string) (*cloudsearch.AccountData, error) {
+	f.exchanges++
+	return &cloudsearch.AccountData{AccountType: acc, Token: code}, nil
+}
+
+type fakeIdentity struct {
+	cloudsearch.IdentityService
+}
+
+func (f fakeIdentity) FetchIdentityInfo(a cloudsearch.AccountData) (*cloudsearch.AccountData, error) {
+	a.ExternalId = "1"
+	a.Name = "someone"
+	return &a, nil
+}
+
+func testApi() (*auth.Api, *fakeAuthenticator, *test.AccountsStorage) {
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Google, nil, auth.Builder(fakeIdentity{}))
+	reg.RegisterAccountType(cloudsearch.Dropbox, nil, auth.Builder(fakeIdentity{}))
+	oauth := &fakeAuthenticator{}
+	accounts := test.NewAccountsStorage()
+
+	return &auth.Api{
+		Env:          cloudsearch.Env{ServerBase: "http://localhost", HttpPort: ":65432"},
+		Accounts:     accounts,
+		Registry:     reg,
+		OauthService: oauth,
+	}, oauth, accounts
+}
+
+func request(a *auth.Api, done chan error, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	a.Router(done).ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	return rec
+}
+
+// start a login, returning its state
+func startLogin(t *testing.T, a *auth.Api, done chan error) string {
+	rec := request(a, done, "/oauth/start/Google")
+	if rec.Code != 302 {
+		t.Fatal("Should redirect to the service ", rec.Code)
+	}
+	u, _ := url.Parse(rec.Header().Get("Location"))
+	state := u.Query().Get("state")
+	if state == "" {
+		t.Fatal("Should send a state along ", u)
+	}
+	return state
+}
+
+func TestLogin(t *testing.T) {
+	a, _, accounts := testApi()
+	done := make(chan error, 1)
+
+	state := startLogin(t, a, done)
+	if rec := request(a, done, "/oauth/callback/Google?code=code&state="+state); rec.Code != 200 {
+		t.Fatal("Should link the account ", rec.Code, rec.Body.String())
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if all, _ := accounts.All(); len(all) != 1 || all[0].Token != "code" {
+		t.Fatal("Should save the account ", all)
+	}
+}
+
+func TestCallbackRejections(t *testing.T) {
+	a, oauth, accounts := testApi()
+	done := make(chan error, 1)
+	state := startLogin(t, a, done)
+
+	rejected := map[string]string{
+		"unknown service":   "/oauth/callback/Foo?code=code&state=" + state,
+		"missing state":     "/oauth/callback/Google?code=code",
+		"wrong state":       "/oauth/callback/Google?code=code&state=foo",
+		"another service's": "/oauth/callback/Dropbox?code=code&state=" + state,
+	}
+	for name, path := range rejected {
+		if rec := request(a, done, path); rec.Code < 400 {
+			t.Fatal("Should reject callbacks w/ ", name, ": ", rec.Code)
+		}
+	}
+	if len(done) != 0 || oauth.exchanges != 0 {
+		t.Fatal("Should not end the login or exchange codes on rejected callbacks")
+	}
+
+	// from the login, but w/o a code
+	if rec := request(a, done, "/oauth/callback/Google?state="+state); rec.Code < 400 {
+		t.Fatal("Should reject callbacks w/o a code ", rec.Code)
+	}
+	if err := <-done; err == nil {
+		t.Fatal("Should fail the login w/o a code")
+	}
+	// states are only good once
+	if rec := request(a, done, "/oauth/callback/Google?code=code&state="+state); rec.Code < 400 {
+		t.Fatal("Should not take a state twice ", rec.Code)
+	}
+
+	state = startLogin(t, a, done)
+	if rec := request(a, done, "/oauth/callback/Google?error=access_denied&state="+state); rec.Code < 400 {
+		t.Fatal("Should reject denied logins ", rec.Code)
+	}
+	if err := <-done; err == nil {
+		t.Fatal("Should fail denied logins")
+	}
+
+	if all, _ := accounts.All(); len(all) != 0 || oauth.exchanges != 0 {
+		t.Fatal("Should not link accounts on rejected callbacks ", all)
+	}
+}
+
+func TestLoginTimeout(t *testing.T) {
+	a, _, _ := testApi()
+	a.Timeout = 10 * time.Millisecond
+	done := make(chan error, 1)
+
+	if err := a.Start(":0", done); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err == nil {
+		t.Fatal("Should give up on logins that take too long")
+	}
+}
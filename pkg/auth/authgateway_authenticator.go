@@ -6,6 +6,7 @@ import (
 	"github.com/herval/cloudsearch/pkg"
 	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
+	"net/url"
 )
 
 const DefaultGatewayUrl = "https://cloudsearch-auth.herokuapp.com"
@@ -21,11 +22,24 @@ func NewAuthenticator(client authgateway.AuthClient) cloudsearch.OAuth2Authentic
 	}
 }
 
-func (a *AuthgatewayAuthenticator) AuthorizeUrl(acc cloudsearch.AccountType, redirectUrl string) (string, error) {
-	return a.client.AuthorizeUrl(string(acc), redirectUrl)
+func (a *AuthgatewayAuthenticator) AuthorizeUrl(acc cloudsearch.AccountType, redirectUrl string, state string) (string, error) {
+	authUrl, err := a.client.AuthorizeUrl(string(acc), redirectUrl)
+	if err != nil {
+		return "", err
+	}
+
+	// the gateway always sends the same state (and never checks it), so it's swapped for this login's
+	u, err := url.Parse(authUrl)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid auth url")
+	}
+	q := u.Query()
+	q.Set("state", state)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
 }
 
-func (a *AuthgatewayAuthenticator) AccountFromCode(acc cloudsearch.AccountType, code string, redirectUrl string) (*cloudsearch.AccountData, error) {
+func (a *AuthgatewayAuthenticator) AccountFromCode(acc cloudsearch.AccountType, code string, state string, redirectUrl string) (*cloudsearch.AccountData, error) {
 	tok, err := a.client.TokenFromCode(string(acc), code, redirectUrl)
 	if err != nil {
 		return nil, err
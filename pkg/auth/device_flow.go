@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// the device flow's grant type (RFC 8628)
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// between polls, when the service doesn't say
+const defaultDeviceInterval = 5 * time.Second
+
+type deviceCodeResponse struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationUri string `json:"verification_uri"`
+	VerificationUrl string `json:"verification_url"` // Google's name for it
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+	Error           string `json:"error"`
+}
+
+type deviceTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (a *DirectAuthenticator) DeviceCode(acc cloudsearch.AccountType) (*cloudsearch.DeviceCode, error) {
+	p, ok := a.providers[acc]
+	if !ok || p.DeviceAuthURL == "" {
+		return nil, cloudsearch.ErrNoDeviceFlow
+	}
+
+	res := deviceCodeResponse{}
+	err := a.post(p.DeviceAuthURL, url.Values{
+		"client_id": {p.ClientId},
+		"scope":     {strings.Join(p.Scopes, " ")},
+	}, &res)
+	if err != nil {
+		return nil, errors.Wrap(err, "requesting a device code")
+	}
+	if res.DeviceCode == "" {
+		return nil, errors.New("no device code given: " + res.Error)
+	}
+
+	code := &cloudsearch.DeviceCode{
+		DeviceCode:      res.DeviceCode,
+		UserCode:        res.UserCode,
+		VerificationUrl: res.VerificationUri,
+		Interval:        time.Duration(res.Interval) * time.Second,
+	}
+	if code.VerificationUrl == "" {
+		code.VerificationUrl = res.VerificationUrl
+	}
+	if code.Interval <= 0 {
+		code.Interval = defaultDeviceInterval
+	}
+	if res.ExpiresIn > 0 {
+		code.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+	}
+	return code, nil
+}
+
+func (a *DirectAuthenticator) AccountFromDeviceCode(ctx context.Context, acc cloudsearch.AccountType, code cloudsearch.DeviceCode) (*cloudsearch.AccountData, error) {
+	p, ok := a.providers[acc]
+	if !ok {
+		return nil, cloudsearch.ErrNoDeviceFlow
+	}
+
+	form := url.Values{
+		"grant_type":  {deviceGrantType},
+		"device_code": {code.DeviceCode},
+		"client_id":   {p.ClientId},
+	}
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	interval := code.Interval
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+		if !code.Expiry.IsZero() && time.Now().After(code.Expiry) {
+			return nil, errors.New("the code expired before access was granted")
+		}
+
+		res := deviceTokenResponse{}
+		if err := a.post(p.Endpoint.TokenURL, form, &res); err != nil {
+			return nil, errors.Wrap(err, "polling for the token")
+		}
+
+		switch res.Error {
+		case "":
+			tok := &oauth2.Token{
+				AccessToken:  res.AccessToken,
+				TokenType:    res.TokenType,
+				RefreshToken: res.RefreshToken,
+			}
+			if res.ExpiresIn > 0 {
+				tok.Expiry = time.Now().Add(time.Duration(res.ExpiresIn) * time.Second)
+			}
+			aa := accountFor(acc, cloudsearch.AccountData{}, tok)
+			return &aa, nil
+		case "authorization_pending":
+		case "slow_down":
+			interval += defaultDeviceInterval
+		case "access_denied":
+			return nil, errors.New("access was denied")
+		case "expired_token":
+			return nil, errors.New("the code expired before access was granted")
+		default:
+			return nil, errors.Errorf("%s %s", res.Error, res.ErrorDescription)
+		}
+	}
+}
+
+// post a form, reading a json response (OAuth2 errors come as json too)
+func (a *DirectAuthenticator) post(to string, form url.Values, res interface{}) error {
+	client := a.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	r, err := client.PostForm(to, form)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, res); err != nil {
+		return errors.Errorf("unexpected response (%d): %s", r.StatusCode, body)
+	}
+	return nil
+}
+
+func (a *AccountTypeAuthenticator) DeviceCode(acc cloudsearch.AccountType) (*cloudsearch.DeviceCode, error) {
+	if d, ok := a.authenticator(acc).(cloudsearch.DeviceAuthenticator); ok {
+		return d.DeviceCode(acc)
+	}
+	return nil, cloudsearch.ErrNoDeviceFlow
+}
+
+func (a *AccountTypeAuthenticator) AccountFromDeviceCode(ctx context.Context, acc cloudsearch.AccountType, code cloudsearch.DeviceCode) (*cloudsearch.AccountData, error) {
+	if d, ok := a.authenticator(acc).(cloudsearch.DeviceAuthenticator); ok {
+		return d.AccountFromDeviceCode(ctx, acc, code)
+	}
+	return nil, cloudsearch.ErrNoDeviceFlow
+}
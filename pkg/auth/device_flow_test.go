@@ -0,0 +1,119 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/auth"
+	"golang.org/x/oauth2"
+)
+
+// a fake device authorization server, granting access on the given poll
+type fakeDevice struct {
+	grantOn int
+	deny    bool
+	polls   int
+}
+
+func (f *fakeDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	w.Header().Set("Content-Type", "application/json")
+	if r.Form.Get("client_id") != "client" {
+		w.WriteHeader(401)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	switch r.URL.Path {
+	case "/device":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"device_code":      "device",
+			"user_code":        "ABCD-EFGH",
+			"verification_url": "https://example.com/device",
+			"expires_in":       600,
+			"interval":         5,
+		})
+	case "/token":
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:device_code" || r.Form.Get("device_code") != "device" {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		f.polls++
+		if f.deny {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]string{"error": "access_denied"})
+			return
+		}
+		if f.polls < f.grantOn {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access",
+			"refresh_token": "refresh",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+		})
+	default:
+		w.WriteHeader(404)
+	}
+}
+
+func TestDeviceFlow(t *testing.T) {
+	fake := &fakeDevice{grantOn: 3}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	a := auth.NewDirectAuthenticator(map[cloudsearch.AccountType]auth.Provider{
+		cloudsearch.Google: {
+			ClientId:      "client",
+			Endpoint:      oauth2.Endpoint{TokenURL: server.URL + "/token"},
+			DeviceAuthURL: server.URL + "/device",
+		},
+		cloudsearch.Dropbox: {ClientId: "client"},
+	}, server.Client())
+
+	code, err := a.DeviceCode(cloudsearch.Google)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code.UserCode != "ABCD-EFGH" || code.VerificationUrl != "https://example.com/device" || code.Interval != 5*time.Second || code.Expiry.IsZero() {
+		t.Fatal("Should get a code for the user ", code)
+	}
+
+	code.Interval = time.Millisecond
+	acc, err := a.AccountFromDeviceCode(context.Background(), cloudsearch.Google, *code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.Token != "access" || acc.RefreshToken != "refresh" || acc.AccountType != cloudsearch.Google || fake.polls != 3 {
+		t.Fatal("Should poll until access is granted ", acc, fake.polls)
+	}
+
+	fake.deny = true
+	if _, err := a.AccountFromDeviceCode(context.Background(), cloudsearch.Google, *code); err == nil {
+		t.Fatal("Should stop when access is denied")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	code.Interval = time.Hour
+	if _, err := a.AccountFromDeviceCode(ctx, cloudsearch.Google, *code); err != context.Canceled {
+		t.Fatal("Should stop polling when cancelled ", err)
+	}
+
+	if _, err := a.DeviceCode(cloudsearch.Dropbox); err != cloudsearch.ErrNoDeviceFlow {
+		t.Fatal("Should not do the device flow w/o an url for it ", err)
+	}
+	gateway := &auth.AccountTypeAuthenticator{Default: gatewayAuth{}}
+	if _, err := gateway.DeviceCode(cloudsearch.Google); err != cloudsearch.ErrNoDeviceFlow {
+		t.Fatal("Should not do the device flow through the gateway ", err)
+	}
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"sync"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/secrets"
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+)
+
+// how to talk to a service's OAuth2 endpoints
+type Provider struct {
+	ClientId     string
+	ClientSecret string
+	Endpoint     oauth2.Endpoint
+	Scopes       []string
+	Params       map[string]string // extra params for the authorize url (eg to get refresh tokens)
+
+	DeviceAuthURL string // for logins w/o a browser (see DeviceCode). Empty when it's not supported.
+}
+
+// exchanges tokens w/ each service directly, using PKCE and the client credentials on the config,
+// instead of going through the auth gateway
+type DirectAuthenticator struct {
+	providers map[cloudsearch.AccountType]Provider
+	client    *http.Client
+
+	lock      sync.Mutex
+	verifiers map[string]string // PKCE verifiers for logins in progress, by state
+}
+
+func NewDirectAuthenticator(providers map[cloudsearch.AccountType]Provider, client *http.Client) *DirectAuthenticator {
+	return &DirectAuthenticator{
+		providers: providers,
+		client:    client,
+		verifiers: map[string]string{},
+	}
+}
+
+func (a *DirectAuthenticator) config(acc cloudsearch.AccountType, redirectUrl string) (*oauth2.Config, Provider, error) {
+	p, ok := a.providers[acc]
+	if !ok {
+		return nil, p, errors.New("no OAuth2 client configured for " + string(acc))
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.ClientId,
+		ClientSecret: p.ClientSecret,
+		Endpoint:     p.Endpoint,
+		RedirectURL:  redirectUrl,
+		Scopes:       p.Scopes,
+	}, p, nil
+}
+
+func (a *DirectAuthenticator) context() context.Context {
+	if a.client == nil {
+		return context.Background()
+	}
+	return context.WithValue(context.Background(), oauth2.HTTPClient, a.client)
+}
+
+func (a *DirectAuthenticator) AuthorizeUrl(acc cloudsearch.AccountType, redirectUrl string, state string) (string, error) {
+	conf, p, err := a.config(acc, redirectUrl)
+	if err != nil {
+		return "", err
+	}
+
+	verifier, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	a.lock.Lock()
+	a.verifiers[state] = verifier
+	a.lock.Unlock()
+
+	opts := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", pkceChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	for k, v := range p.Params {
+		opts = append(opts, oauth2.SetAuthURLParam(k, v))
+	}
+	return conf.AuthCodeURL(state, opts...), nil
+}
+
+func (a *DirectAuthenticator) AccountFromCode(acc cloudsearch.AccountType, code string, state string, redirectUrl string) (*cloudsearch.AccountData, error) {
+	conf, _, err := a.config(acc, redirectUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	// the verifier is only good for one exchange
+	a.lock.Lock()
+	verifier, ok := a.verifiers[state]
+	delete(a.verifiers, state)
+	a.lock.Unlock()
+	if !ok {
+		return nil, errors.New("no " + string(acc) + " login in progress for this state")
+	}
+
+	tok, err := conf.Exchange(a.context(), code, oauth2.SetAuthURLParam("code_verifier", verifier))
+	if err != nil {
+		return nil, errors.Wrap(err, "exchanging the code")
+	}
+
+	aa := accountFor(acc, cloudsearch.AccountData{}, tok)
+	return &aa, nil
+}
+
+func (a *DirectAuthenticator) RefreshTokenIfNeeded(account cloudsearch.AccountData, redirectUrl string) (aa cloudsearch.AccountData, accountChanged bool, err error) {
+	if !account.ShouldReauth() {
+		// no need to update if not expired
+		return account, false, nil
+	}
+
+	conf, _, err := a.config(account.AccountType, redirectUrl)
+	if err != nil {
+		return account, false, err
+	}
+	if account.RefreshToken == "" {
+		return account, false, errors.New("the account has no refresh token, it needs to be logged in again")
+	}
+
+	// force a refresh, as tokens are refreshed a while before they expire
+	old := tokenOf(account)
+	old.AccessToken = ""
+	tok, err := conf.TokenSource(a.context(), old).Token()
+	if err != nil {
+		return account, false, errors.Wrap(err, "refreshing the token")
+	}
+	if tok.RefreshToken == "" {
+		// not every service rotates refresh tokens
+		tok.RefreshToken = account.RefreshToken
+	}
+
+	return accountFor(account.AccountType, account, tok), true, nil
+}
+
+func tokenOf(data cloudsearch.AccountData) *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  data.Token,
+		RefreshToken: data.RefreshToken,
+		TokenType:    data.TokenType,
+		Expiry:       data.Expiry,
+	}
+}
+
+func accountFor(accountType cloudsearch.AccountType, acc cloudsearch.AccountData, tok *oauth2.Token) cloudsearch.AccountData {
+	acc.Active = true
+	acc.Token = tok.AccessToken
+	acc.Expiry = tok.Expiry
+	acc.RefreshToken = tok.RefreshToken
+	acc.TokenType = tok.TokenType
+	acc.AccountType = accountType
+
+	return acc
+}
+
+// random enough for PKCE code verifiers (RFC 7636) and states
+func randomToken() (string, error) {
+	b, err := secrets.RandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// picks an authenticator by account type, falling back to a default one
+type AccountTypeAuthenticator struct {
+	Default cloudsearch.OAuth2Authenticator
+	ByType  map[cloudsearch.AccountType]cloudsearch.OAuth2Authenticator
+}
+
+func (a *AccountTypeAuthenticator) authenticator(acc cloudsearch.AccountType) cloudsearch.OAuth2Authenticator {
+	if auth, ok := a.ByType[acc]; ok {
+		return auth
+	}
+	return a.Default
+}
+
+func (a *AccountTypeAuthenticator) AuthorizeUrl(acc cloudsearch.AccountType, redirectUrl string, state string) (string, error) {
+	return a.authenticator(acc).AuthorizeUrl(acc, redirectUrl, state)
+}
+
+func (a *AccountTypeAuthenticator) AccountFromCode(acc cloudsearch.AccountType, code string, state string, redirectUrl string) (*cloudsearch.AccountData, error) {
+	return a.authenticator(acc).AccountFromCode(acc, code, state, redirectUrl)
+}
+
+func (a *AccountTypeAuthenticator) RefreshTokenIfNeeded(account cloudsearch.AccountData, redirectUrl string) (cloudsearch.AccountData, bool, error) {
+	return a.authenticator(account.AccountType).RefreshTokenIfNeeded(account, redirectUrl)
+}
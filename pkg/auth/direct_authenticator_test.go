@@ -0,0 +1,176 @@
+package auth_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/auth"
+	"golang.org/x/oauth2"
+)
+
+// a fake OAuth2 server, checking PKCE on code exchanges
+type fakeOAuth struct {
+	challenges map[string]string // by code
+	refreshes  int
+}
+
+func (f *fakeOAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), 400)
+		return
+	}
+	if id, secret, _ := r.BasicAuth(); id != "client" || secret != "secret" {
+		if r.Form.Get("client_id") != "client" || r.Form.Get("client_secret") != "secret" {
+			http.Error(w, `{"error": "invalid_client"}`, 401)
+			return
+		}
+	}
+
+	res := map[string]interface{}{
+		"token_type": "Bearer",
+		"expires_in": 3600,
+	}
+	switch r.Form.Get("grant_type") {
+	case "authorization_code":
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		challenge, ok := f.challenges[r.Form.Get("code")]
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != challenge {
+			http.Error(w, `{"error": "invalid_grant"}`, 400)
+			return
+		}
+		res["access_token"] = "access"
+		res["refresh_token"] = "refresh"
+	case "refresh_token":
+		if r.Form.Get("refresh_token") != "refresh" {
+			http.Error(w, `{"error": "invalid_grant"}`, 400)
+			return
+		}
+		f.refreshes++
+		res["access_token"] = "refreshed"
+	default:
+		http.Error(w, `{"error": "unsupported_grant_type"}`, 400)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func TestDirectAuthenticator(t *testing.T) {
+	fake := &fakeOAuth{challenges: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	a := auth.NewDirectAuthenticator(map[cloudsearch.AccountType]auth.Provider{
+		cloudsearch.Google: {
+			ClientId:     "client",
+			ClientSecret: "secret",
+			Endpoint:     oauth2.Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token"},
+			Scopes:       []string{"email"},
+			Params:       map[string]string{"access_type": "offline"},
+		},
+	}, server.Client())
+
+	authUrl, err := a.AuthorizeUrl(cloudsearch.Google, "http://127.0.0.1/callback", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authUrl)
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("access_type") != "offline" ||
+		q.Get("client_id") != "client" || q.Get("redirect_uri") != "http://127.0.0.1/callback" || q.Get("state") != "state" {
+		t.Fatal("Should authorize w/ PKCE ", authUrl)
+	}
+	fake.challenges["code"] = q.Get("code_challenge")
+
+	acc, err := a.AccountFromCode(cloudsearch.Google, "code", "state", "http://127.0.0.1/callback")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.Token != "access" || acc.RefreshToken != "refresh" || acc.AccountType != cloudsearch.Google || !acc.Active || acc.Expiry.IsZero() {
+		t.Fatal("Should exchange the code for tokens ", acc)
+	}
+	if _, err := a.AccountFromCode(cloudsearch.Google, "code", "state", "http://127.0.0.1/callback"); err == nil {
+		t.Fatal("Should only exchange a code once per login")
+	}
+	if _, err := a.AuthorizeUrl(cloudsearch.Dropbox, "http://127.0.0.1/callback", "state"); err == nil {
+		t.Fatal("Should fail for services w/o a client")
+	}
+
+	// still valid
+	same, changed, err := a.RefreshTokenIfNeeded(*acc, "")
+	if err != nil || changed || same.Token != "access" || fake.refreshes != 0 {
+		t.Fatal("Should not refresh valid tokens ", err, same)
+	}
+
+	acc.Expiry = time.Now().Add(time.Minute)
+	refreshed, changed, err := a.RefreshTokenIfNeeded(*acc, "")
+	if err != nil || !changed || refreshed.Token != "refreshed" || refreshed.RefreshToken != "refresh" || fake.refreshes != 1 {
+		t.Fatal("Should refresh tokens about to expire ", err, refreshed)
+	}
+}
+
+func TestDirectAuthenticatorConcurrentLogins(t *testing.T) {
+	fake := &fakeOAuth{challenges: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	a := auth.NewDirectAuthenticator(map[cloudsearch.AccountType]auth.Provider{
+		cloudsearch.Google: {
+			ClientId:     "client",
+			ClientSecret: "secret",
+			Endpoint:     oauth2.Endpoint{AuthURL: server.URL + "/authorize", TokenURL: server.URL + "/token"},
+		},
+	}, server.Client())
+
+	// two logins of the same service, the first one finishing last
+	for _, state := range []string{"first", "second"} {
+		authUrl, err := a.AuthorizeUrl(cloudsearch.Google, "http://127.0.0.1/callback", state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, _ := url.Parse(authUrl)
+		fake.challenges["code-"+state] = u.Query().Get("code_challenge")
+	}
+
+	for _, state := range []string{"second", "first"} {
+		if _, err := a.AccountFromCode(cloudsearch.Google, "code-"+state, state, "http://127.0.0.1/callback"); err != nil {
+			t.Fatal("Should exchange the code w/ its own login's verifier ", state, err)
+		}
+	}
+	if _, err := a.AccountFromCode(cloudsearch.Google, "code-first", "unknown", "http://127.0.0.1/callback"); err == nil {
+		t.Fatal("Should fail for logins that weren't started")
+	}
+}
+
+type gatewayAuth struct {
+	cloudsearch.OAuth2Authenticator
+}
+
+func (g gatewayAuth) AuthorizeUrl(acc cloudsearch.AccountType, redirectUrl string, state string) (string, error) {
+	return "gateway", nil
+}
+
+func TestAccountTypeAuthenticator(t *testing.T) {
+	direct := auth.NewDirectAuthenticator(map[cloudsearch.AccountType]auth.Provider{
+		cloudsearch.Dropbox: {ClientId: "client", Endpoint: oauth2.Endpoint{AuthURL: "http://localhost/authorize"}},
+	}, nil)
+	a := &auth.AccountTypeAuthenticator{
+		Default: gatewayAuth{},
+		ByType:  map[cloudsearch.AccountType]cloudsearch.OAuth2Authenticator{cloudsearch.Dropbox: direct},
+	}
+
+	if u, err := a.AuthorizeUrl(cloudsearch.Google, "", "state"); err != nil || u != "gateway" {
+		t.Fatal("Should fall back to the gateway ", err, u)
+	}
+	if u, err := a.AuthorizeUrl(cloudsearch.Dropbox, "", "state"); err != nil || u == "gateway" {
+		t.Fatal("Should go to the service directly ", err, u)
+	}
+}
@@ -1,16 +1,41 @@
 package cloudsearch
 
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
 type IdentityService interface {
 	FetchIdentityInfo(a AccountData) (*AccountData, error)
 	RefreshAccountIfNeeded(a AccountData) (acc AccountData, accountChanged bool, err error)
 }
 
 type OAuth2Authenticator interface {
-	AuthorizeUrl(acc AccountType, redirectUrl string) (string, error)
-	AccountFromCode(acc AccountType, code string, redirectUrl string) (*AccountData, error)
+	// the state is sent back to the redirect url, to tell logins apart
+	AuthorizeUrl(acc AccountType, redirectUrl string, state string) (string, error)
+	AccountFromCode(acc AccountType, code string, state string, redirectUrl string) (*AccountData, error)
 	RefreshTokenIfNeeded(account AccountData, redirectUrl string) (a AccountData, accountChanged bool, err error)
 }
 
+// logins w/o a browser on the same machine, w/ the OAuth2 device authorization flow (RFC 8628)
+type DeviceAuthenticator interface {
+	DeviceCode(acc AccountType) (*DeviceCode, error)
+	// poll until the user grants (or denies) access, the code expires or the context is done
+	AccountFromDeviceCode(ctx context.Context, acc AccountType, code DeviceCode) (*AccountData, error)
+}
+
+var ErrNoDeviceFlow = errors.New("the device flow isn't supported for this account type")
+
+type DeviceCode struct {
+	DeviceCode      string
+	UserCode        string // for the user to type in on the verification url
+	VerificationUrl string
+	Expiry          time.Time
+	Interval        time.Duration // between polls
+}
+
 type PasswordAuthenticator interface {
 	AccountFromCredentials(username string, password string, server string) (*AccountData, error)
 }
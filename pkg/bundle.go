@@ -0,0 +1,306 @@
+package cloudsearch
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg/secrets"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// bumped when what's on a bundle changes in a way older versions can't read
+const BundleVersion = 1
+
+// what's on a bundle: a zstd-compressed tarball w/ these files, in this order
+const (
+	manifestFile  = "manifest.json"
+	accountsFile  = "accounts.json"
+	resultsFile   = "results.ndjson" // only when cached results are exported
+	favoritesFile = "favorites.json"
+	searchesFile  = "searches.json"
+)
+
+type bundleManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+	Results   bool      `json:"results"`
+}
+
+// tokens on a bundle are encrypted w/ a data key of their own, sealed w/ a key from the source given on export
+// (eg a passphrase), so they can be opened on another machine
+type bundleAccounts struct {
+	Envelope *secrets.Envelope `json:"envelope"`
+	Accounts []AccountData     `json:"accounts"`
+}
+
+type BundleStats struct {
+	Accounts  int `json:"accounts"`
+	Favorites int `json:"favorites"`
+	Results   int `json:"results"`
+	Searches  int `json:"searches"`
+}
+
+// write accounts, favorites, saved searches and (optionally) every cached result to a bundle, to move them to
+// another machine
+func Export(w io.Writer, accounts AccountsStorage, results ResultsStorage, searches SavedSearches, keys secrets.KeySource, withResults bool) (BundleStats, error) {
+	stats := BundleStats{}
+
+	accts, err := accounts.All()
+	if err != nil {
+		return stats, errors.Wrap(err, "listing accounts")
+	}
+	env, dataKey, err := secrets.NewEnvelope(keys)
+	if err != nil {
+		return stats, err
+	}
+	c, err := secrets.NewCipher(dataKey)
+	if err != nil {
+		return stats, err
+	}
+	for i := range accts {
+		a := &accts[i]
+		if a.Token, err = c.Encrypt(a.Token); err != nil {
+			return stats, err
+		}
+		if a.RefreshToken, err = c.Encrypt(a.RefreshToken); err != nil {
+			return stats, err
+		}
+	}
+	stats.Accounts = len(accts)
+
+	favs, err := results.AllFavorited()
+	if err != nil {
+		return stats, errors.Wrap(err, "listing favorites")
+	}
+	stats.Favorites = len(favs)
+
+	saved, err := searches.All()
+	if err != nil {
+		return stats, errors.Wrap(err, "listing saved searches")
+	}
+	stats.Searches = len(saved)
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return stats, err
+	}
+	tw := tar.NewWriter(zw)
+
+	err = writeJson(tw, manifestFile, bundleManifest{Version: BundleVersion, CreatedAt: time.Now(), Results: withResults})
+	if err == nil {
+		err = writeJson(tw, accountsFile, bundleAccounts{Envelope: env, Accounts: accts})
+	}
+	if err == nil && withResults {
+		stats.Results, err = writeResults(tw, results)
+	}
+	if err == nil {
+		err = writeJson(tw, favoritesFile, favs)
+	}
+	if err == nil {
+		err = writeJson(tw, searchesFile, saved)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+
+	return stats, err
+}
+
+func writeJson(tw *tar.Writer, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, name)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// the size of each file goes before it on a tarball, so results are written somewhere else first
+func writeResults(tw *tar.Writer, results ResultsStorage) (int, error) {
+	tmp, err := ioutil.TempFile("", "cloudsearch-results")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	all, err := results.All()
+	if err != nil {
+		return 0, errors.Wrap(err, "listing cached results")
+	}
+	n := 0
+	enc := json.NewEncoder(tmp)
+	for r := range all {
+		if err := enc.Encode(r); err != nil {
+			// keep going, so the listing isn't left hanging
+			logrus.Error("Couldn't export ", r.Id, ": ", err)
+			continue
+		}
+		n += 1
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return n, err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: resultsFile, Mode: 0600, Size: size, ModTime: time.Now()}); err != nil {
+		return n, err
+	}
+	_, err = io.Copy(tw, tmp)
+	return n, err
+}
+
+// add what's on a bundle to the accounts and cache. Accounts keep their ids and results are merged, so importing
+// the same bundle again changes nothing.
+func Import(r io.Reader, accounts AccountsStorage, results ResultsStorage, searches SavedSearches, keys secrets.KeySource) (BundleStats, error) {
+	stats := BundleStats{}
+
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return stats, errors.Wrap(err, "not a bundle")
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	manifest := bundleManifest{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, errors.Wrap(err, "reading the bundle")
+		}
+		if h.Name != manifestFile && manifest.Version == 0 {
+			return stats, errors.New("not a bundle: the manifest is missing")
+		}
+
+		switch h.Name {
+		case manifestFile:
+			if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+				return stats, errors.Wrap(err, h.Name)
+			}
+			if manifest.Version > BundleVersion {
+				return stats, errors.Errorf("the bundle is from a newer version (%d)", manifest.Version)
+			}
+		case accountsFile:
+			stats.Accounts, err = importAccounts(tr, accounts, keys)
+		case resultsFile:
+			stats.Results, err = importResults(tr, results)
+		case favoritesFile:
+			stats.Favorites, err = importFavorites(tr, results)
+		case searchesFile:
+			stats.Searches, err = importSearches(tr, searches)
+		default:
+			logrus.Debug("Skipping unknown file on the bundle: ", h.Name)
+		}
+		if err != nil {
+			return stats, errors.Wrap(err, h.Name)
+		}
+	}
+
+	return stats, nil
+}
+
+func importAccounts(r io.Reader, accounts AccountsStorage, keys secrets.KeySource) (int, error) {
+	b := bundleAccounts{}
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return 0, err
+	}
+	if b.Envelope == nil {
+		return 0, errors.New("the key for the tokens is missing")
+	}
+	dataKey, err := b.Envelope.Open(keys)
+	if err != nil {
+		return 0, err
+	}
+	c, err := secrets.NewCipher(dataKey)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, a := range b.Accounts {
+		if a.Token, err = c.Decrypt(a.Token); err != nil {
+			return 0, errors.Wrap(err, "the tokens can't be decrypted")
+		}
+		if a.RefreshToken, err = c.Decrypt(a.RefreshToken); err != nil {
+			return 0, errors.Wrap(err, "the tokens can't be decrypted")
+		}
+		if err := accounts.Save(&a); err != nil {
+			return 0, errors.Wrap(err, "saving "+a.ID)
+		}
+	}
+	return len(b.Accounts), nil
+}
+
+func importResults(r io.Reader, results ResultsStorage) (int, error) {
+	n := 0
+	dec := json.NewDecoder(r)
+	for {
+		res := Result{}
+		err := dec.Decode(&res)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if _, err := results.Merge(res); err != nil {
+			return n, errors.Wrap(err, "merging "+res.Id)
+		}
+		n += 1
+	}
+}
+
+// favorites are merged too, in case the cached results weren't exported
+func importFavorites(r io.Reader, results ResultsStorage) (int, error) {
+	favs := []Result{}
+	if err := json.NewDecoder(r).Decode(&favs); err != nil {
+		return 0, err
+	}
+
+	for _, f := range favs {
+		merged, err := results.Merge(f)
+		if err != nil {
+			return 0, errors.Wrap(err, "merging "+f.Id)
+		}
+		fav, err := results.IsFavorite(merged.Id)
+		if err == nil && !fav {
+			_, err = results.ToggleFavorite(merged.Id)
+		}
+		if err != nil {
+			return 0, errors.Wrap(err, "favoriting "+f.Id)
+		}
+	}
+	return len(favs), nil
+}
+
+// searches w/ the same name are replaced
+func importSearches(r io.Reader, searches SavedSearches) (int, error) {
+	saved := []SavedSearch{}
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return 0, err
+	}
+
+	for _, s := range saved {
+		if err := searches.Save(s); err != nil {
+			return 0, errors.Wrap(err, "saving "+s.Name)
+		}
+	}
+	return len(saved), nil
+}
@@ -0,0 +1,82 @@
+package cloudsearch_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/secrets"
+	"github.com/herval/cloudsearch/pkg/test"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestBundle(t *testing.T) {
+	key, _ := secrets.RandomKey()
+	os.Setenv(secrets.KeyVar, base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv(secrets.KeyVar)
+
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "1", AccountType: cloudsearch.Google, Token: "token", RefreshToken: "refresh", Alias: "work"},
+	)
+	results := test.NewResultsStorage(
+		cloudsearch.Result{Id: "a", Title: "foo", Favorited: true},
+		cloudsearch.Result{Id: "b", Title: "bar", Details: map[string]interface{}{"path": "/bar"}},
+	)
+	searches := cloudsearch.SavedSearches{StoragePath: t.TempDir()}
+	if err := searches.Save(cloudsearch.SavedSearch{Name: "reports", Query: "report type:Document"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := &bytes.Buffer{}
+	stats, err := cloudsearch.Export(bundle, accounts, results, searches, secrets.EnvKey{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Accounts != 1 || stats.Favorites != 1 || stats.Results != 2 || stats.Searches != 1 {
+		t.Fatal("Should export everything ", stats)
+	}
+	zr, err := zstd.NewReader(bytes.NewReader(bundle.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	if data, _ := ioutil.ReadAll(zr); !bytes.Contains(data, []byte("/bar")) || bytes.Contains(data, []byte("refresh")) {
+		t.Fatal("Should not export plaintext tokens")
+	}
+
+	// importing twice changes nothing
+	newAccounts := test.NewAccountsStorage()
+	newResults := test.NewResultsStorage()
+	newSearches := cloudsearch.SavedSearches{StoragePath: t.TempDir()}
+	for i := 0; i < 2; i++ {
+		if _, err := cloudsearch.Import(bytes.NewReader(bundle.Bytes()), newAccounts, newResults, newSearches, secrets.EnvKey{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if all, _ := newAccounts.All(); len(all) != 1 || all[0].Token != "token" || all[0].RefreshToken != "refresh" || all[0].Alias != "work" {
+		t.Fatal("Should import accounts ", all)
+	}
+	if favs, _ := newResults.AllFavoritedIds(); len(favs) != 1 || favs[0] != "a" {
+		t.Fatal("Should import favorites ", favs)
+	}
+	if r, _ := newResults.Get("b"); r == nil || r.Details["path"] != "/bar" {
+		t.Fatal("Should import cached results ", r)
+	}
+	if all, _ := newSearches.All(); len(all) != 1 || all[0].Query != "report type:Document" {
+		t.Fatal("Should import saved searches ", all)
+	}
+
+	// w/ the wrong key
+	wrong, _ := secrets.RandomKey()
+	os.Setenv(secrets.KeyVar, base64.StdEncoding.EncodeToString(wrong))
+	if _, err := cloudsearch.Import(bytes.NewReader(bundle.Bytes()), test.NewAccountsStorage(), test.NewResultsStorage(), newSearches, secrets.EnvKey{}); err == nil {
+		t.Fatal("Should not import tokens w/o the key they were exported w/")
+	}
+	if _, err := cloudsearch.Import(bytes.NewReader([]byte("foo")), test.NewAccountsStorage(), test.NewResultsStorage(), newSearches, secrets.EnvKey{}); err == nil {
+		t.Fatal("Should not import something that isn't a bundle")
+	}
+}
@@ -3,23 +3,32 @@ package cloudsearch
 import (
 	"context"
 	"github.com/sirupsen/logrus"
+	"reflect"
+	"sort"
 	"sync"
+	"time"
 )
 
+// the source searching only cached results, for accounts whose service can't be reached
+const CacheSource = "cache"
+
 func NewCachedSearchable(
 	name string,
 	results ResultsStorage,
 	local SearchFunc,
 	remote SearchFunc,
-	accountType AccountType,
+	account AccountData,
+	policy CachePolicy,
 ) SearchFunc {
+	rules := policy.Rules
+
 	return func(query Query, ctx context.Context) <-chan Result {
 		m := NewStopwatch("cached_and_remote_search_" + name)
 		res := make(chan Result)
 		var wg sync.WaitGroup
 
-		// search on results
-		if query.SearchMode == All || query.SearchMode == Cache {
+		// search on results (cached results aren't paginated, so they're all returned on the first page)
+		if (query.SearchMode == All || query.SearchMode == Cache) && !query.IsContinuation() {
 			logrus.Debug("Searching local " + name)
 			wg.Add(1)
 			go func(res chan Result) {
@@ -27,14 +36,20 @@ func NewCachedSearchable(
 				m := NewStopwatch(n)
 				i := 0
 				rr := local(query, ctx)
+				now := time.Now()
 				for r := range rr {
 					if ctx.Err() != nil {
 						break
 					}
+
+					// the index is shared by all accounts, so only check this account's results
+					if policy.Verify != nil && r.AccountId == account.ID && policy.TTL.IsStale(r, now) {
+						verifyInBackground(results, policy.Verify, r)
+					}
+
 					res <- r
 					i += 1
 				}
-				// TODO go through cachedResult objects and check if they still exist if they're stale
 				wg.Done()
 				m.Lap()
 				logrus.Debug(n, " results: ", i)
@@ -57,6 +72,18 @@ func NewCachedSearchable(
 
 					switch r.Status {
 					case ResultFound:
+						if rules.Excludes(r) {
+							// excluded content never makes it into the cache (it's filtered out of searches later on)
+							logrus.Debug("Not caching excluded result: ", r.Id)
+							break
+						}
+
+						if r.Hydrate != nil {
+							// partial results are streamed right away, and only indexed once fully loaded
+							r = mergeHydrated(results, rules, r)
+							break
+						}
+
 						// save found results on results
 						var err error
 						r, err = results.Merge(r)
@@ -90,3 +117,88 @@ func NewCachedSearchable(
 		return res
 	}
 }
+
+// how many partial results can be loaded and indexed at the same time
+var hydrating = make(chan bool, 8)
+
+// partial results being loaded and indexed in the background
+var hydrations sync.WaitGroup
+
+// how long loading a partial result can take
+const hydrationTimeout = 30 * time.Second
+
+// load the full content of a partial result in the background and index it. Results already in the
+// cache are only loaded again when they changed.
+func mergeHydrated(results ResultsStorage, rules ExclusionRules, r Result) Result {
+	r.SetId()
+	existing, err := results.Get(r.Id)
+	if err != nil {
+		logrus.Error("Couldn't get from cache:", err)
+	}
+	if existing != nil {
+		r.Favorited = existing.Favorited
+		if !metadataChanged(*existing, r) {
+			return r
+		}
+	}
+
+	hydrations.Add(1)
+	go func(r Result) {
+		defer hydrations.Done()
+		hydrating <- true
+		defer func() { <-hydrating }()
+
+		// the search may be long gone by the time this runs
+		ctx, cancel := context.WithTimeout(context.Background(), hydrationTimeout)
+		defer cancel()
+
+		full, err := r.Hydrate(ctx)
+		if err != nil {
+			logrus.Error("Couldn't load result:", err)
+			return
+		}
+
+		// the full content may have more details to match on than the partial one
+		if rules.Excludes(full) {
+			logrus.Debug("Not caching excluded result: ", full.Id)
+			return
+		}
+
+		if _, err := results.Merge(full); err != nil {
+			logrus.Error("Couldn't merge result:", err)
+		}
+	}(r)
+
+	return r
+}
+
+// whether a cached result changed since it was indexed (eg it was read or relabeled)
+func metadataChanged(cached Result, partial Result) bool {
+	return cached.Title != partial.Title ||
+		cached.Unread != partial.Unread ||
+		!cached.Timestamp.Equal(partial.Timestamp.Truncate(time.Second)) ||
+		!reflect.DeepEqual(sortedLabels(cached.Labels), sortedLabels(partial.Labels))
+}
+
+func sortedLabels(labels []string) []string {
+	res := append([]string{}, labels...)
+	sort.Strings(res)
+	return res
+}
+
+// wait for partial results still being loaded to be indexed (eg before closing the results storage), for
+// up to the given time. Returns whether they were all indexed.
+func WaitForHydrations(timeout time.Duration) bool {
+	done := make(chan bool)
+	go func() {
+		hydrations.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,81 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+// a live search returning a single partial result, loaded (slowly) when it's hydrated
+func partialSearch(partial *cloudsearch.Result, loads *int32) cloudsearch.SearchFunc {
+	return func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+		res := make(chan cloudsearch.Result, 1)
+		r := *partial
+		r.Hydrate = func(ctx context.Context) (cloudsearch.Result, error) {
+			time.Sleep(50 * time.Millisecond)
+			atomic.AddInt32(loads, 1)
+			full := r
+			full.Hydrate = nil
+			full.Body = "full body"
+			full.SetId()
+			return full, nil
+		}
+		res <- r
+		close(res)
+		return res
+	}
+}
+
+func TestHydratedBeforeClosing(t *testing.T) {
+	account := cloudsearch.AccountData{ID: "a", AccountType: cloudsearch.Google, Active: true}
+	results := test.NewResultsStorage()
+	partial := &cloudsearch.Result{
+		AccountId:   account.ID,
+		AccountType: account.AccountType,
+		ContentType: cloudsearch.Email,
+		OriginalId:  "m1",
+		Title:       "foo",
+		Unread:      true,
+		Timestamp:   time.Now().Truncate(time.Second),
+	}
+	var loads int32
+
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Google, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{
+			cloudsearch.NewCachedSearchable("gmail", results, nil, partialSearch(partial, &loads), a, cloudsearch.CachePolicy{}),
+		}, []string{"gmail"}, nil
+	}, nil)
+	e := cloudsearch.NewMultiSearch(cloudsearch.Env{}, test.NewAccountsStorage(account), results, reg, func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+		return []cloudsearch.ResultFilter{}
+	})
+
+	search := func() {
+		for range e.Search(cloudsearch.Query{Text: "foo", SearchMode: cloudsearch.Live}, context.Background()) {
+		}
+		e.Close() // the cli exits right after closing
+	}
+
+	search()
+	id := *partial
+	id.SetId()
+	if r, _ := results.Get(id.Id); r == nil || r.Body != "full body" || atomic.LoadInt32(&loads) != 1 {
+		t.Fatal("Should index partial results before closing: ", r, loads)
+	}
+
+	search()
+	if atomic.LoadInt32(&loads) != 1 {
+		t.Fatal("Should not load cached results again: ", loads)
+	}
+
+	// read since it was cached
+	partial.Unread = false
+	search()
+	if r, _ := results.Get(id.Id); r == nil || r.Unread || atomic.LoadInt32(&loads) != 2 {
+		t.Fatal("Should load results that changed again: ", r, loads)
+	}
+}
@@ -7,4 +7,7 @@ type Config struct {
 	ResultsStorage  ResultsStorage
 	AuthService     OAuth2Authenticator
 	Registry        *Registry
+	Rules           ExclusionRules
+	CacheTTL        CacheTTL
+	Retention       RetentionPolicy
 }
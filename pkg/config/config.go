@@ -10,42 +10,87 @@ import (
 	"github.com/herval/cloudsearch/pkg/search"
 	"github.com/herval/cloudsearch/pkg/search/dropbox"
 	"github.com/herval/cloudsearch/pkg/search/google"
+	"github.com/herval/cloudsearch/pkg/secrets"
 	"github.com/herval/cloudsearch/pkg/storage/bleve"
 	"github.com/herval/cloudsearch/pkg/storage/storm"
+	"github.com/pkg/errors"
 )
 
 func NewConfig(env cloudsearch.Env, enableCaching bool) (cloudsearch.Config, error) {
-	accounts, err := storm.NewAccountsStorage(env.StoragePath)
+	// tokens are encrypted w/ a key from the keyring, a passphrase or the env (see secrets.DefaultKeySource)
+	accounts, err := storm.NewAccountsStorage(env.StoragePath, secrets.DefaultKeySource)
 	if err != nil {
 		return cloudsearch.Config{}, err
 	}
 
-	index, err := bleve.NewIndex(env.StoragePath, "")
+	// results are encrypted on the index w/ the same key as tokens, so the index is only opened (and the key
+	// asked for) once a command uses it
+	results := bleve.NewLazyStorage(func() (*bleve.WriteBehindStorage, error) {
+		cipher, err := accounts.Cipher()
+		if err != nil {
+			return nil, err
+		}
+		// indexes from older schemas are migrated in the background
+		storage, err := bleve.OpenResultStorage(env.StoragePath, cipher)
+		if err != nil {
+			return nil, err
+		}
+		// live results are written in batches, so they can be streamed w/o waiting on the index
+		return bleve.NewWriteBehindStorage(storage, bleve.DefaultBatchSize, bleve.DefaultFlushInterval)
+	})
+
+	file, err := LoadFile(env.StoragePath)
 	if err != nil {
 		return cloudsearch.Config{}, err
 	}
-	results := bleve.NewBleveResultStorage(index)
-
-	authService := auth.NewAuthenticator(
-		authgateway.NewAuthGatewayClient(
-			auth.DefaultGatewayUrl,
-			env.HttpPort,
-			&http.Client{
-				Timeout: time.Second * 10,
-			},
+
+	authService, err := authenticator(
+		file.Auth,
+		auth.NewAuthenticator(
+			authgateway.NewAuthGatewayClient(
+				auth.DefaultGatewayUrl,
+				env.HttpPort,
+				&http.Client{
+					Timeout: time.Second * 10,
+				},
+			),
 		),
 	)
+	if err != nil {
+		return cloudsearch.Config{}, err
+	}
+
+	rules, err := LoadRules(env.StoragePath)
+	if err != nil {
+		return cloudsearch.Config{}, err
+	}
+
+	ttl, err := file.Cache.CacheTTL()
+	if err != nil {
+		return cloudsearch.Config{}, err
+	}
+	retention, err := file.Cache.RetentionPolicy()
+	if err != nil {
+		return cloudsearch.Config{}, err
+	}
+
+	policy := cloudsearch.CachePolicy{
+		Rules: rules,
+		TTL:   ttl,
+	}
 
 	registry := cloudsearch.NewRegistry()
 	registry.RegisterAccountType(cloudsearch.Dropbox,
-		search.WithCaching(search.Builder("dropbox", dropbox.NewSearch), enableCaching, results),
-		auth.Builder(dropbox.NewAuthenticator()),
+		search.WithCaching(search.Builder("dropbox", dropbox.NewSearch), enableCaching, results, policy, dropbox.NewVerifier),
+		auth.Builder(dropbox.NewAuthenticator(authService, accounts, auth.OauthRedirectUrlFor(env, cloudsearch.Dropbox))),
 	)
+	registry.RegisterVerifier(cloudsearch.Dropbox, dropbox.NewVerifier)
 	registry.RegisterAccountType(
 		cloudsearch.Google,
-		search.WithCaching(google.SearchBuilder, enableCaching, results),
+		search.WithCaching(google.SearchBuilder, enableCaching, results, policy, google.NewVerifier),
 		google.AuthBuilder(authService, accounts, auth.OauthRedirectUrlFor(env, cloudsearch.Google)),
 	)
+	registry.RegisterVerifier(cloudsearch.Google, google.NewVerifier)
 	registry.RegisterContentTypes(
 		cloudsearch.Document,
 		cloudsearch.Email,
@@ -55,19 +100,31 @@ func NewConfig(env cloudsearch.Env, enableCaching bool) (cloudsearch.Config, err
 		cloudsearch.Video,
 	)
 
+	// excluded labels and paths match like exclusion rules, but can be disabled
+	excludedLabels := cloudsearch.ExclusionRules{Labels: file.Filters.ExcludedLabels}
+	excludedPaths := cloudsearch.ExclusionRules{Paths: file.Filters.ExcludedPaths}
+	excludedPaths.Compile()
+
+	registry.RegisterDefaultFilters()
+	registry.RegisterFilter("labels", cloudsearch.FilterOrderExclude, true,
+		cloudsearch.Stateless(excludedLabels.Filter),
+	)
+	registry.RegisterFilter("paths", cloudsearch.FilterOrderExclude, true,
+		cloudsearch.Stateless(excludedPaths.Filter),
+	)
+	registry.RegisterRequiredFilter("exclusions", cloudsearch.FilterOrderExclude,
+		cloudsearch.Stateless(rules.Filter),
+	)
+	registry.RegisterFilter("redact", cloudsearch.FilterOrderRewrite, false,
+		cloudsearch.Stateless(cloudsearch.Redact),
+	)
+
 	multiSearch := cloudsearch.NewMultiSearch(
 		env,
 		accounts,
 		results,
 		registry,
-		func(q cloudsearch.Query) []cloudsearch.ResultFilter {
-			return []cloudsearch.ResultFilter{
-				cloudsearch.SetId, // no better place to set this ugh
-				cloudsearch.FilterNotInRange,
-				cloudsearch.Dedup(q),
-				cloudsearch.FilterContent,
-			}
-		},
+		registry.FilterPipeline(file.Filters.Enabled, file.Filters.Disabled),
 	)
 
 	// TODO move this side effect somewhere else
@@ -76,9 +133,43 @@ func NewConfig(env cloudsearch.Env, enableCaching bool) (cloudsearch.Config, err
 	return cloudsearch.Config{
 		Env:             env,
 		AccountsStorage: accounts,
-		SearchEngine:    &multiSearch,
+		SearchEngine:    multiSearch,
 		Registry:        registry,
 		ResultsStorage:  results,
 		AuthService:     authService,
+		Rules:           rules,
+		CacheTTL:        ttl,
+		Retention:       retention,
+	}, nil
+}
+
+// services w/ client credentials on the config get tokens from their own endpoints, the others through the gateway
+func authenticator(clients map[string]OAuthClient, gateway cloudsearch.OAuth2Authenticator) (cloudsearch.OAuth2Authenticator, error) {
+	providers := map[cloudsearch.AccountType]auth.Provider{}
+	for name, c := range clients {
+		if c.ClientId == "" {
+			return nil, errors.New("missing clientId on the auth config for " + name)
+		}
+		switch cloudsearch.AccountType(name) {
+		case cloudsearch.Google:
+			providers[cloudsearch.Google] = google.OAuthProvider(c.ClientId, c.ClientSecret)
+		case cloudsearch.Dropbox:
+			providers[cloudsearch.Dropbox] = dropbox.OAuthProvider(c.ClientId, c.ClientSecret)
+		default:
+			return nil, errors.New("unknown account type on the auth config: " + name)
+		}
+	}
+
+	direct := auth.NewDirectAuthenticator(providers, &http.Client{
+		Timeout: time.Second * 10,
+	})
+	byType := map[cloudsearch.AccountType]cloudsearch.OAuth2Authenticator{}
+	for t := range providers {
+		byType[t] = direct
+	}
+
+	return &auth.AccountTypeAuthenticator{
+		Default: gateway,
+		ByType:  byType,
 	}, nil
 }
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/pkg/errors"
+)
+
+const FileName = "config.json"
+
+// user settings, read from config.json on the storage path. Everything on it is optional.
+type File struct {
+	Filters Filters                `json:"filters"`
+	Cache   Cache                  `json:"cache"`
+	Auth    map[string]OAuthClient `json:"auth"` // by account type (eg "Google")
+}
+
+// credentials for talking to a service's OAuth2 endpoints directly, instead of through the auth gateway
+type OAuthClient struct {
+	ClientId     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret"` // optional for services that take PKCE alone
+}
+
+type Filters struct {
+	Enabled        []string `json:"enabled"`        // filters to run on every search, on top of the default ones
+	Disabled       []string `json:"disabled"`       // default filters that shouldn't run
+	ExcludedLabels []string `json:"excludedLabels"` // defaults to DefaultExcludedLabels when not set
+	ExcludedPaths  []string `json:"excludedPaths"`
+}
+
+type Cache struct {
+	TTL       map[string]string `json:"ttl"`       // how long cached results are trusted, by content type or "default" (eg {"Email": "720h"})
+	Retention []Retention       `json:"retention"` // how long results are kept, by account and/or content type
+	MaxSize   string            `json:"maxSize"`   // eg "500MB"
+}
+
+type Retention struct {
+	Account string `json:"account"`
+	Type    string `json:"type"`
+	MaxAge  string `json:"maxAge"` // eg "365d". Empty keeps results forever.
+}
+
+func (c Cache) CacheTTL() (cloudsearch.CacheTTL, error) {
+	ttl := cloudsearch.CacheTTL{
+		Default: cloudsearch.DefaultCacheTTL,
+		ByType:  map[cloudsearch.ContentType]time.Duration{},
+	}
+
+	for k, v := range c.TTL {
+		d, err := parseDuration(v)
+		if err != nil || d <= 0 {
+			return ttl, errors.New("invalid cache ttl for " + k + ": " + v)
+		}
+		if k == "default" {
+			ttl.Default = d
+		} else {
+			ttl.ByType[cloudsearch.ContentType(k)] = d
+		}
+	}
+
+	return ttl, nil
+}
+
+func (c Cache) RetentionPolicy() (cloudsearch.RetentionPolicy, error) {
+	p := cloudsearch.RetentionPolicy{}
+
+	for _, r := range c.Retention {
+		rule := cloudsearch.RetentionRule{
+			AccountId:   r.Account,
+			ContentType: cloudsearch.ContentType(r.Type),
+		}
+		if r.MaxAge != "" {
+			d, err := parseDuration(r.MaxAge)
+			if err != nil || d <= 0 {
+				return p, errors.New("invalid retention max age: " + r.MaxAge)
+			}
+			rule.MaxAge = d
+		}
+		p.Rules = append(p.Rules, rule)
+	}
+
+	if c.MaxSize != "" {
+		s, err := cloudsearch.ParseSize(c.MaxSize)
+		if err != nil || s <= 0 {
+			return p, errors.New("invalid cache max size: " + c.MaxSize)
+		}
+		p.MaxSize = s
+	}
+
+	return p, nil
+}
+
+// like time.ParseDuration, but also takes days (eg "30d")
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+var DefaultExcludedLabels = []string{"SPAM", "TRASH"}
+
+func LoadFile(storagePath string) (File, error) {
+	f := File{}
+
+	data, err := ioutil.ReadFile(cloudsearch.FileAt(storagePath, FileName))
+	if os.IsNotExist(err) {
+		return f.withDefaults(), nil
+	}
+	if err != nil {
+		return f, err
+	}
+
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, errors.Wrap(err, "invalid "+FileName)
+	}
+
+	return f.withDefaults(), nil
+}
+
+func (f File) withDefaults() File {
+	if f.Filters.ExcludedLabels == nil {
+		f.Filters.ExcludedLabels = DefaultExcludedLabels
+	}
+	return f
+}
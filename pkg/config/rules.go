@@ -0,0 +1,32 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/pkg/errors"
+)
+
+const RulesFileName = "rules.json"
+
+// exclusion rules, read from rules.json on the storage path. Content matching them is never shown nor cached.
+func LoadRules(storagePath string) (cloudsearch.ExclusionRules, error) {
+	r := cloudsearch.ExclusionRules{}
+
+	data, err := ioutil.ReadFile(cloudsearch.FileAt(storagePath, RulesFileName))
+	if os.IsNotExist(err) {
+		return r, nil
+	}
+	if err != nil {
+		return r, err
+	}
+
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, errors.Wrap(err, "invalid "+RulesFileName)
+	}
+
+	r.Compile()
+	return r, nil
+}
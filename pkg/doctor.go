@@ -0,0 +1,234 @@
+package cloudsearch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// how long each probe search can take
+var ProbeTimeout = 30 * time.Second
+
+type Check struct {
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func passed(name string, detail string) Check {
+	return Check{Name: name, Ok: true, Detail: detail}
+}
+
+func failed(name string, err error) Check {
+	return Check{Name: name, Detail: err.Error()}
+}
+
+type AccountHealth struct {
+	AccountId   string      `json:"accountId"`
+	AccountType AccountType `json:"accountType"`
+	Description string      `json:"description"`
+	Checks      []Check     `json:"checks"`
+}
+
+type HealthReport struct {
+	Accounts []AccountHealth `json:"accounts"`
+	Index    []Check         `json:"index"`
+}
+
+func (h HealthReport) Ok() bool {
+	for _, a := range h.Accounts {
+		if !allOk(a.Checks) {
+			return false
+		}
+	}
+	return allOk(h.Index)
+}
+
+func allOk(checks []Check) bool {
+	for _, c := range checks {
+		if !c.Ok {
+			return false
+		}
+	}
+	return true
+}
+
+// identity services that can tell which of the scopes needed weren't granted to an account
+type ScopeChecker interface {
+	MissingScopes(a AccountData) ([]string, error)
+}
+
+type IndexStats struct {
+	Docs          uint64 `json:"docs"`
+	Unreadable    int    `json:"unreadable"` // results that couldn't be read back
+	SchemaVersion int    `json:"schemaVersion"`
+	UpToDate      bool   `json:"upToDate"` // on the current schema, or being migrated to it
+}
+
+// results storages that can check themselves for problems
+type CheckableStorage interface {
+	Check() (IndexStats, error)
+}
+
+// check every account can still be refreshed and searched, and the cache can still be read
+func Diagnose(ctx context.Context, accounts AccountsStorage, registry *Registry, results ResultsStorage) (HealthReport, error) {
+	report := HealthReport{Accounts: []AccountHealth{}}
+
+	all, err := accounts.All()
+	if err != nil {
+		return report, errors.Wrap(err, "listing accounts")
+	}
+	for _, a := range all {
+		report.Accounts = append(report.Accounts, diagnoseAccount(ctx, a, registry))
+	}
+
+	report.Index = diagnoseIndex(results)
+	return report, nil
+}
+
+func diagnoseAccount(ctx context.Context, a AccountData, registry *Registry) AccountHealth {
+	h := AccountHealth{AccountId: a.ID, AccountType: a.AccountType, Description: a.DisplayName()}
+
+	// turned off on purpose, so there's nothing to check
+	if a.Disabled {
+		h.Checks = append(h.Checks, passed("active", "disabled"))
+		return h
+	}
+	if a.Active {
+		h.Checks = append(h.Checks, passed("active", ""))
+	} else {
+		h.Checks = append(h.Checks, Check{Name: "active", Detail: Either(a.InactiveReason, "inactive")})
+	}
+
+	identity, err := registry.AuthBuilder(a.AccountType)
+	if err != nil {
+		h.Checks = append(h.Checks, failed("auth", err))
+	} else {
+		var token Check
+		a, token = checkToken(a, identity)
+		h.Checks = append(h.Checks, token, checkIdentity(a, identity))
+		if s, ok := identity.(ScopeChecker); ok {
+			h.Checks = append(h.Checks, checkScopes(a, s))
+		}
+	}
+
+	return h.withProbes(ctx, a, registry)
+}
+
+// refresh the token if it's about to expire, same as before searching
+func checkToken(a AccountData, identity IdentityService) (AccountData, Check) {
+	refreshed, changed, err := identity.RefreshAccountIfNeeded(a)
+	if err != nil {
+		return a, failed("token", errors.Wrap(err, "couldn't refresh"))
+	}
+	if refreshed.Expiry.IsZero() {
+		return refreshed, passed("token", "doesn't expire")
+	}
+	if refreshed.Expiry.Before(time.Now()) {
+		return refreshed, Check{Name: "token", Detail: "expired at " + refreshed.Expiry.Format(time.RFC3339)}
+	}
+
+	detail := "valid until " + refreshed.Expiry.Format(time.RFC3339)
+	if changed {
+		detail = "refreshed, " + detail
+	}
+	return refreshed, passed("token", detail)
+}
+
+func checkIdentity(a AccountData, identity IdentityService) Check {
+	acc, err := identity.FetchIdentityInfo(a)
+	if err != nil {
+		return failed("identity", err)
+	}
+	if acc.ExternalId != "" && a.ExternalId != "" && acc.ExternalId != a.ExternalId {
+		return Check{Name: "identity", Detail: "the token belongs to another account: " + acc.Description}
+	}
+	return passed("identity", acc.Description)
+}
+
+func checkScopes(a AccountData, s ScopeChecker) Check {
+	missing, err := s.MissingScopes(a)
+	if err != nil {
+		return failed("scopes", err)
+	}
+	if len(missing) > 0 {
+		return Check{Name: "scopes", Detail: "missing " + strings.Join(missing, ", ")}
+	}
+	return passed("scopes", "")
+}
+
+// search each of the account's sources for a single result
+func (h AccountHealth) withProbes(ctx context.Context, a AccountData, registry *Registry) AccountHealth {
+	fns, ids, err := registry.SearchBuilder(a)
+	if err != nil {
+		h.Checks = append(h.Checks, failed("search", err))
+		return h
+	}
+
+	for i, fn := range fns {
+		h.Checks = append(h.Checks, probe(ctx, "search:"+ids[i], fn))
+	}
+	return h
+}
+
+func probe(ctx context.Context, name string, fn SearchFunc) Check {
+	lock := sync.Mutex{}
+	errs := []string{}
+	ctx, cancel := context.WithTimeout(WithErrorReporter(ctx, func(source string, err error) {
+		lock.Lock()
+		defer lock.Unlock()
+		errs = append(errs, err.Error())
+	}), ProbeTimeout)
+	defer cancel()
+
+	found := 0
+	res := fn(Query{RawText: "a", Text: "a", SearchMode: Live, MaxResults: 1}, ctx)
+	for done := false; !done; {
+		select {
+		case r, ok := <-res:
+			if !ok {
+				done = true
+			} else if r.Status != ResultMoreAvailable {
+				found++
+			}
+		case <-ctx.Done():
+			return Check{Name: name, Detail: "timed out"}
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(errs) > 0 {
+		return Check{Name: name, Detail: strings.Join(errs, "; ")}
+	}
+	return passed(name, fmt.Sprintf("%d result(s)", found))
+}
+
+func diagnoseIndex(results ResultsStorage) []Check {
+	c, ok := results.(CheckableStorage)
+	if !ok {
+		return []Check{}
+	}
+
+	stats, err := c.Check()
+	if err != nil {
+		return []Check{failed("index", err)}
+	}
+
+	checks := []Check{passed("documents", fmt.Sprintf("%d", stats.Docs))}
+	if stats.Unreadable > 0 {
+		checks = append(checks, Check{Name: "integrity", Detail: fmt.Sprintf("%d result(s) can't be read", stats.Unreadable)})
+	} else {
+		checks = append(checks, passed("integrity", ""))
+	}
+	if stats.UpToDate {
+		checks = append(checks, passed("schema", fmt.Sprintf("version %d", stats.SchemaVersion)))
+	} else {
+		checks = append(checks, Check{Name: "schema", Detail: fmt.Sprintf("outdated version %d", stats.SchemaVersion)})
+	}
+	return checks
+}
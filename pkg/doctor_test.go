@@ -0,0 +1,113 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+// refreshes tokens that are about to expire, unless the refresh token is "revoked"
+type fakeIdentity struct {
+	missing []string
+}
+
+func (f fakeIdentity) FetchIdentityInfo(a cloudsearch.AccountData) (*cloudsearch.AccountData, error) {
+	if a.Token == "" {
+		return nil, errors.New("unauthorized")
+	}
+	a.Description = "someone"
+	return &a, nil
+}
+
+func (f fakeIdentity) RefreshAccountIfNeeded(a cloudsearch.AccountData) (cloudsearch.AccountData, bool, error) {
+	if !a.ShouldReauth() {
+		return a, false, nil
+	}
+	if a.RefreshToken == "revoked" {
+		return a, false, errors.New("invalid_grant")
+	}
+	a.Token = "refreshed"
+	a.Expiry = time.Now().Add(time.Hour)
+	return a, true, nil
+}
+
+func (f fakeIdentity) MissingScopes(a cloudsearch.AccountData) ([]string, error) {
+	return f.missing, nil
+}
+
+func foundSearch(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+	out := make(chan cloudsearch.Result, 1)
+	out <- cloudsearch.Result{Id: "1"}
+	close(out)
+	return out
+}
+
+func failingSearch(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+	out := make(chan cloudsearch.Result)
+	close(out)
+	cloudsearch.ReportError(ctx, "failing", errors.New("rate limited"))
+	return out
+}
+
+func checksOf(report cloudsearch.HealthReport, accountId string) map[string]cloudsearch.Check {
+	res := map[string]cloudsearch.Check{}
+	for _, a := range report.Accounts {
+		if a.AccountId == accountId {
+			for _, c := range a.Checks {
+				res[c.Name] = c
+			}
+		}
+	}
+	return res
+}
+
+func TestDiagnose(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "healthy", AccountType: cloudsearch.Dropbox, Token: "tok", RefreshToken: "ok", Expiry: time.Now().Add(time.Minute), Active: true},
+		cloudsearch.AccountData{ID: "broken", AccountType: cloudsearch.Google, RefreshToken: "revoked", Expiry: time.Now().Add(-time.Hour), InactiveReason: "couldn't refresh"},
+	)
+	registry := test.DefaultRegistry()
+	registry.RegisterAccountType(cloudsearch.Dropbox, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{foundSearch}, []string{"files"}, nil
+	}, func(cloudsearch.AccountType) (cloudsearch.IdentityService, error) {
+		return fakeIdentity{}, nil
+	})
+	registry.RegisterAccountType(cloudsearch.Google, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{foundSearch, failingSearch}, []string{"drive", "gmail"}, nil
+	}, func(cloudsearch.AccountType) (cloudsearch.IdentityService, error) {
+		return fakeIdentity{missing: []string{"gmail"}}, nil
+	})
+
+	report, err := cloudsearch.Diagnose(context.Background(), accounts, registry, test.NewResultsStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Ok() {
+		t.Fatal("Should find the broken account ", report)
+	}
+
+	healthy := checksOf(report, "healthy")
+	for _, name := range []string{"active", "token", "identity", "scopes", "search:files"} {
+		if c, ok := healthy[name]; !ok || !c.Ok {
+			t.Fatal("Should pass the ", name, " check ", healthy)
+		}
+	}
+	if !strings.HasPrefix(healthy["token"].Detail, "refreshed") {
+		t.Fatal("Should refresh tokens about to expire ", healthy["token"])
+	}
+
+	broken := checksOf(report, "broken")
+	for _, name := range []string{"active", "token", "identity", "scopes", "search:gmail"} {
+		if c, ok := broken[name]; !ok || c.Ok {
+			t.Fatal("Should fail the ", name, " check ", broken)
+		}
+	}
+	if !broken["search:drive"].Ok || broken["search:gmail"].Detail != "rate limited" || broken["active"].Detail != "couldn't refresh" {
+		t.Fatal("Should tell what's wrong ", broken)
+	}
+}
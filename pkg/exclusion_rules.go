@@ -0,0 +1,153 @@
+package cloudsearch
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// content that should never be shown nor cached (eg HR folders, password manager exports)
+type ExclusionRules struct {
+	Paths         []string `json:"paths"`         // globs - "*" matches within a folder, "**" across folders. Globs w/o slashes match file names.
+	Labels        []string `json:"labels"`        // eg Gmail labels
+	SenderDomains []string `json:"senderDomains"` // also matches subdomains
+	MimeTypes     []string `json:"mimeTypes"`     // eg "application/pdf" or "image/*"
+
+	globs []pathGlob // Paths, once compiled
+}
+
+// compile the path globs, so they're not compiled again on every result. Paths are only matched once compiled.
+func (e *ExclusionRules) Compile() {
+	e.globs = nil
+	for _, g := range e.Paths {
+		e.globs = append(e.globs, compileGlob(g))
+	}
+}
+
+func (e ExclusionRules) IsEmpty() bool {
+	return len(e.Paths) == 0 && len(e.Labels) == 0 && len(e.SenderDomains) == 0 && len(e.MimeTypes) == 0
+}
+
+// whether a result matches any of the rules
+func (e ExclusionRules) Excludes(r Result) bool {
+	for _, l := range r.Labels {
+		if containsFold(e.Labels, l) {
+			return true
+		}
+	}
+
+	if p := detail(r, "path"); p != "" {
+		for _, g := range e.globs {
+			if g.matches(p) {
+				return true
+			}
+		}
+	}
+
+	if from := detail(r, "from"); from != "" {
+		for _, d := range e.SenderDomains {
+			if senderDomain.MatchString(from) && fromDomain(from, d) {
+				return true
+			}
+		}
+	}
+
+	if m := detail(r, "mimeType"); m != "" {
+		for _, t := range e.MimeTypes {
+			if mimeMatch(t, m) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// a filter hiding excluded results from searches
+func (e ExclusionRules) Filter(query Query, in Result) *Result {
+	if e.Excludes(in) {
+		logrus.Debug("Filtering excluded result: ", in.Id)
+		return nil
+	}
+	return &in
+}
+
+var senderDomain = regexp.MustCompile(`@([\w.-]+)`)
+
+func fromDomain(from string, domain string) bool {
+	domain = strings.ToLower(strings.TrimPrefix(domain, "@"))
+	for _, m := range senderDomain.FindAllStringSubmatch(from, -1) {
+		d := strings.ToLower(m[1])
+		if d == domain || strings.HasSuffix(d, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func mimeMatch(pattern string, mimeType string) bool {
+	pattern = strings.ToLower(pattern)
+	mimeType = strings.ToLower(mimeType)
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(mimeType, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == mimeType
+}
+
+type pathGlob struct {
+	re        *regexp.Regexp
+	fileNames bool // globs w/o slashes match file names only
+}
+
+// paths are matched case-insensitively, as some services (eg Dropbox) only give us lowercase ones
+func compileGlob(glob string) pathGlob {
+	glob = strings.ToLower(glob)
+	return pathGlob{
+		re:        regexp.MustCompile(globToRegex(glob)), // everything but wildcards is quoted
+		fileNames: !strings.Contains(glob, "/"),
+	}
+}
+
+func (g pathGlob) matches(path string) bool {
+	path = strings.ToLower(path)
+	if g.fileNames {
+		path = path[strings.LastIndex(path, "/")+1:]
+	} else if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return g.re.MatchString(path)
+}
+
+func globToRegex(glob string) string {
+	res := "^"
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case c == '*' && i+1 < len(glob) && glob[i+1] == '*':
+			res += ".*"
+			i++
+		case c == '*':
+			res += "[^/]*"
+		case c == '?':
+			res += "[^/]"
+		default:
+			res += regexp.QuoteMeta(string(c))
+		}
+	}
+
+	// a folder excludes everything in it
+	if strings.HasSuffix(glob, "/") {
+		return res + ".*$"
+	}
+	return res + "(/.*)?$"
+}
+
+func containsFold(strs []string, str string) bool {
+	for _, s := range strs {
+		if strings.EqualFold(s, str) {
+			return true
+		}
+	}
+	return false
+}
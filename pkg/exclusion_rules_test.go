@@ -0,0 +1,88 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+func withDetail(name string, value string) cloudsearch.Result {
+	return cloudsearch.Result{Details: map[string]interface{}{name: value}}
+}
+
+func TestExclusionRules(t *testing.T) {
+	rules := cloudsearch.ExclusionRules{
+		Paths:         []string{"/HR/**", "/shared/*/private", "*.1pux"},
+		Labels:        []string{"Personal"},
+		SenderDomains: []string{"bank.com"},
+		MimeTypes:     []string{"image/*", "application/x-1password"},
+	}
+	rules.Compile()
+
+	excluded := []cloudsearch.Result{
+		withDetail("path", "/hr/2018/salaries.xls"),
+		withDetail("path", "/shared/team/private/notes.txt"),
+		withDetail("path", "/backups/vault.1pux"),
+		{Labels: []string{"INBOX", "personal"}},
+		withDetail("from", "Bank <noreply@mail.bank.com>"),
+		withDetail("mimeType", "image/png"),
+		withDetail("mimeType", "application/x-1password"),
+	}
+	for _, r := range excluded {
+		if !rules.Excludes(r) {
+			t.Fatal("Should exclude ", r)
+		}
+	}
+
+	kept := []cloudsearch.Result{
+		withDetail("path", "/docs/hr.doc"),
+		withDetail("path", "/shared/team/public/private"),
+		withDetail("path", "/backups/vault.1pux.txt"),
+		{Labels: []string{"INBOX"}},
+		withDetail("from", "Foo <foo@notbank.com>"),
+		withDetail("mimeType", "application/pdf"),
+	}
+	for _, r := range kept {
+		if rules.Excludes(r) {
+			t.Fatal("Should keep ", r)
+		}
+	}
+}
+
+func TestExclusionsCantBeDisabled(t *testing.T) {
+	rules := cloudsearch.ExclusionRules{Labels: []string{"Personal"}}
+	reg := test.DefaultRegistry()
+	reg.RegisterRequiredFilter("exclusions", cloudsearch.FilterOrderExclude, cloudsearch.Stateless(rules.Filter))
+
+	pipeline := reg.FilterPipeline(nil, []string{"exclusions"})
+	q := cloudsearch.ParseQuery("foo nofilter:exclusions", "1", reg)
+	if apply(pipeline(q), q, cloudsearch.Result{OriginalId: "1", Labels: []string{"Personal"}}) != nil {
+		t.Fatal("Should always hide excluded results")
+	}
+}
+
+func TestExcludedResultsArentCached(t *testing.T) {
+	rules := cloudsearch.ExclusionRules{Labels: []string{"Personal"}}
+	results := test.NewResultsStorage()
+
+	remote := func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+		res := make(chan cloudsearch.Result, 2)
+		res <- cloudsearch.Result{Id: "work", Labels: []string{"Work"}}
+		res <- cloudsearch.Result{Id: "personal", Labels: []string{"Personal"}}
+		close(res)
+		return res
+	}
+
+	s := cloudsearch.NewCachedSearchable("test", results, cloudsearch.NoopSearchable(), remote, cloudsearch.AccountData{}, cloudsearch.CachePolicy{Rules: rules})
+	for range s(cloudsearch.Query{SearchMode: cloudsearch.Live}, context.Background()) {
+	}
+
+	if r, _ := results.Get("work"); r == nil {
+		t.Fatal("Should cache other results")
+	}
+	if r, _ := results.Get("personal"); r != nil {
+		t.Fatal("Should not cache excluded results")
+	}
+}
@@ -0,0 +1,179 @@
+package cloudsearch
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// results are counted by content type, service, account and the month they're from
+const (
+	FacetType    = "type"
+	FacetService = "service"
+	FacetAccount = "account"
+	FacetMonth   = "month"
+)
+
+var FacetNames = []string{FacetType, FacetService, FacetAccount, FacetMonth}
+
+// how many months back facets go, when the query doesn't say
+const FacetMonthsBack = 12
+
+const facetMonthFormat = "2006-01"
+
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+	Macro string `json:"macro"` // narrows down a search to this value (eg "type:Email")
+}
+
+// counts keyed by facet name, sorted by count
+type Facets map[string][]FacetCount
+
+func (f Facets) Get(name string, value string) int {
+	for _, c := range f[name] {
+		if c.Value == value {
+			return c.Count
+		}
+	}
+	return 0
+}
+
+// sum counts of results that don't overlap (eg from different profiles)
+func (f Facets) Add(other Facets) Facets {
+	counts := map[string]map[string]int{}
+	for _, facets := range []Facets{f, other} {
+		for name, values := range facets {
+			for _, v := range values {
+				if counts[name] == nil {
+					counts[name] = map[string]int{}
+				}
+				counts[name][v.Value] += v.Count
+			}
+		}
+	}
+	return NewFacets(counts)
+}
+
+// count results as they come in (eg live ones)
+type FacetCounter struct {
+	lock   sync.Mutex
+	counts map[string]map[string]int
+	seen   map[string]bool // grouped results are re-sent as they grow, so results are only counted once
+}
+
+func NewFacetCounter() *FacetCounter {
+	return &FacetCounter{
+		counts: map[string]map[string]int{},
+		seen:   map[string]bool{},
+	}
+}
+
+func (c *FacetCounter) Add(r Result) {
+	if r.Status != ResultFound {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, res := range append([]Result{r}, r.Members...) {
+		if res.Id != "" && c.seen[res.Id] {
+			continue
+		}
+		c.seen[res.Id] = true
+
+		c.inc(FacetType, string(res.ContentType))
+		c.inc(FacetService, string(res.AccountType))
+		c.inc(FacetAccount, res.AccountId)
+		if !res.Timestamp.IsZero() {
+			c.inc(FacetMonth, res.Timestamp.Format(facetMonthFormat))
+		}
+	}
+}
+
+func (c *FacetCounter) inc(name string, value string) {
+	if value == "" {
+		return
+	}
+	if c.counts[name] == nil {
+		c.counts[name] = map[string]int{}
+	}
+	c.counts[name][value] += 1
+}
+
+func (c *FacetCounter) Facets() Facets {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return NewFacets(c.counts)
+}
+
+// build facets from counts keyed by facet name and value
+func NewFacets(counts map[string]map[string]int) Facets {
+	res := Facets{}
+	for name, values := range counts {
+		for v, count := range values {
+			if count > 0 {
+				res[name] = append(res[name], FacetCount{Value: v, Count: count, Macro: FacetMacro(name, v)})
+			}
+		}
+
+		// most common first, months most recent first
+		sort.Slice(res[name], func(i, j int) bool {
+			a, b := res[name][i], res[name][j]
+			if name == FacetMonth {
+				return a.Value > b.Value
+			}
+			if a.Count == b.Count {
+				return a.Value < b.Value
+			}
+			return a.Count > b.Count
+		})
+	}
+	return res
+}
+
+// the query macro narrowing a search down to a facet value
+func FacetMacro(name string, value string) string {
+	switch name {
+	case FacetType:
+		return "type:" + value
+	case FacetService:
+		return "service:" + value
+	case FacetAccount:
+		return "account:" + value
+	case FacetMonth:
+		start, err := time.Parse(facetMonthFormat, value)
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf("after:%s before:%s", QueryFormattedTime(start), QueryFormattedTime(start.AddDate(0, 1, 0)))
+	}
+	return ""
+}
+
+// the months (by their first day) a query's results are counted on, most recent first
+func FacetMonths(q Query, now time.Time) []time.Time {
+	end := now
+	if q.Before != nil {
+		end = *q.Before
+	}
+	start := end.AddDate(0, -FacetMonthsBack+1, 0)
+	if q.After != nil && q.After.After(start) {
+		start = *q.After
+	}
+
+	res := []time.Time{}
+	m := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for !m.Before(time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)) {
+		res = append(res, m)
+		m = m.AddDate(0, -1, 0)
+	}
+	return res
+}
+
+func FacetMonthName(month time.Time) string {
+	return month.Format(facetMonthFormat)
+}
@@ -0,0 +1,124 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+func TestFacetCounter(t *testing.T) {
+	c := cloudsearch.NewFacetCounter()
+	email := cloudsearch.Result{Id: "1", ContentType: cloudsearch.Email, AccountType: cloudsearch.Google, AccountId: "a", Timestamp: time.Date(2019, 3, 2, 0, 0, 0, 0, time.UTC)}
+	doc := cloudsearch.Result{Id: "2", ContentType: cloudsearch.Document, AccountType: cloudsearch.Dropbox, AccountId: "b"}
+
+	c.Add(email)
+	c.Add(doc)
+
+	// a group re-sent w/ a new member only counts the member
+	grouped := email
+	grouped.Members = []cloudsearch.Result{{Id: "3", ContentType: cloudsearch.Email, AccountType: cloudsearch.Google, AccountId: "a"}}
+	c.Add(grouped)
+
+	f := c.Facets()
+	if f.Get(cloudsearch.FacetType, "Email") != 2 || f.Get(cloudsearch.FacetType, "Document") != 1 {
+		t.Fatal("Should count results by type: ", f)
+	}
+	if f.Get(cloudsearch.FacetService, "Google") != 2 || f.Get(cloudsearch.FacetAccount, "b") != 1 {
+		t.Fatal("Should count results by service and account: ", f)
+	}
+	if f.Get(cloudsearch.FacetMonth, "2019-03") != 1 {
+		t.Fatal("Should count results by month: ", f)
+	}
+	if f[cloudsearch.FacetType][0].Value != "Email" {
+		t.Fatal("Should list the most common values first: ", f)
+	}
+}
+
+func TestAddFacets(t *testing.T) {
+	a := cloudsearch.NewFacets(map[string]map[string]int{cloudsearch.FacetType: {"Email": 3, "Image": 1}})
+	b := cloudsearch.NewFacets(map[string]map[string]int{cloudsearch.FacetType: {"Email": 5}})
+
+	m := a.Add(b)
+	if m.Get(cloudsearch.FacetType, "Email") != 8 || m.Get(cloudsearch.FacetType, "Image") != 1 {
+		t.Fatal("Should sum the counts: ", m)
+	}
+}
+
+func TestCountCached(t *testing.T) {
+	account := cloudsearch.AccountData{ID: "a", AccountType: cloudsearch.Google, Active: true}
+	email := func(id string, title string) cloudsearch.Result {
+		r := cloudsearch.Result{AccountId: account.ID, AccountType: account.AccountType, ContentType: cloudsearch.Email, OriginalId: id, Title: title}
+		r.SetId()
+		return r
+	}
+	both, live, cached, excluded := email("1", "foo"), email("2", "foo"), email("3", "foo"), email("4", "secret foo")
+	other := email("5", "foo bar")
+
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Google, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{
+			func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+				res := make(chan cloudsearch.Result, 3)
+				res <- both
+				res <- live
+				res <- other
+				close(res)
+				return res
+			},
+		}, []string{"gmail"}, nil
+	}, nil)
+	e := cloudsearch.NewMultiSearch(cloudsearch.Env{}, test.NewAccountsStorage(account), test.NewResultsStorage(both, cached, excluded), reg, func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+		return []cloudsearch.ResultFilter{
+			func(q cloudsearch.Query, r cloudsearch.Result) *cloudsearch.Result {
+				if r.Title == "secret foo" {
+					return nil
+				}
+				return &r
+			},
+		}
+	})
+
+	q := cloudsearch.Query{Text: "foo"}
+	counter := cloudsearch.NewFacetCounter()
+	cloudsearch.Collect(e.Search(q, context.Background()), counter)
+	if err := e.CountCached(q, counter); err != nil {
+		t.Fatal(err)
+	}
+
+	// live and cached hits are counted once each, and filtered out cached ones aren't counted
+	if f := counter.Facets(); f.Get(cloudsearch.FacetType, "Email") != 4 || f.Get(cloudsearch.FacetAccount, "a") != 4 {
+		t.Fatal("Should count every live and cached result once: ", f)
+	}
+}
+
+func TestFacetMacrosNarrowDownQueries(t *testing.T) {
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Google, nil, nil)
+
+	macro := cloudsearch.FacetMacro(cloudsearch.FacetMonth, "2019-03")
+	if macro != "after:2019-03-01 before:2019-04-01" {
+		t.Fatal("Unexpected month macro: ", macro)
+	}
+
+	q := cloudsearch.ParseQuery("foo "+macro+" "+cloudsearch.FacetMacro(cloudsearch.FacetAccount, "abc123")+" type:Email", "1", reg)
+	if q.Text != "foo" || len(q.AccountIds) != 1 || q.AccountIds[0] != "abc123" || q.After == nil || q.Before == nil || len(q.ContentTypes) != 1 {
+		t.Fatal("Should parse facet macros: ", q)
+	}
+}
+
+func TestFacetMonths(t *testing.T) {
+	now := time.Date(2019, 3, 15, 0, 0, 0, 0, time.UTC)
+	after := time.Date(2019, 1, 20, 0, 0, 0, 0, time.UTC)
+
+	months := cloudsearch.FacetMonths(cloudsearch.Query{After: &after}, now)
+	if len(months) != 3 || cloudsearch.FacetMonthName(months[0]) != "2019-03" || cloudsearch.FacetMonthName(months[2]) != "2019-01" {
+		t.Fatal("Should count the months in the query range: ", months)
+	}
+
+	if months := cloudsearch.FacetMonths(cloudsearch.Query{}, now); len(months) != cloudsearch.FacetMonthsBack {
+		t.Fatal("Should default to the last months: ", months)
+	}
+}
@@ -29,10 +29,12 @@ func (app *SearchApp) Start() error {
 
 	maxX, maxY := g.Size()
 
-	resultsList := NewResultsList(0, 2, maxX-1, maxY-1)
-	bar := NewSearchBar(0, 0, maxX, maxY, app.engine, resultsList)
+	sidebarWidth := min(32, maxX/3)
+	resultsList := NewResultsList(0, 2, maxX-sidebarWidth-1, maxY-1, app.engine)
+	facets := NewFacetsSidebar(maxX-sidebarWidth, 2, maxX-1, maxY-1, app.engine)
+	bar := NewSearchBar(0, 0, maxX, maxY, app.engine, resultsList, facets)
 
-	g.SetManager(bar, resultsList, gocui.ManagerFunc(bar.Focus))
+	g.SetManager(bar, resultsList, facets, gocui.ManagerFunc(bar.Focus))
 	g.SetCurrentView("search_bar")
 
 	// global key bindings
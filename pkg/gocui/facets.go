@@ -0,0 +1,131 @@
+package gocui
+
+import (
+	"fmt"
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/jroimartin/gocui"
+	"sync"
+)
+
+// counts of the current search results, where a facet can be picked to narrow down the search
+type FacetsSidebar struct {
+	x        int
+	y        int
+	w        int
+	h        int
+	v        *gocui.View
+	lock     sync.Mutex
+	facets   cloudsearch.Facets
+	entries  []cloudsearch.FacetCount // selectable entries, in the order they're shown
+	selected int                      // -1 when nothing is selected
+	accounts map[string]string        // account descriptions, shown instead of ids
+}
+
+func NewFacetsSidebar(x0, y0, w, h int, engine *cloudsearch.SearchEngine) *FacetsSidebar {
+	accounts := map[string]string{}
+	if accts, err := engine.AllAccounts(); err == nil {
+		for _, a := range accts {
+			accounts[a.ID] = a.DisplayName()
+		}
+	}
+
+	return &FacetsSidebar{
+		x:        x0,
+		y:        y0,
+		w:        w,
+		h:        h,
+		selected: -1,
+		accounts: accounts,
+	}
+}
+
+func (f *FacetsSidebar) Layout(g *gocui.Gui) error {
+	if v, err := g.SetView("facets", f.x, f.y, f.w, f.h); err != nil {
+		if err != gocui.ErrUnknownView {
+			return err
+		}
+		v.Title = "Facets"
+		f.v = v
+	}
+
+	return nil
+}
+
+func (f *FacetsSidebar) Set(facets cloudsearch.Facets) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.facets = facets
+	f.render()
+}
+
+func (f *FacetsSidebar) Clear() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.facets = cloudsearch.Facets{}
+	f.selected = -1
+	f.render()
+}
+
+// move the selection to the next facet, wrapping around
+func (f *FacetsSidebar) Next() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if len(f.entries) == 0 {
+		f.selected = -1
+	} else {
+		f.selected = (f.selected + 1) % len(f.entries)
+	}
+	f.render()
+}
+
+// the macro for the selected facet, if any
+func (f *FacetsSidebar) SelectedMacro() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.selected < 0 || f.selected >= len(f.entries) {
+		return ""
+	}
+	return f.entries[f.selected].Macro
+}
+
+func (f *FacetsSidebar) render() {
+	if f.v == nil {
+		return
+	}
+	f.v.Clear()
+
+	// keep the same entry selected as counts change
+	selected := ""
+	if f.selected >= 0 && f.selected < len(f.entries) {
+		selected = f.entries[f.selected].Macro
+	}
+	f.entries = []cloudsearch.FacetCount{}
+	f.selected = -1
+
+	for _, name := range cloudsearch.FacetNames {
+		if len(f.facets[name]) == 0 {
+			continue
+		}
+
+		fmt.Fprintln(f.v, name)
+		for _, c := range f.facets[name] {
+			prefix := "  "
+			if c.Macro == selected {
+				prefix = matchColor + "> "
+				f.selected = len(f.entries)
+			}
+
+			value := c.Value
+			if d, ok := f.accounts[value]; ok && name == cloudsearch.FacetAccount {
+				value = d
+			}
+
+			fmt.Fprintln(f.v, fmt.Sprintf("%s%s (%d)%s", prefix, value, c.Count, resetColor))
+			f.entries = append(f.entries, c)
+		}
+	}
+}
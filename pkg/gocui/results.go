@@ -1,26 +1,30 @@
 package gocui
 
 import (
+	"context"
 	"fmt"
 	"github.com/herval/cloudsearch/pkg"
 	"github.com/jroimartin/gocui"
 	"github.com/sirupsen/logrus"
 	"github.com/skratchdot/open-golang/open"
-	"strconv"
+	"strings"
 )
 
 type ResultList struct {
-	x       int
-	y       int
-	w       int
-	h       int
-	v       *gocui.View
-	results []cloudsearch.Result
+	x        int
+	y        int
+	w        int
+	h        int
+	v        *gocui.View
+	results  []cloudsearch.Result
+	engine   *cloudsearch.SearchEngine
+	expanded map[string]bool      // grouped results showing their members
+	rows     []cloudsearch.Result // what's currently on screen, one per line
 }
 
-func NewResultsList(x0, y0, w, h int) *ResultList {
+func NewResultsList(x0, y0, w, h int, engine *cloudsearch.SearchEngine) *ResultList {
 	return &ResultList{
-		x0, y0, w, h, nil, []cloudsearch.Result{},
+		x0, y0, w, h, nil, []cloudsearch.Result{}, engine, map[string]bool{}, []cloudsearch.Result{},
 	}
 }
 
@@ -41,20 +45,124 @@ func (r *ResultList) Layout(g *gocui.Gui) error {
 }
 
 func (r *ResultList) Clear() {
-	r.v.Clear()
 	r.results = []cloudsearch.Result{}
+	r.expanded = map[string]bool{}
+	r.render()
+	r.v.SetOrigin(0, 0)
 	r.v.SetCursor(0, 0)
 }
 
+// add a result, or replace it if it was already listed (eg a group that got a new member)
 func (r *ResultList) Append(result cloudsearch.Result) {
-	r.results = append(r.results, result)
+	replaced := false
+	for i, e := range r.results {
+		if e.Id == result.Id {
+			r.results[i] = result
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		r.results = append(r.results, result)
+	}
+
+	r.render()
+}
 
-	// pad right
-	l := fmt.Sprintf("%-"+strconv.Itoa(r.w)+"s\n", result.Title)
+// show or hide the members of the selected group
+func (r *ResultList) ToggleExpanded() {
+	sel := r.selected()
+	if sel == nil || len(sel.Members) == 0 {
+		return
+	}
+
+	r.expanded[sel.Id] = !r.expanded[sel.Id]
+	r.render()
+}
+
+func (r *ResultList) render() {
+	r.v.Clear()
+	r.rows = []cloudsearch.Result{}
+
+	for _, res := range r.results {
+		line := rowSegments(res)
+		if len(res.Members) > 0 {
+			line = append(line, segment{text: fmt.Sprintf(" (%d)", res.MemberCount())})
+		}
+		r.writeRow(res, line)
+
+		if r.expanded[res.Id] {
+			for _, m := range res.Members {
+				r.writeRow(m, append([]segment{{text: "  ↳ "}}, rowSegments(m)...))
+			}
+		}
+	}
+}
+
+// matches on snippets are shown in color
+const (
+	matchColor = "\x1b[33;1m"
+	resetColor = "\x1b[0m"
+)
+
+type segment struct {
+	text  string
+	match bool
+}
+
+// the title, followed by the matching part of the body, if that's where the result matched
+func rowSegments(res cloudsearch.Result) []segment {
+	s := res.Snippet
+	if s == nil {
+		return []segment{{text: res.Title}}
+	}
+	if s.Field == "Title" {
+		return segments(s.Fragment, s.Matches)
+	}
+	return append([]segment{{text: res.Title + "  "}}, segments(s.Fragment, s.Matches)...)
+}
+
+func segments(text string, matches []cloudsearch.Match) []segment {
+	res := []segment{}
+	curr := 0
+	for _, m := range matches {
+		res = append(res, segment{text: text[curr:m.Start]}, segment{text: text[m.Start:m.End], match: true})
+		curr = m.End
+	}
+	return append(res, segment{text: text[curr:]})
+}
+
+func (r *ResultList) writeRow(res cloudsearch.Result, line []segment) {
+	r.rows = append(r.rows, res)
+
+	// cut at the view's width and pad right (w/o counting the color codes)
+	l := ""
+	left := r.w
+	for _, s := range line {
+		runes := []rune(s.text)
+		runes = runes[:min(len(runes), max(left, 0))]
+		left -= len(runes)
+
+		if s.match && len(runes) > 0 {
+			l += matchColor + string(runes) + resetColor
+		} else {
+			l += string(runes)
+		}
+	}
+	l += strings.Repeat(" ", max(left, 0)) + "\n"
 
 	r.v.Write([]byte(l))
 }
 
+func (r *ResultList) selected() *cloudsearch.Result {
+	_, y0 := r.v.Origin()
+	_, y := r.v.Cursor()
+	if y0+y >= len(r.rows) {
+		return nil
+	}
+	return &r.rows[y0+y]
+}
+
 func (r *ResultList) Prev() {
 	x, y := r.v.Cursor()
 	err := r.v.SetCursor(x, y-1)
@@ -70,26 +178,43 @@ func (r *ResultList) Prev() {
 
 func (r *ResultList) Next() {
 	x, y := r.v.Cursor()
-	err := r.v.SetCursor(x, min(y+1, len(r.results)-1))
+	err := r.v.SetCursor(x, min(y+1, len(r.rows)-1))
 
 	// scroll down
 	if err != nil {
 		_, y0 := r.v.Origin()
-		ny := min(y0+1, len(r.results)-1)
+		ny := min(y0+1, len(r.rows)-1)
 		r.v.SetOrigin(x, ny)
 		//r.v.SetCursor(x, ny)
 	}
 }
 
 func (r *ResultList) IsSelected() bool {
-	return len(r.results) > 0
+	return len(r.rows) > 0
 }
 
 func (r *ResultList) OpenSelected() {
-	_, y := r.v.Cursor()
+	sel := r.selected()
+	if sel == nil {
+		return
+	}
+
+	res := *sel
+	logrus.WithField("result", res).Debug("Opening...")
+	open.Run(res.Permalink)
 
-	logrus.WithField("result", r.results[y]).Debug("Opening...")
-	open.Run(r.results[y].Permalink)
+	go func() {
+		if err := r.engine.Opened(res); err != nil {
+			logrus.Error("Couldn't mark result as opened: ", err)
+		}
+
+		// partial results get fully loaded (and cached) once they're opened
+		if res.Hydrate != nil {
+			if _, err := r.engine.Hydrate(res, context.Background()); err != nil {
+				logrus.Error("Couldn't load result: ", err)
+			}
+		}
+	}()
 }
 
 // ugh...
@@ -7,10 +7,12 @@ import (
 	"github.com/jroimartin/gocui"
 	"github.com/sirupsen/logrus"
 	"strings"
+	"sync"
 	"time"
 )
 
-const DefaultHint = "Type to search, ↑/↓ to move, ENTER to open, C-c to exit"
+const DefaultHint = "Type to search, ↑/↓ to move, TAB to expand, ENTER to open, C-f/C-e to pick a facet, C-c to exit"
+const MoreResultsHint = "More results available, C-n to load them"
 
 type SearchBar struct {
 	x           int
@@ -19,20 +21,24 @@ type SearchBar struct {
 	h           int
 	engine      *SingleSearchHandler
 	results     *ResultList
+	facets      *FacetsSidebar
 	hintMessage string
 }
 
-func NewSearchBar(x0, y0, w, h int, engine *cloudsearch.SearchEngine, results *ResultList) *SearchBar {
+func NewSearchBar(x0, y0, w, h int, engine *cloudsearch.SearchEngine, results *ResultList, facets *FacetsSidebar) *SearchBar {
 	return &SearchBar{
 		x:           x0,
 		y:           y0,
 		w:           w,
 		h:           h,
 		results:     results,
+		facets:      facets,
 		hintMessage: DefaultHint,
 		engine: &SingleSearchHandler{
-			e: engine,
-			r: results,
+			e:  engine,
+			r:  results,
+			f:  facets,
+			re: engine.Registry(),
 		},
 	}
 }
@@ -89,6 +95,14 @@ func (s *SearchBar) Layout(g *gocui.Gui) error {
 						s.engine.Search()
 						// TODO handle err
 					}
+				case gocui.KeyTab:
+					s.results.ToggleExpanded()
+				case gocui.KeyCtrlN:
+					s.engine.LoadMore()
+				case gocui.KeyCtrlF:
+					s.facets.Next()
+				case gocui.KeyCtrlE:
+					s.addMacro(v, s.facets.SelectedMacro())
 				case gocui.KeyEsc:
 					s.clearInput(v) // TODO doesn't capture?
 				default:
@@ -110,6 +124,21 @@ func (s *SearchBar) clearInput(v *gocui.View) error {
 	return nil
 }
 
+// narrow down the current search (eg to a facet)
+func (s *SearchBar) addMacro(v *gocui.View, macro string) {
+	if macro == "" {
+		return
+	}
+
+	text := strings.TrimRight(v.Buffer(), "\r\n ")
+	for _, ch := range " " + macro {
+		v.EditWrite(ch)
+	}
+	logrus.Debug("Narrowing down ", text, " to ", macro)
+
+	s.engine.Search()
+}
+
 func (s *SearchBar) Focus(g *gocui.Gui) error {
 	g.Cursor = true
 	g.SetCurrentView("search_bar")
@@ -122,8 +151,13 @@ type SingleSearchHandler struct {
 	v                   *gocui.View
 	g                   *gocui.Gui
 	r                   *ResultList
+	f                   *FacetsSidebar
 	re                  *cloudsearch.Registry
 	currentSearchCancel context.CancelFunc
+	currentQuery        cloudsearch.Query
+	continuation        string                    // set when the current search has more results available
+	counter             *cloudsearch.FacetCounter // live and cached counts, across all pages of the current search
+	facetsLock          sync.Mutex
 }
 
 func (s *SingleSearchHandler) Search() error {
@@ -132,6 +166,10 @@ func (s *SingleSearchHandler) Search() error {
 	})
 
 	s.r.Clear()
+	s.f.Clear()
+	s.facetsLock.Lock()
+	s.counter = cloudsearch.NewFacetCounter()
+	s.facetsLock.Unlock()
 
 	if s.currentSearchCancel != nil {
 		logrus.Debug("Canceling previous query!")
@@ -144,15 +182,58 @@ func (s *SingleSearchHandler) Search() error {
 		return nil
 	}
 
+	s.currentQuery = cloudsearch.ParseQuery(data, cloudsearch.NewId(), s.re)
+	s.run(s.currentQuery)
+
+	return nil
+}
+
+// fetch the next page of the current search, appending to the current results
+func (s *SingleSearchHandler) LoadMore() error {
+	if s.continuation == "" {
+		return nil
+	}
+
+	pages, err := cloudsearch.ParseContinuation(s.continuation)
+	if err != nil {
+		return err
+	}
+
+	if s.currentSearchCancel != nil {
+		s.currentSearchCancel()
+	}
+
+	q := s.currentQuery
+	q.SearchId = cloudsearch.NewId()
+	q.PageTokens = pages
+	s.run(q)
+
+	return nil
+}
+
+func (s *SingleSearchHandler) run(query cloudsearch.Query) {
 	ctx, cancel := context.WithCancel(context.Background())
 	s.currentSearchCancel = cancel
+	s.setContinuation("")
 
-	id := cloudsearch.NewId()
 	res := s.e.Search(
-		cloudsearch.ParseQuery(data, id, s.re),
+		query,
 		ctx,
 	)
 
+	s.facetsLock.Lock()
+	counter := s.counter
+	s.facetsLock.Unlock()
+
+	// cached results are counted as a whole, and only on the first page
+	if !query.IsContinuation() {
+		go func() {
+			if err := s.e.CountCached(query, counter); err != nil {
+				logrus.Error("Couldn't count cached results: ", err)
+			}
+		}()
+	}
+
 	done := false
 	buff := make(chan cloudsearch.Result, 100)
 
@@ -160,9 +241,10 @@ func (s *SingleSearchHandler) Search() error {
 		for !done {
 			select {
 			case r, ok := <-res:
-				buff <- r
 				if !ok {
 					done = true
+				} else {
+					buff <- r
 				}
 			case <-ctx.Done():
 				done = true
@@ -181,16 +263,35 @@ func (s *SingleSearchHandler) Search() error {
 				for !buffDone {
 					select {
 					case r := <-buff:
-						s.r.Append(r)
+						if r.Status == cloudsearch.ResultMoreAvailable {
+							s.setContinuation(r.Continuation())
+						} else {
+							counter.Add(r)
+							s.r.Append(r)
+						}
 					default:
 						buffDone = true
 					}
 				}
 
+				s.f.Set(counter.Facets())
+
 				return nil
 			})
 		}
 	}()
+}
 
-	return nil
+func (s *SingleSearchHandler) setContinuation(continuation string) {
+	s.continuation = continuation
+
+	hint := DefaultHint
+	if continuation != "" {
+		hint = MoreResultsHint
+	}
+
+	if v, err := s.g.View("hints"); err == nil {
+		v.Clear()
+		fmt.Fprintln(v, hint)
+	}
 }
@@ -0,0 +1,84 @@
+package httpclient
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// a token bucket, refilled continuously at `rate` tokens per second up to `burst` tokens
+type limiter struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// block until a token is available or the context is done
+func (l *limiter) Wait(ctx context.Context) error {
+	for {
+		wait := l.reserve()
+		if wait == 0 {
+			return nil
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// take a token if there's one available, or return how long until the next one shows up
+func (l *limiter) reserve() time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.rate <= 0 {
+		return 0 // unlimited
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens -= 1
+		return 0
+	}
+
+	return time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+var limitersLock sync.Mutex
+var limiters = map[string]*limiter{}
+
+// limiters are shared by key (eg an account id), so every client built for the same account draws from
+// the same bucket, even after its searchables get rebuilt
+func limiterFor(key string, rate float64, burst int) *limiter {
+	limitersLock.Lock()
+	defer limitersLock.Unlock()
+
+	l, ok := limiters[key]
+	if !ok {
+		l = newLimiter(rate, burst)
+		limiters[key] = l
+	}
+	return l
+}
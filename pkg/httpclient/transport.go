@@ -0,0 +1,204 @@
+package httpclient
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Options struct {
+	RequestsPerSecond float64 // per account, 0 means unlimited
+	Burst             int
+	MaxRetries        int
+	MinBackoff        time.Duration
+	MaxBackoff        time.Duration
+}
+
+var DefaultOptions = Options{
+	RequestsPerSecond: 10,
+	Burst:             20,
+	MaxRetries:        4,
+	MinBackoff:        time.Millisecond * 500,
+	MaxBackoff:        time.Second * 10,
+}
+
+// total retries across every provider client
+var retries int64
+
+func TotalRetries() int64 {
+	return atomic.LoadInt64(&retries)
+}
+
+// an http middleware for provider APIs, rate limiting requests per account and retrying
+// throttled (429) or failed (5xx) requests with exponential backoff
+type Transport struct {
+	Base    http.RoundTripper
+	opts    Options
+	limiter *limiter
+	retries int64
+}
+
+func NewTransport(accountId string, base http.RoundTripper, opts Options) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		Base:    base,
+		opts:    opts,
+		limiter: limiterFor(accountId, opts.RequestsPerSecond, opts.Burst),
+	}
+}
+
+func NewClient(accountId string, opts Options) *http.Client {
+	return &http.Client{
+		Transport: NewTransport(accountId, nil, opts),
+	}
+}
+
+// how many requests were retried by this transport
+func (t *Transport) Retries() int64 {
+	return atomic.LoadInt64(&t.retries)
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		if err := t.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		r, err := rewind(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := t.Base.RoundTrip(r)
+		if attempt >= t.opts.MaxRetries || !canRewind(req) || !shouldRetry(res, err) || ctx.Err() != nil {
+			return res, err
+		}
+
+		wait := t.backoff(attempt, res)
+		if res != nil {
+			res.Body.Close()
+		}
+
+		atomic.AddInt64(&t.retries, 1)
+		atomic.AddInt64(&retries, 1)
+		logrus.WithFields(logrus.Fields{
+			"url":     req.URL.Host + req.URL.Path,
+			"attempt": attempt + 1,
+			"wait":    wait,
+		}).Debug("Retrying provider request")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// requests w/ a body can only be sent again if there's a way to get a fresh copy of it
+func canRewind(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// requests w/ a body can only be sent once, so get a fresh copy of it on retries
+func rewind(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	r := req.WithContext(req.Context())
+	r.Body = body
+	return r, nil
+}
+
+func shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		return true
+	case res.StatusCode >= 500:
+		return true
+	case res.StatusCode == http.StatusForbidden:
+		// Google reports some quota errors as 403s
+		return isRateLimited(res)
+	}
+	return false
+}
+
+func isRateLimited(res *http.Response) bool {
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(string(data), "ateLimitExceeded")
+}
+
+// exponential backoff w/ jitter, unless the server tells us how long to wait
+func (t *Transport) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if wait, ok := retryAfter(res.Header.Get("Retry-After")); ok {
+			if wait > t.opts.MaxBackoff {
+				return t.opts.MaxBackoff
+			}
+			return wait
+		}
+	}
+
+	wait := t.opts.MinBackoff << uint(attempt)
+	if wait > t.opts.MaxBackoff || wait <= 0 {
+		wait = t.opts.MaxBackoff
+	}
+
+	// wait somewhere between half and the full backoff time
+	half := int64(wait / 2)
+	if half <= 0 {
+		return wait
+	}
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// Retry-After can either be a number of seconds or a date
+func retryAfter(header string) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(header); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,183 @@
+package httpclient_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg/httpclient"
+)
+
+var fastRetries = httpclient.Options{
+	MaxRetries: 3,
+	MinBackoff: time.Millisecond,
+	MaxBackoff: time.Millisecond * 10,
+}
+
+// fail the first `failures` requests with the given status
+func flakyServer(failures int32, status int, header map[string]string) (*httptest.Server, *int32) {
+	var calls int32
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if n <= failures {
+			for k, v := range header {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write([]byte("ok" + string(body)))
+	})), &calls
+}
+
+func TestRetriesThrottledRequests(t *testing.T) {
+	s, calls := flakyServer(2, http.StatusTooManyRequests, nil)
+	defer s.Close()
+
+	tr := httpclient.NewTransport("throttled", nil, fastRetries)
+	res, err := (&http.Client{Transport: tr}).Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 || *calls != 3 || tr.Retries() != 2 {
+		t.Fatal("Should retry until successful: ", res.StatusCode, *calls, tr.Retries())
+	}
+}
+
+func TestRetriesServerErrorsWithBody(t *testing.T) {
+	s, calls := flakyServer(1, http.StatusServiceUnavailable, nil)
+	defer s.Close()
+
+	tr := httpclient.NewTransport("server_errors", nil, fastRetries)
+	res, err := (&http.Client{Transport: tr}).Post(s.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, _ := ioutil.ReadAll(res.Body)
+	if string(body) != "okbody" || *calls != 2 {
+		t.Fatal("Should resend the request body: ", string(body), *calls)
+	}
+}
+
+func TestDoesNotRetryBodiesThatCantBeResent(t *testing.T) {
+	s, calls := flakyServer(1, http.StatusServiceUnavailable, nil)
+	defer s.Close()
+
+	// no GetBody for bodies of unknown types
+	req, err := http.NewRequest("POST", s.URL, ioutil.NopCloser(strings.NewReader("body")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := httpclient.NewTransport("one_shot_body", nil, fastRetries)
+	res, err := (&http.Client{Transport: tr}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 503 || *calls != 1 || tr.Retries() != 0 {
+		t.Fatal("Should return the failure instead of resending an empty body: ", res.StatusCode, *calls, tr.Retries())
+	}
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	s, calls := flakyServer(100, http.StatusInternalServerError, nil)
+	defer s.Close()
+
+	tr := httpclient.NewTransport("broken", nil, fastRetries)
+	res, err := (&http.Client{Transport: tr}).Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 500 || *calls != 4 || tr.Retries() != 3 {
+		t.Fatal("Should give up after max retries: ", res.StatusCode, *calls, tr.Retries())
+	}
+}
+
+func TestDoesNotRetryClientErrors(t *testing.T) {
+	s, calls := flakyServer(1, http.StatusNotFound, nil)
+	defer s.Close()
+
+	tr := httpclient.NewTransport("not_found", nil, fastRetries)
+	res, err := (&http.Client{Transport: tr}).Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 404 || *calls != 1 {
+		t.Fatal("Should not retry: ", res.StatusCode, *calls)
+	}
+}
+
+func TestHonorsRetryAfter(t *testing.T) {
+	s, _ := flakyServer(1, http.StatusTooManyRequests, map[string]string{"Retry-After": "1"})
+	defer s.Close()
+
+	opts := fastRetries
+	opts.MaxBackoff = time.Second * 5
+
+	start := time.Now()
+	res, err := httpclient.NewClient("retry_after", opts).Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 || time.Since(start) < time.Second {
+		t.Fatal("Should wait for the Retry-After period: ", res.StatusCode, time.Since(start))
+	}
+}
+
+func TestRateLimitsPerAccount(t *testing.T) {
+	s, _ := flakyServer(0, 0, nil)
+	defer s.Close()
+
+	opts := fastRetries
+	opts.RequestsPerSecond = 20
+	opts.Burst = 1
+
+	c := httpclient.NewClient("rate_limited", opts)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		res, err := c.Get(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+
+	// 1 request from the burst, then 4 more at 20/s
+	if time.Since(start) < time.Millisecond*150 {
+		t.Fatal("Should throttle requests: ", time.Since(start))
+	}
+}
+
+func TestCancelledWhileWaiting(t *testing.T) {
+	s, _ := flakyServer(100, http.StatusTooManyRequests, map[string]string{"Retry-After": "10"})
+	defer s.Close()
+
+	opts := fastRetries
+	opts.MaxBackoff = time.Second * 10
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	_, err := httpclient.NewClient("cancelled", opts).Do(req.WithContext(ctx))
+	if err == nil {
+		t.Fatal("Should stop retrying when the request is cancelled")
+	}
+}
@@ -2,18 +2,32 @@ package integration_test
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"github.com/herval/cloudsearch/pkg"
 	"github.com/herval/cloudsearch/pkg/config"
+	"github.com/herval/cloudsearch/pkg/secrets"
     "github.com/herval/cloudsearch/pkg/test"
+	"os"
     "testing"
 )
 
 func TestUncachedSearch(t *testing.T) {
-	conf, err := config.NewConfig(cloudsearch.Env{"localhost", ":65432", "../"}, false)
+	// the index is encrypted, so there has to be a key w/o prompting. A throwaway one, on a throwaway storage
+	// path, so nothing real gets encrypted w/ it.
+	key, err := secrets.RandomKey()
 	if err != nil {
 		t.Fatal(err)
 	}
+	os.Setenv(secrets.KeyVar, base64.StdEncoding.EncodeToString(key))
+	defer os.Unsetenv(secrets.KeyVar)
+
+	conf, err := config.NewConfig(cloudsearch.Env{ServerBase: "localhost", HttpPort: ":65432", StoragePath: t.TempDir()}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conf.AccountsStorage.Close()
+	defer conf.ResultsStorage.Close()
 	search := conf.SearchEngine
 
 	t.Log("Searching...")
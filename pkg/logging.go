@@ -7,7 +7,8 @@ import (
 
 var LogLevel = logrus.DebugLevel
 
-func ConfigureLogging(debug bool, saveToFile bool) error {
+// logs are written to cloudsearch.log on the given path (eg the profile's storage path)
+func ConfigureLogging(debug bool, saveToFile bool, path string) error {
 	if debug {
 		LogLevel = logrus.DebugLevel
 	} else {
@@ -16,7 +17,7 @@ func ConfigureLogging(debug bool, saveToFile bool) error {
 	logrus.SetLevel(LogLevel)
 
 	if saveToFile {
-		f, err := os.OpenFile("cloudsearch.log", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0755)
+		f, err := os.OpenFile(FileAt(path, "cloudsearch.log"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0755)
 		if err != nil {
 			return err
 		}
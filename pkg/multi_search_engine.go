@@ -2,6 +2,7 @@ package cloudsearch
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -16,14 +17,16 @@ func NewMultiSearch(
 	results ResultsStorage,
 	registry *Registry,
 	filterBuilder func(q Query) []ResultFilter,
-) SearchEngine {
-	a := SearchEngine{
-		env:                env,
-		accounts:           accounts,
-		currentSearchables: []SearchFunc{},
-		FilterBuilder:      filterBuilder,
-		registry:           registry,
-		results:            results,
+) *SearchEngine {
+	a := &SearchEngine{
+		env:           env,
+		accounts:      accounts,
+		searchables:   map[string]accountSearchables{},
+		disabled:      map[string]bool{},
+		synced:        map[string]time.Time{},
+		FilterBuilder: filterBuilder,
+		registry:      registry,
+		results:       results,
 	}
 
 	err := a.Refresh()
@@ -36,60 +39,226 @@ func NewMultiSearch(
 
 // search multiple searchables and multiplex the results into a single channel
 type SearchEngine struct {
-	lock               sync.Mutex
-	env                Env
-	currentSearchables []SearchFunc
-	accounts           AccountsStorage
-	results            ResultsStorage
-	FilterBuilder      func(q Query) []ResultFilter
-	registry           *Registry
+	lock          sync.Mutex
+	env           Env
+	searchables   map[string]accountSearchables // keyed by account id
+	disabled      map[string]bool               // accounts turned off, whose cached results aren't shown either
+	synced        map[string]time.Time          // when each account's searchables were last built
+	accounts      AccountsStorage
+	results       ResultsStorage
+	FilterBuilder func(q Query) []ResultFilter
+	registry      *Registry
 
 	// allow building composable searchables (eg support caching and filtering). One account can have multiple searchables.
 }
 
-// rebuild the searchables list, closing previously open searchables
+// the searchables built for a single account, so they can be replaced or removed on their own
+type accountSearchables struct {
+	account     AccountData
+	searchables []SearchFunc
+	ids         []string
+}
+
+func (s *SearchEngine) Registry() *Registry {
+	return s.registry
+}
+
+// rebuild the searchables for every account. Accounts that fail to build are marked as degraded
+// and skipped, without affecting the others.
 func (s *SearchEngine) Refresh() error {
+	a, err := s.accounts.All()
+	if err != nil {
+		return err
+	}
+
+	existing := map[string]bool{}
+	failed := []string{}
+	for _, acc := range a {
+		existing[acc.ID] = true
+
+		if err := s.RefreshAccount(acc); err != nil {
+			failed = append(failed, acc.Description+": "+err.Error())
+		}
+	}
+
+	// drop searchables for accounts that aren't around anymore
 	s.lock.Lock()
-	defer s.lock.Unlock()
+	for id := range s.searchables {
+		if !existing[id] {
+			delete(s.searchables, id)
+		}
+	}
+	for id := range s.disabled {
+		if !existing[id] {
+			delete(s.disabled, id)
+		}
+	}
+	s.lock.Unlock()
+
+	if len(failed) > 0 {
+		return errors.New("Could not set up some accounts: " + strings.Join(failed, ", "))
+	}
+
+	return nil
+}
+
+// (re)build the searchables for a single account, replacing the ones previously built for it
+func (s *SearchEngine) RefreshAccount(acc AccountData) error {
+	if acc.Disabled {
+		s.lock.Lock()
+		delete(s.searchables, acc.ID)
+		s.disabled[acc.ID] = true
+		s.lock.Unlock()
+		return nil
+	}
+
+	acc, searchables, ids, err := s.build(acc)
+
+	s.lock.Lock()
+	delete(s.disabled, acc.ID)
+	s.synced[acc.ID] = time.Now()
+	if len(searchables) > 0 {
+		s.searchables[acc.ID] = accountSearchables{
+			account:     acc,
+			searchables: searchables,
+			ids:         ids,
+		}
+	} else {
+		delete(s.searchables, acc.ID)
+	}
+	s.lock.Unlock()
 
-	a, err := s.accounts.All()
 	if err != nil {
+		logrus.Error("Could not search " + acc.Description + ": " + err.Error())
+		s.markDegraded(acc, err)
 		return err
 	}
 
-	s.currentSearchables = []SearchFunc{}
+	s.markHealthy(acc)
+	return nil
+}
 
-	for _, acc := range a {
-		if acc.ShouldReauth() {
-			auth, err := s.registry.AuthBuilder(acc.AccountType)
-			if err != nil {
-				return errors.Wrap(err, "Could not build authenticator")
-			}
+// stop searching on a given account
+func (s *SearchEngine) RemoveAccount(accountId string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-			acc, _, err = auth.RefreshAccountIfNeeded(acc)
-			if err != nil {
-				logrus.Error("Could not search " + acc.Description + ": " + err.Error())
-				//return errors.Wrap(err, "Could not refresh account")
-				continue
-			}
-			// TODO mark failed as inactive?
+	delete(s.searchables, accountId)
+}
+
+// builders may return searchables along with an error (eg cached results are still searchable
+// when the remote service can't be reached), so both are returned here
+func (s *SearchEngine) build(acc AccountData) (AccountData, []SearchFunc, []string, error) {
+	if acc.ShouldReauth() {
+		auth, err := s.registry.AuthBuilder(acc.AccountType)
+		if err != nil {
+			return acc, nil, nil, errors.Wrap(err, "Could not build authenticator")
 		}
 
-		searchables, _, err := s.registry.SearchBuilder(acc)
+		acc, _, err = auth.RefreshAccountIfNeeded(acc)
 		if err != nil {
-			return err
+			return acc, nil, nil, errors.Wrap(err, "Could not refresh account")
 		}
-		s.currentSearchables = append(s.currentSearchables, searchables...)
 	}
 
-	return nil
+	searchables, ids, err := s.registry.SearchBuilder(acc)
+	return acc, searchables, ids, err
+}
+
+func (s *SearchEngine) markDegraded(acc AccountData, cause error) {
+	if !acc.Active && acc.InactiveReason == cause.Error() {
+		return
+	}
+
+	acc.Active = false
+	acc.InactiveReason = cause.Error()
+	if err := s.accounts.Save(&acc); err != nil {
+		logrus.Error("Could not mark account as degraded: ", err)
+	}
+}
+
+func (s *SearchEngine) markHealthy(acc AccountData) {
+	if acc.Active && acc.InactiveReason == "" {
+		return
+	}
+
+	acc.Active = true
+	acc.InactiveReason = ""
+	if err := s.accounts.Save(&acc); err != nil {
+		logrus.Error("Could not mark account as active: ", err)
+	}
+}
+
+func (s *SearchEngine) currentSearchables(query Query) []SearchFunc {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := []SearchFunc{}
+	for id, a := range s.searchables {
+		if len(query.AccountIds) > 0 && !StringsContain(query.AccountIds, id) {
+			continue
+		}
+		res = append(res, a.searchables...)
+	}
+	return res
+}
+
+// accounts can be asked for by their alias too (eg account:work), including the ones that aren't being searched
+// (eg w/ cached results only)
+func (s *SearchEngine) resolveAliases(query Query) Query {
+	if len(query.AccountIds) == 0 {
+		return query
+	}
+
+	accounts, err := s.accounts.All()
+	if err != nil {
+		logrus.Error("Couldn't resolve account aliases: ", err)
+		return query
+	}
+
+	ids := []string{}
+	for _, id := range query.AccountIds {
+		for _, a := range accounts {
+			if a.Alias != "" && a.Alias == id {
+				id = a.ID
+				break
+			}
+		}
+		ids = append(ids, id)
+	}
+	query.AccountIds = ids
+	return query
+}
+
+// searches wait for the slowest account being searched
+func (s *SearchEngine) timeout(query Query) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	res := DefaultSearchTimeout
+	for id, a := range s.searchables {
+		if len(query.AccountIds) > 0 && !StringsContain(query.AccountIds, id) {
+			continue
+		}
+		if t := a.account.Settings.SearchTimeout(); t > res {
+			res = t
+		}
+	}
+	return res
+}
+
+func (s *SearchEngine) isDisabled(accountId string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.disabled[accountId]
 }
 
 func (s *SearchEngine) Search(query Query, ctx context.Context) <-chan Result {
-	ctx, _ = context.WithTimeout(ctx, time.Second*15) // dont wait too long for downstream answers - some are pretty pretty slow
+	query = s.resolveAliases(query)
+	ctx, cancel := context.WithTimeout(ctx, s.timeout(query)) // dont wait too long for downstream answers - some are pretty pretty slow
 
 	m := NewStopwatch("multisearch_" + query.SearchId)
-	searchables := s.currentSearchables
+	searchables := s.currentSearchables(query)
 	filters := s.FilterBuilder(query)
 
 	results := make(chan Result)
@@ -97,6 +266,10 @@ func (s *SearchEngine) Search(query Query, ctx context.Context) <-chan Result {
 	var finished int32 = 0
 	done := make(chan bool, len(searchables))
 
+	// sources w/ more results available, bundled into a single marker once everything's done
+	var pagesLock sync.Mutex
+	pageTokens := map[string]string{}
+
 	logrus.WithFields(map[string]interface{}{
 		"sources": len(searchables),
 		"queryId": query.SearchId,
@@ -110,6 +283,18 @@ func (s *SearchEngine) Search(query Query, ctx context.Context) <-chan Result {
 				break
 			}
 
+			if d.Status == ResultMoreAvailable {
+				source, _ := d.Details["source"].(string)
+				token, _ := d.Details["pageToken"].(string)
+				pagesLock.Lock()
+				pageTokens[source] = token
+				pagesLock.Unlock()
+				continue
+			}
+			if s.isDisabled(d.AccountId) { // cached results are shared by every account
+				continue
+			}
+
 			c := &d
 			skip := false
 			if c.Id == "" {
@@ -123,7 +308,7 @@ func (s *SearchEngine) Search(query Query, ctx context.Context) <-chan Result {
 					break
 				}
 
-				c = filterOut(query, d)
+				c = filterOut(query, *c)
 				if c == nil {
 					skip = true
 					break
@@ -131,6 +316,10 @@ func (s *SearchEngine) Search(query Query, ctx context.Context) <-chan Result {
 			}
 
 			if !skip && ctx.Err() == nil {
+				for _, u := range c.Updated {
+					results <- u
+				}
+				c.Updated = nil
 				results <- *c
 			}
 		}
@@ -143,6 +332,8 @@ func (s *SearchEngine) Search(query Query, ctx context.Context) <-chan Result {
 		}
 
 		go func() {
+			defer cancel()
+
 			for finished < int32(len(searchables)) {
 				select {
 				case <-ctx.Done():
@@ -153,6 +344,17 @@ func (s *SearchEngine) Search(query Query, ctx context.Context) <-chan Result {
 				}
 			}
 
+			pagesLock.Lock()
+			if len(pageTokens) > 0 && ctx.Err() == nil {
+				results <- Result{
+					Status: ResultMoreAvailable,
+					Details: map[string]interface{}{
+						"continuation": EncodeContinuation(pageTokens),
+					},
+				}
+			}
+			pagesLock.Unlock()
+
 			logrus.Debug("Closing search " + query.SearchId)
 			m.Lap()
 			close(results)
@@ -160,19 +362,103 @@ func (s *SearchEngine) Search(query Query, ctx context.Context) <-chan Result {
 
 	} else {
 		// close right away
+		cancel()
 		defer close(results)
 	}
 
 	return results
 }
 
+// counts of cached results matching a query, by content type, service, account and month
+func (s *SearchEngine) Facets(query Query) (Facets, error) {
+	c := NewFacetCounter()
+	err := s.CountCached(query, c)
+	return c.Facets(), err
+}
+
+// count cached results matching a query, going through the same filters (and exclusion rules) as searches. Results
+// already on the counter (eg found live) aren't counted twice.
+func (s *SearchEngine) CountCached(query Query, counter *FacetCounter) error {
+	if s.results == nil || query.SearchMode == Live {
+		return nil
+	}
+	query = s.resolveAliases(query)
+
+	res, err := s.results.Matching(query)
+	if err != nil {
+		return err
+	}
+
+	filters := s.FilterBuilder(query)
+	for r := range res {
+		if s.isDisabled(r.AccountId) {
+			continue
+		}
+
+		c := &r
+		if c.Id == "" {
+			c.SetId()
+		}
+		for _, filterOut := range filters {
+			c = filterOut(query, *c)
+			if c == nil {
+				break
+			}
+		}
+
+		if c != nil {
+			for _, u := range c.Updated {
+				counter.Add(u)
+			}
+			counter.Add(*c)
+		}
+	}
+	return nil
+}
+
+// load the full content of a partial result (eg when it's opened), caching it along the way
+func (s *SearchEngine) Hydrate(r Result, ctx context.Context) (Result, error) {
+	if r.Hydrate == nil {
+		return r, nil
+	}
+
+	full, err := r.Hydrate(ctx)
+	if err != nil {
+		return r, err
+	}
+
+	if s.results != nil {
+		return s.results.Merge(full)
+	}
+	return full, nil
+}
+
+// keep track of when cached results are opened, so the ones in use aren't the first evicted from the cache
+func (s *SearchEngine) Opened(r Result) error {
+	if s.results == nil {
+		return nil
+	}
+
+	return s.results.MarkOpened(r.Id, time.Now())
+}
+
+// write anything pending on the results storage, including partial results still being loaded
+func (s *SearchEngine) Close() {
+	if s.results != nil {
+		if !WaitForHydrations(hydrationTimeout) {
+			logrus.Error("Gave up on indexing partial results still being loaded")
+		}
+		s.results.Close()
+	}
+}
+
 func (s *SearchEngine) SaveAccount(data *AccountData) error {
 	err := s.accounts.Save(data)
 	if err != nil {
 		return err
 	}
 
-	return s.Refresh()
+	return s.RefreshAccount(*data)
 }
 
 func (s *SearchEngine) AllAccounts() ([]AccountData, error) {
@@ -190,49 +476,58 @@ func (s *SearchEngine) DeleteAccount(id string) error {
 		return err
 	}
 
-	return s.Refresh()
+	s.RemoveAccount(id)
+	return nil
 }
 
-// watch for expired tokens and try to refresh them in a loop
+// keep accounts in sync in a loop (see SyncAccounts)
 func (s *SearchEngine) WatchTokens() {
 	for true {
-		acc, err := s.accounts.All()
-		if err != nil {
-			logrus.Error("Getting accts", err)
+		s.SyncAccounts()
+		time.Sleep(time.Minute)
+	}
+}
+
+// refresh tokens about to expire, and sync accounts as often as their settings say - their searchables are built
+// again, so accounts that couldn't be searched are searched again once they can
+func (s *SearchEngine) SyncAccounts() {
+	acc, err := s.accounts.All()
+	if err != nil {
+		logrus.Error("Getting accts", err)
+		return
+	}
+
+	for _, a := range acc {
+		if a.Disabled {
 			continue
 		}
 
-		refresh := false
-		for _, a := range acc {
-			if a.RefreshToken != "" {
-				// TODO if auth can't be established fast, fail
-
-				auth, err := s.registry.AuthBuilder(a.AccountType)
-				if err != nil {
-					logrus.Error("Auth building", err)
-					continue
-				}
+		changed := false
+		if a.RefreshToken != "" && a.ShouldReauth() {
+			// TODO if auth can't be established fast, fail
 
-				_, changed, err := auth.RefreshAccountIfNeeded(a)
-				if err != nil {
-					logrus.Error("Refreshing acc ", err)
-					continue
-				}
+			auth, err := s.registry.AuthBuilder(a.AccountType)
+			if err != nil {
+				logrus.Error("Auth building", err)
+				continue
+			}
 
-				if changed {
-					logrus.Debug("Account auth changed, refreshing")
-					refresh = true
-				}
+			a, changed, err = auth.RefreshAccountIfNeeded(a)
+			if err != nil {
+				logrus.Error("Refreshing acc ", err)
+				s.markDegraded(a, err)
+				continue
 			}
 		}
 
-		if refresh {
-			err = s.Refresh()
-			if err != nil {
+		s.lock.Lock()
+		synced, ok := s.synced[a.ID]
+		s.lock.Unlock()
+		if changed || !ok || time.Since(synced) >= a.Settings.SyncPeriod() {
+			logrus.Debug("Syncing account ", a.ID)
+			if err := s.RefreshAccount(a); err != nil {
 				logrus.Error("Ref", err)
 			}
 		}
-
-		time.Sleep(time.Minute * 10)
 	}
 }
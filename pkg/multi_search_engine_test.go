@@ -0,0 +1,270 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+func staticSearch(title string) cloudsearch.SearchFunc {
+	return func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+		res := make(chan cloudsearch.Result, 1)
+		res <- cloudsearch.Result{
+			Title:      title,
+			OriginalId: title,
+		}
+		close(res)
+		return res
+	}
+}
+
+func engineWith(accounts *test.AccountsStorage, failing map[string]bool) *cloudsearch.SearchEngine {
+	builder := func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		if failing[a.ID] {
+			return nil, nil, errors.New("broken")
+		}
+		return []cloudsearch.SearchFunc{staticSearch(a.ID)}, []string{"static"}, nil
+	}
+
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Dropbox, builder, nil)
+
+	return cloudsearch.NewMultiSearch(
+		cloudsearch.Env{},
+		accounts,
+		nil,
+		reg,
+		func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+			return []cloudsearch.ResultFilter{}
+		},
+	)
+}
+
+func titles(e *cloudsearch.SearchEngine) map[string]bool {
+	res := map[string]bool{}
+	for r := range e.Search(cloudsearch.Query{Text: "foo"}, context.Background()) {
+		res[r.Title] = true
+	}
+	return res
+}
+
+func TestBrokenAccountIsDegraded(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "ok", AccountType: cloudsearch.Dropbox, Active: true},
+		cloudsearch.AccountData{ID: "broken", AccountType: cloudsearch.Dropbox, Active: true},
+	)
+	failing := map[string]bool{"broken": true}
+	e := engineWith(accounts, failing)
+
+	if res := titles(e); !res["ok"] || res["broken"] {
+		t.Fatal("Should keep searching healthy accounts: ", res)
+	}
+
+	broken := accounts.Get("broken")
+	if broken.Active || broken.InactiveReason != "broken" {
+		t.Fatal("Should mark the account as degraded: ", broken)
+	}
+
+	// recovering the account puts it back into rotation
+	delete(failing, "broken")
+	if err := e.RefreshAccount(broken); err != nil {
+		t.Fatal(err)
+	}
+
+	if res := titles(e); !res["ok"] || !res["broken"] {
+		t.Fatal("Should search the recovered account: ", res)
+	}
+
+	if recovered := accounts.Get("broken"); !recovered.Active || recovered.InactiveReason != "" {
+		t.Fatal("Should mark the account as active: ", recovered)
+	}
+}
+
+func TestRemoveAccount(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "a", AccountType: cloudsearch.Dropbox, Active: true},
+		cloudsearch.AccountData{ID: "b", AccountType: cloudsearch.Dropbox, Active: true},
+	)
+	e := engineWith(accounts, map[string]bool{})
+
+	e.RemoveAccount("a")
+
+	if res := titles(e); res["a"] || !res["b"] {
+		t.Fatal("Should only search the remaining account: ", res)
+	}
+}
+
+func TestBundlesMoreResultsMarkers(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "a", AccountType: cloudsearch.Dropbox, Active: true},
+		cloudsearch.AccountData{ID: "b", AccountType: cloudsearch.Dropbox, Active: true},
+	)
+
+	builder := func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{
+			func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+				res := make(chan cloudsearch.Result, 2)
+				res <- cloudsearch.Result{Title: a.ID, OriginalId: a.ID}
+				res <- cloudsearch.MoreResults(a, "static", "next_"+a.ID)
+				close(res)
+				return res
+			},
+		}, []string{"static"}, nil
+	}
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Dropbox, builder, nil)
+
+	e := cloudsearch.NewMultiSearch(cloudsearch.Env{}, accounts, nil, reg, func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+		return []cloudsearch.ResultFilter{cloudsearch.FilterContent}
+	})
+
+	found := 0
+	markers := []cloudsearch.Result{}
+	for r := range e.Search(cloudsearch.Query{Text: "foo"}, context.Background()) {
+		if r.Status == cloudsearch.ResultMoreAvailable {
+			markers = append(markers, r)
+		} else {
+			found += 1
+		}
+	}
+
+	if found != 2 || len(markers) != 1 {
+		t.Fatal("Should bundle all markers into a single one: ", found, markers)
+	}
+
+	pages, err := cloudsearch.ParseContinuation(markers[0].Continuation())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pages["a/static"] != "next_a" || pages["b/static"] != "next_b" {
+		t.Fatal("Should include every source's page token: ", pages)
+	}
+
+	q := cloudsearch.Query{PageTokens: pages}
+	if token, ok := q.PageToken(cloudsearch.AccountData{ID: "a"}, "static"); !ok || token != "next_a" {
+		t.Fatal("Should continue from the page token: ", token)
+	}
+	if _, ok := q.PageToken(cloudsearch.AccountData{ID: "c"}, "static"); ok {
+		t.Fatal("Should skip exhausted sources when continuing")
+	}
+}
+
+func TestDisabledAccount(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "on", AccountType: cloudsearch.Dropbox, Active: true},
+		cloudsearch.AccountData{ID: "off", AccountType: cloudsearch.Dropbox, Active: true, Disabled: true},
+	)
+
+	// cached results are searched along w/ every account, whichever account they're from
+	builder := func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{
+			func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+				res := make(chan cloudsearch.Result, 2)
+				res <- cloudsearch.Result{Title: a.ID, OriginalId: a.ID, AccountId: a.ID}
+				res <- cloudsearch.Result{Title: "cached", OriginalId: "cached", AccountId: "off"}
+				close(res)
+				return res
+			},
+		}, []string{"static"}, nil
+	}
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Dropbox, builder, nil)
+	e := cloudsearch.NewMultiSearch(cloudsearch.Env{}, accounts, nil, reg, func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+		return []cloudsearch.ResultFilter{}
+	})
+
+	if res := titles(e); !res["on"] || res["off"] || res["cached"] {
+		t.Fatal("Should not search disabled accounts: ", res)
+	}
+	if off := accounts.Get("off"); !off.Active {
+		t.Fatal("Should not mark disabled accounts as degraded: ", off)
+	}
+
+	off := accounts.Get("off")
+	off.Disabled = false
+	if err := e.SaveAccount(&off); err != nil {
+		t.Fatal(err)
+	}
+	if res := titles(e); !res["on"] || !res["off"] || !res["cached"] {
+		t.Fatal("Should search accounts once they're enabled: ", res)
+	}
+}
+
+func TestAccountAlias(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "a", AccountType: cloudsearch.Dropbox, Active: true, Alias: "work"},
+		cloudsearch.AccountData{ID: "b", AccountType: cloudsearch.Dropbox, Active: true},
+	)
+	e := engineWith(accounts, map[string]bool{})
+
+	res := map[string]bool{}
+	for r := range e.Search(cloudsearch.ParseQuery("foo account:work", "", e.Registry()), context.Background()) {
+		res[r.Title] = true
+	}
+	if !res["a"] || res["b"] {
+		t.Fatal("Should search accounts by their alias: ", res)
+	}
+}
+
+func TestAccountAliasOnCachedResults(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "a", AccountType: cloudsearch.Dropbox, Active: true, Alias: "work"},
+		cloudsearch.AccountData{ID: "b", AccountType: cloudsearch.Dropbox, Active: true},
+	)
+	results := test.NewResultsStorage(
+		cloudsearch.Result{Id: "1", AccountId: "a", AccountType: cloudsearch.Dropbox, ContentType: cloudsearch.File},
+		cloudsearch.Result{Id: "2", AccountId: "b", AccountType: cloudsearch.Dropbox, ContentType: cloudsearch.File},
+	)
+
+	// neither account can be searched live, so only their cached results are around
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Dropbox, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return nil, nil, errors.New("broken")
+	}, nil)
+	e := cloudsearch.NewMultiSearch(cloudsearch.Env{}, accounts, results, reg, func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+		return []cloudsearch.ResultFilter{cloudsearch.FilterAccounts}
+	})
+
+	f, err := e.Facets(cloudsearch.ParseQuery("foo account:work", "", e.Registry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Get(cloudsearch.FacetAccount, "a") != 1 || f.Get(cloudsearch.FacetAccount, "b") != 0 {
+		t.Fatal("Should resolve aliases of accounts that aren't searched: ", f)
+	}
+}
+
+func TestSyncAccounts(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "expiring", AccountType: cloudsearch.Dropbox, Active: true, Token: "token", RefreshToken: "refresh",
+			Expiry: time.Now().Add(time.Minute), Settings: cloudsearch.AccountSettings{SyncInterval: 24 * time.Hour}},
+		cloudsearch.AccountData{ID: "fresh", AccountType: cloudsearch.Dropbox, Active: true, Token: "token", RefreshToken: "refresh",
+			Expiry: time.Now().Add(time.Hour), Settings: cloudsearch.AccountSettings{SyncInterval: 24 * time.Hour}},
+	)
+
+	built := map[string][]string{} // tokens each account was built w/
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Dropbox, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		built[a.ID] = append(built[a.ID], a.Token)
+		return []cloudsearch.SearchFunc{staticSearch(a.ID)}, []string{"static"}, nil
+	}, func(accountType cloudsearch.AccountType) (cloudsearch.IdentityService, error) {
+		return fakeIdentity{}, nil
+	})
+	e := cloudsearch.NewMultiSearch(cloudsearch.Env{}, accounts, nil, reg, func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+		return []cloudsearch.ResultFilter{}
+	})
+
+	e.SyncAccounts()
+
+	// tokens about to expire are refreshed regardless of the sync schedule
+	if tokens := built["expiring"]; len(tokens) != 2 || tokens[1] != "refreshed" {
+		t.Fatal("Should refresh tokens about to expire: ", tokens)
+	}
+	if tokens := built["fresh"]; len(tokens) != 1 {
+		t.Fatal("Should only sync accounts when they're due: ", tokens)
+	}
+}
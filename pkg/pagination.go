@@ -0,0 +1,101 @@
+package cloudsearch
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// how many results are fetched from each source when the query doesn't say
+const DefaultMaxResults = 100
+
+// sources are identified by account + searchable id (eg "<account id>/gmail")
+func PageKey(account AccountData, source string) string {
+	return account.ID + "/" + source
+}
+
+// a marker result, emitted by sources that stopped before running out of results. Searching again
+// with the given page token picks up from where it stopped.
+func MoreResults(account AccountData, source string, pageToken string) Result {
+	return Result{
+		AccountId:   account.ID,
+		AccountType: account.AccountType,
+		Status:      ResultMoreAvailable,
+		Details: map[string]interface{}{
+			"source":    PageKey(account, source),
+			"pageToken": pageToken,
+		},
+	}
+}
+
+// how much of a search's time is kept to report where sources stopped, once they run out of time
+var TimeBudgetMargin = time.Second
+
+// the time sources have to page through results. It runs out a little before the search does, so sources
+// still have time to send a MoreResults marker and the search can continue from where they stopped.
+func WithTimeBudget(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-TimeBudgetMargin))
+}
+
+// whether a source stopped because its time budget ran out, while the search itself is still going
+func OutOfTime(ctx context.Context, budget context.Context) bool {
+	return budget.Err() != nil && ctx.Err() == nil
+}
+
+// a continuation token, bundling the page tokens of all sources that have more results
+func (r Result) Continuation() string {
+	if r.Status != ResultMoreAvailable {
+		return ""
+	}
+	c, _ := r.Details["continuation"].(string)
+	return c
+}
+
+// how many results a source should fetch
+func (q Query) Limit() int {
+	if q.MaxResults <= 0 {
+		return DefaultMaxResults
+	}
+	return q.MaxResults
+}
+
+// whether the query is continuing a previous search
+func (q Query) IsContinuation() bool {
+	return q.PageTokens != nil
+}
+
+// the page token a source should continue from. When continuing a search, sources without a token
+// had no more results, so they shouldn't be searched again.
+func (q Query) PageToken(account AccountData, source string) (token string, ok bool) {
+	if !q.IsContinuation() {
+		return "", true
+	}
+
+	token, ok = q.PageTokens[PageKey(account, source)]
+	return token, ok
+}
+
+func EncodeContinuation(pageTokens map[string]string) string {
+	d, _ := json.Marshal(pageTokens)
+	return base64.RawURLEncoding.EncodeToString(d)
+}
+
+func ParseContinuation(continuation string) (map[string]string, error) {
+	d, err := base64.RawURLEncoding.DecodeString(continuation)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid continuation")
+	}
+
+	res := map[string]string{}
+	if err := json.Unmarshal(d, &res); err != nil {
+		return nil, errors.Wrap(err, "invalid continuation")
+	}
+	return res, nil
+}
@@ -0,0 +1,169 @@
+package cloudsearch
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the profile kept right on the storage path, as before there were profiles
+const DefaultProfile = "default"
+
+var profileName = regexp.MustCompile(`^[\w-]+$`)
+
+// where a profile keeps its accounts, cache, config and logs
+func ProfilePath(storagePath string, profile string) (string, error) {
+	if profile == "" || profile == DefaultProfile {
+		return storagePath, nil
+	}
+	if !profileName.MatchString(profile) {
+		return "", errors.New("profile names can only have letters, numbers, _ and -")
+	}
+
+	path := filepath.Join(storagePath, "profiles", profile)
+	if _, err := os.Stat(path); err != nil {
+		return "", errors.New("no profile named " + profile + " - use 'cloudsearch profiles create " + profile + "' to create it")
+	}
+	return path, nil
+}
+
+// every profile, starting w/ the default one
+func ListProfiles(storagePath string) ([]string, error) {
+	res := []string{DefaultProfile}
+
+	dirs, err := ioutil.ReadDir(filepath.Join(storagePath, "profiles"))
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+
+	names := []string{}
+	for _, d := range dirs {
+		if d.IsDir() && profileName.MatchString(d.Name()) {
+			names = append(names, d.Name())
+		}
+	}
+	sort.Strings(names)
+	return append(res, names...), nil
+}
+
+func CreateProfile(storagePath string, profile string) error {
+	if profile == DefaultProfile || !profileName.MatchString(profile) {
+		return errors.New("invalid profile name: " + profile)
+	}
+	if _, err := ProfilePath(storagePath, profile); err == nil {
+		return errors.New("the profile already exists: " + profile)
+	}
+	return os.MkdirAll(filepath.Join(storagePath, "profiles", profile), 0700)
+}
+
+// remove a profile and everything on it
+func DeleteProfile(storagePath string, profile string) error {
+	if profile == "" || profile == DefaultProfile {
+		return errors.New("the default profile can't be deleted")
+	}
+	path, err := ProfilePath(storagePath, profile)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+// anything that can be searched (eg an engine, or the engines for every profile)
+type Searcher interface {
+	Search(query Query, ctx context.Context) <-chan Result
+	Facets(query Query) (Facets, error)
+	CountCached(query Query, counter *FacetCounter) error
+	Close()
+}
+
+// searches the engines for several profiles at once
+type ProfilesSearch struct {
+	Engines map[string]*SearchEngine // by profile name
+}
+
+// results from every profile. Page tokens are kept by account and source, so a single continuation works for
+// all of them.
+func (p *ProfilesSearch) Search(query Query, ctx context.Context) <-chan Result {
+	results := make(chan Result)
+
+	lock := sync.Mutex{}
+	pageTokens := map[string]string{}
+	var wg sync.WaitGroup
+	for name, e := range p.Engines {
+		wg.Add(1)
+		go func(name string, e *SearchEngine) {
+			defer wg.Done()
+
+			for r := range e.Search(query, ctx) {
+				if r.Status != ResultMoreAvailable {
+					results <- r
+					continue
+				}
+
+				pages, err := ParseContinuation(r.Continuation())
+				if err != nil {
+					logrus.Error("Couldn't continue the search on ", name, ": ", err)
+					continue
+				}
+				lock.Lock()
+				for k, v := range pages {
+					pageTokens[k] = v
+				}
+				lock.Unlock()
+			}
+		}(name, e)
+	}
+
+	go func() {
+		wg.Wait()
+		if len(pageTokens) > 0 && ctx.Err() == nil {
+			results <- Result{
+				Status: ResultMoreAvailable,
+				Details: map[string]interface{}{
+					"continuation": EncodeContinuation(pageTokens),
+				},
+			}
+		}
+		close(results)
+	}()
+
+	return results
+}
+
+// each profile has its own cache, so counts add up
+func (p *ProfilesSearch) Facets(query Query) (Facets, error) {
+	res := Facets{}
+	for name, e := range p.Engines {
+		f, err := e.Facets(query)
+		if err != nil {
+			return res, errors.Wrap(err, name)
+		}
+		res = res.Add(f)
+	}
+	return res, nil
+}
+
+func (p *ProfilesSearch) CountCached(query Query, counter *FacetCounter) error {
+	for name, e := range p.Engines {
+		if err := e.CountCached(query, counter); err != nil {
+			return errors.Wrap(err, name)
+		}
+	}
+	return nil
+}
+
+func (p *ProfilesSearch) Close() {
+	for _, e := range p.Engines {
+		e.Close()
+	}
+}
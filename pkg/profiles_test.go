@@ -0,0 +1,158 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudsearch-profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if path, err := cloudsearch.ProfilePath(dir, cloudsearch.DefaultProfile); err != nil || path != dir {
+		t.Fatal("Should keep the default profile on the storage path: ", path, err)
+	}
+	if _, err := cloudsearch.ProfilePath(dir, "work"); err == nil {
+		t.Fatal("Should not use profiles that weren't created")
+	}
+
+	for _, p := range []string{"work", "personal"} {
+		if err := cloudsearch.CreateProfile(dir, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cloudsearch.CreateProfile(dir, "work"); err == nil {
+		t.Fatal("Should not create a profile twice")
+	}
+	for _, p := range []string{cloudsearch.DefaultProfile, "../work", ""} {
+		if err := cloudsearch.CreateProfile(dir, p); err == nil {
+			t.Fatal("Should not create invalid profiles: ", p)
+		}
+	}
+
+	profiles, err := cloudsearch.ListProfiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(profiles, []string{cloudsearch.DefaultProfile, "personal", "work"}) {
+		t.Fatal("Should list every profile: ", profiles)
+	}
+
+	path, err := cloudsearch.ProfilePath(dir, "work")
+	if err != nil || path != filepath.Join(dir, "profiles", "work") {
+		t.Fatal("Should keep profiles apart: ", path, err)
+	}
+
+	if err := cloudsearch.DeleteProfile(dir, cloudsearch.DefaultProfile); err == nil {
+		t.Fatal("Should not delete the default profile")
+	}
+	if err := cloudsearch.DeleteProfile(dir, "work"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("Should remove everything on the profile: ", err)
+	}
+	if profiles, _ := cloudsearch.ListProfiles(dir); len(profiles) != 2 {
+		t.Fatal("Should not list deleted profiles: ", profiles)
+	}
+}
+
+func pagedEngine(accountId string) *cloudsearch.SearchEngine {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: accountId, AccountType: cloudsearch.Dropbox, Active: true},
+	)
+
+	builder := func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{
+			func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+				res := make(chan cloudsearch.Result, 2)
+				if token, _ := query.PageToken(a, "static"); token != "" {
+					res <- cloudsearch.Result{Title: token, OriginalId: token}
+				} else {
+					res <- cloudsearch.Result{Title: a.ID, OriginalId: a.ID}
+					res <- cloudsearch.MoreResults(a, "static", "next_"+a.ID)
+				}
+				close(res)
+				return res
+			},
+		}, []string{"static"}, nil
+	}
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Dropbox, builder, nil)
+
+	return cloudsearch.NewMultiSearch(cloudsearch.Env{}, accounts, nil, reg, func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+		return []cloudsearch.ResultFilter{}
+	})
+}
+
+func TestProfilesSearch(t *testing.T) {
+	search := &cloudsearch.ProfilesSearch{Engines: map[string]*cloudsearch.SearchEngine{
+		"work":     pagedEngine("a"),
+		"personal": pagedEngine("b"),
+	}}
+	defer search.Close()
+
+	found := map[string]bool{}
+	markers := []cloudsearch.Result{}
+	for r := range search.Search(cloudsearch.Query{Text: "foo"}, context.Background()) {
+		if r.Status == cloudsearch.ResultMoreAvailable {
+			markers = append(markers, r)
+		} else {
+			found[r.Title] = true
+		}
+	}
+
+	if !found["a"] || !found["b"] || len(markers) != 1 {
+		t.Fatal("Should search every profile, w/ a single continuation: ", found, markers)
+	}
+
+	pages, err := cloudsearch.ParseContinuation(markers[0].Continuation())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the next page continues each profile where it stopped
+	next := map[string]bool{}
+	for r := range search.Search(cloudsearch.Query{Text: "foo", PageTokens: pages}, context.Background()) {
+		if r.Status == cloudsearch.ResultMoreAvailable {
+			t.Fatal("Should not have more results: ", r)
+		}
+		next[r.Title] = true
+	}
+	if !next["next_a"] || !next["next_b"] || len(next) != 2 {
+		t.Fatal("Should continue every profile: ", next)
+	}
+}
+
+func TestProfilesFacets(t *testing.T) {
+	cached := func(accountId string) *cloudsearch.SearchEngine {
+		r := cloudsearch.Result{AccountId: accountId, AccountType: cloudsearch.Dropbox, ContentType: cloudsearch.File, OriginalId: "1"}
+		r.SetId()
+		return cloudsearch.NewMultiSearch(cloudsearch.Env{}, test.NewAccountsStorage(), test.NewResultsStorage(r), test.DefaultRegistry(), func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+			return []cloudsearch.ResultFilter{}
+		})
+	}
+	search := &cloudsearch.ProfilesSearch{Engines: map[string]*cloudsearch.SearchEngine{
+		"work":     cached("a"),
+		"personal": cached("b"),
+	}}
+	defer search.Close()
+
+	f, err := search.Facets(cloudsearch.Query{Text: "foo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Get(cloudsearch.FacetType, "File") != 2 || f.Get(cloudsearch.FacetAccount, "a") != 1 || f.Get(cloudsearch.FacetAccount, "b") != 1 {
+		t.Fatal("Should sum the counts of every profile: ", f)
+	}
+}
@@ -27,15 +27,26 @@ func init() {
 }
 
 type Query struct {
-	RawText      string
-	SearchMode   SearchMode
-	Text         string // query without tokens
-	Before       *time.Time
-	After        *time.Time
-	AccountTypes []AccountType
-	ContentTypes []ContentType
-	MaxResults   int
-	SearchId     string
+	RawText         string
+	SearchMode      SearchMode
+	Text            string // query without tokens
+	Before          *time.Time
+	After           *time.Time
+	AccountTypes    []AccountType
+	AccountIds      []string // only search these accounts (eg account:<id>)
+	ContentTypes    []ContentType
+	MaxResults      int
+	SearchId        string
+	PageTokens      map[string]string // when continuing a search, the page each source should continue from
+	Filters         []string          // filters enabled for this query only (eg filter:redact)
+	DisabledFilters []string          // filters disabled for this query only (eg nofilter:group)
+	From            []string          // sender addresses (eg from:foo@bar.com)
+	To              []string          // recipient addresses (eg to:foo@bar.com)
+	Owners          []string          // eg owner:foo@bar.com
+	Extensions      []string          // file extensions, w/o the dot (eg ext:pdf)
+	MinSize         *int64            // in bytes (eg size>10MB)
+	MaxSize         *int64            // in bytes (eg size<1MB)
+	Unread          bool              // only unread results (eg is:unread)
 	// TODO search mode
 	// TODO involving
 	// TODO status (favorited)
@@ -49,6 +60,15 @@ var serviceQuery2 = regexp.MustCompile(`\b@\[(service):([\w]+)\]`)
 var modeQuery = regexp.MustCompile(`\b(mode):([\w]+)`)
 var typeQuery = regexp.MustCompile(`\b(type):([\w]+)`)
 var typeQuery2 = regexp.MustCompile(`\b@\[(type):([\w]+)\]`)
+var accountQuery = regexp.MustCompile(`\b(account):([\w-]+)`)
+var filterQuery = regexp.MustCompile(`\b(filter):([\w]+)`)
+var noFilterQuery = regexp.MustCompile(`\b(nofilter):([\w]+)`)
+var fromQuery = regexp.MustCompile(`\b(from):([^\s]+)`)
+var toQuery = regexp.MustCompile(`\b(to):([^\s]+)`)
+var ownerQuery = regexp.MustCompile(`\b(owner):([^\s]+)`)
+var extQuery = regexp.MustCompile(`\b(ext):\.?([\w]+)`)
+var sizeQuery = regexp.MustCompile(`\bsize([<>])([\d.]+[a-zA-Z]*)`)
+var unreadQuery = regexp.MustCompile(`\bis:unread\b`)
 
 func ParseQuery(q string, searchId string, r *Registry) Query {
 	stripped := q
@@ -60,23 +80,49 @@ func ParseQuery(q string, searchId string, r *Registry) Query {
 	if len(m) == 0 {
 		m = []string{string(All)}
 	}
+	acc, stripped := parseAccounts(accountQuery, stripped)
+	f, stripped := parseFilters(filterQuery, r, stripped)
+	nf, stripped := parseFilters(noFilterQuery, r, stripped)
+	from, stripped := parseValues(fromQuery, stripped)
+	to, stripped := parseValues(toQuery, stripped)
+	owners, stripped := parseValues(ownerQuery, stripped)
+	exts, stripped := parseValues(extQuery, stripped)
+	minSize, maxSize, stripped := parseSizes(sizeQuery, stripped)
+	unread := unreadQuery.MatchString(stripped)
+	stripped = unreadQuery.ReplaceAllString(stripped, "")
 	b, stripped := parseTime(beforeQuery, stripped)
 	a, stripped := parseTime(afterQuery, stripped)
 	stripped = strings.TrimSpace(stripped)
 
 	return Query{
-		RawText:      q,
-		Text:         stripped,
-		AccountTypes: accountTypes(concat(s, s2)),
-		ContentTypes: contentTypes(concat(c, c2)),
-		Before:       b,
-		After:        a,
-		MaxResults:   100,
-		SearchMode:   SearchMode(m[0]),
-		SearchId:     searchId,
+		RawText:         q,
+		Text:            stripped,
+		AccountTypes:    accountTypes(concat(s, s2)),
+		AccountIds:      acc,
+		ContentTypes:    contentTypes(concat(c, c2)),
+		Before:          b,
+		After:           a,
+		MaxResults:      DefaultMaxResults,
+		SearchMode:      SearchMode(m[0]),
+		SearchId:        searchId,
+		Filters:         f,
+		DisabledFilters: nf,
+		From:            from,
+		To:              to,
+		Owners:          owners,
+		Extensions:      exts,
+		MinSize:         minSize,
+		MaxSize:         maxSize,
+		Unread:          unread,
 	}
 }
 
+// whether the query narrows results down by any of their fields (eg from: or size>)
+func (q Query) HasFieldFilters() bool {
+	return len(q.From) > 0 || len(q.To) > 0 || len(q.Owners) > 0 || len(q.Extensions) > 0 ||
+		q.MinSize != nil || q.MaxSize != nil || q.Unread
+}
+
 func CanHandle(query Query, accountType AccountType, contentTypes []ContentType) bool {
 	return (len(query.AccountTypes) == 0 || accountTypeIncluded(query.AccountTypes, accountType)) &&
 		(len(query.ContentTypes) == 0 || ContainsAnyType(query.ContentTypes, contentTypes))
@@ -120,6 +166,52 @@ func parseEnumItems(regex *regexp.Regexp, supported []string, q string) ([]strin
 	return res, regex.ReplaceAllString(q, "")
 }
 
+func parseAccounts(regex *regexp.Regexp, q string) ([]string, string) {
+	var res []string
+	for _, m := range regex.FindAllStringSubmatch(q, -1) {
+		res = append(res, m[2])
+	}
+	return res, regex.ReplaceAllString(q, "")
+}
+
+func parseFilters(regex *regexp.Regexp, r *Registry, q string) ([]string, string) {
+	res := []string{}
+
+	t := regex.FindAllStringSubmatch(q, -1)
+	for _, m := range t {
+		if name, ok := r.parseFilterName(m[2]); ok {
+			res = append(res, name)
+		}
+	}
+
+	return res, regex.ReplaceAllString(q, "")
+}
+
+// values are matched case-insensitively, so they're kept lowercased
+func parseValues(regex *regexp.Regexp, q string) ([]string, string) {
+	var res []string
+	for _, m := range regex.FindAllStringSubmatch(q, -1) {
+		res = append(res, strings.ToLower(m[2]))
+	}
+	return res, regex.ReplaceAllString(q, "")
+}
+
+func parseSizes(regex *regexp.Regexp, q string) (*int64, *int64, string) {
+	var min, max *int64
+	for _, m := range regex.FindAllStringSubmatch(q, -1) {
+		s, err := ParseSize(m[2])
+		if err != nil {
+			continue
+		}
+		if m[1] == ">" {
+			min = &s
+		} else {
+			max = &s
+		}
+	}
+	return min, max, regex.ReplaceAllString(q, "")
+}
+
 func parseTime(regex *regexp.Regexp, q string) (*time.Time, string) {
 	t := regex.FindAllStringSubmatch(q, 1)
 	if len(t) > 0 {
@@ -40,3 +40,22 @@ func TestParser(t *testing.T) {
 	}
 
 }
+
+func TestFieldParser(t *testing.T) {
+	parsed := cloudsearch.ParseQuery("report from:Foo@bar.com to:baz@bar.com owner:me@bar.com ext:.PDF size>1MB size<2.5MB is:unread", "1", test.DefaultRegistry())
+
+	if parsed.Text != "report" {
+		t.Fatal(parsed.Text)
+	}
+	if !reflect.DeepEqual(parsed.From, []string{"foo@bar.com"}) || !reflect.DeepEqual(parsed.To, []string{"baz@bar.com"}) ||
+		!reflect.DeepEqual(parsed.Owners, []string{"me@bar.com"}) || !reflect.DeepEqual(parsed.Extensions, []string{"pdf"}) {
+		t.Fatal(parsed)
+	}
+	if parsed.MinSize == nil || *parsed.MinSize != 1<<20 || parsed.MaxSize == nil || *parsed.MaxSize != 5<<19 || !parsed.Unread {
+		t.Fatal(parsed)
+	}
+
+	if cloudsearch.ParseQuery("report", "1", test.DefaultRegistry()).HasFieldFilters() {
+		t.Fatal("Should not filter on fields w/o field macros")
+	}
+}
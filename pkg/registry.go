@@ -9,10 +9,13 @@ import (
 type Registry struct {
     searchables map[AccountType]SearchableBuilder
     authorizers map[AccountType]AuthBuilder
+    verifiers   map[AccountType]VerifierBuilder
 
     // using a map to keep them unique
     accountTypes map[AccountType]interface{}
     contentTypes map[ContentType]interface{}
+
+    filters map[string]registeredFilter
 }
 
 func NewRegistry() *Registry {
@@ -20,7 +23,9 @@ func NewRegistry() *Registry {
         accountTypes: map[AccountType]interface{}{},
         searchables:  map[AccountType]SearchableBuilder{},
         authorizers:  map[AccountType]AuthBuilder{},
+        verifiers:    map[AccountType]VerifierBuilder{},
         contentTypes: map[ContentType]interface{}{},
+        filters:      map[string]registeredFilter{},
     }
 }
 
@@ -54,7 +59,10 @@ func (r *Registry) SearchBuilder(account AccountData) (fetchFns []SearchFunc, id
         return nil, nil, errors.New("No search builder found for type: " + string(account.AccountType))
     }
 
-    return b(account)
+    // only the sources on the account's settings are searched
+    fetchFns, ids, err = b(account)
+    fetchFns, ids = account.Settings.apply(fetchFns, ids)
+    return fetchFns, ids, err
 }
 
 func (r *Registry) AuthBuilder(accountType AccountType) (IdentityService, error) {
@@ -66,6 +74,21 @@ func (r *Registry) AuthBuilder(accountType AccountType) (IdentityService, error)
     return b(accountType)
 }
 
+// services that can check whether cached results still exist
+func (r *Registry) RegisterVerifier(acc AccountType, verifierBuilder VerifierBuilder) {
+    r.verifiers[acc] = verifierBuilder
+}
+
+// the verifier for an account, or nil if its service doesn't have one
+func (r *Registry) Verifier(account AccountData) (Verifier, error) {
+    b, ok := r.verifiers[account.AccountType]
+    if !ok {
+        return nil, nil
+    }
+
+    return b(account)
+}
+
 func (r *Registry) IsAccountTypeSupported(accountType AccountType) bool {
     _, ok := r.searchables[accountType]
     return ok
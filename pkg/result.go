@@ -1,7 +1,12 @@
 package cloudsearch
 
 import (
+	"context"
 	"fmt"
+	"mime"
+	"net/mail"
+	"path"
+	"strings"
 	"time"
 )
 
@@ -12,6 +17,7 @@ const (
 	ResultFound ResultStatus = iota
 	ResultNotFound
 	ResultError
+	ResultMoreAvailable // a marker for sources w/ more results than returned (see MoreResults)
 )
 
 type Result struct {
@@ -27,15 +33,77 @@ type Result struct {
 	OriginalId    string
 	Body          string
 	CachedAt      time.Time
+	LastOpened    time.Time
 	Labels        []string
 	InvolvesMe    bool // little hack to differentiate involves:anyone from involves:me
 	Status        ResultStatus
 	Unread        bool
-	CacheHitScore float64 `json:"-"` // a transient hit score of the result, based on relevance on cache _only_
-	Favorited     bool               // this flag is saved on a different table, so it's most likely always "false" on the results storage
+	CacheHitScore float64     `json:"-"` // a transient hit score of the result, based on relevance on cache _only_
+	Favorited     bool        // this flag is saved on a different table, so it's most likely always "false" on the results storage
+	Hydrate       HydrateFunc `json:"-"`          // set on partially loaded results (eg metadata only), fetches the full content
+	Members       []Result    `json:",omitempty"` // other results collapsed into this one (eg messages on the same thread)
+	Siblings      []string    `json:",omitempty"` // ids of the same content found on other services
+	Updated       []Result    `json:"-"`          // results already emitted that changed along w/ this one (eg its siblings), to be emitted again
+	Snippet       *Snippet    `json:",omitempty"` // where the result matched the query
 	// TODO involved
 }
 
+// how many results this one represents, including the ones collapsed into it
+func (r *Result) MemberCount() int {
+	return len(r.Members) + 1
+}
+
+// sizes come as int64 from services, but float64 once they've been cached as json
+func (r *Result) SizeBytes() int64 {
+	switch s := r.Details["sizeBytes"].(type) {
+	case int64:
+		return s
+	case int:
+		return int64(s)
+	case float64:
+		return int64(s)
+	}
+	return 0
+}
+
+// the addresses on a list of recipients on the result's details (eg "Foo <foo@bar.com>, baz@bar.com")
+func (r *Result) Addresses(name string) []string {
+	list, _ := r.Details[name].(string)
+	if list == "" {
+		return nil
+	}
+
+	parsed, err := mail.ParseAddressList(list)
+	if err != nil {
+		// not every header is well-formed, so just take what's there
+		res := []string{}
+		for _, a := range strings.Split(list, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				res = append(res, a)
+			}
+		}
+		return res
+	}
+
+	res := make([]string, len(parsed))
+	for i, a := range parsed {
+		res[i] = a.Address
+	}
+	return res
+}
+
+// the file extension, from the path or title (eg "pdf")
+func (r *Result) Extension() string {
+	p, _ := r.Details["path"].(string)
+	if p == "" {
+		p = r.Title
+	}
+	return strings.TrimPrefix(path.Ext(p), ".")
+}
+
+// lazily load the full content of a partial result
+type HydrateFunc func(ctx context.Context) (Result, error)
+
 func FileOrFolderResult(
 	originalId string,
 	path string,
@@ -54,18 +122,29 @@ func FileOrFolderResult(
 ) Result {
 	klass := kindFor(isDir, mimeType, extension, path)
 
+	var r Result
 	switch klass {
 	case Image:
-		return ImageResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
+		r = ImageResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
 	case Video:
-		return VideoResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
+		r = VideoResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
 	case Document:
-		return DocumentResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
+		r = DocumentResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
 	case Folder:
-		return FolderResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
+		r = FolderResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
 	default:
-		return BasicFileResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
+		r = BasicFileResult(originalId, path, title, timestamp, permalink, body, account, sizeBytes, thumbnail, involvesMe, labels)
+	}
+
+	// not every service tells us the mime type, so guess it from the extension
+	if mimeType == "" && extension != "" {
+		mimeType = mime.TypeByExtension("." + strings.TrimPrefix(extension, "."))
 	}
+	if mimeType != "" {
+		r.Details["mimeType"] = mimeType
+	}
+
+	return r
 }
 
 func FolderResult(originalId string, path string, title string, timestamp time.Time, permalink string, body string, accountData AccountData, sizeBytes int64, thumbnail string, involvesMe bool, labels []string) Result {
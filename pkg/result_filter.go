@@ -2,13 +2,15 @@ package cloudsearch
 
 import (
 	"github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
 	"sync"
 	"time"
 )
 
 type ResultFilter func(Query, Result) *Result
 
-func Dedup(query Query) func(query Query, in Result) *Result {
+func Dedup(query Query) ResultFilter {
 	logrus.Debug("Setting up dedup for ", query)
 	lock := sync.RWMutex{}
 	alreadyPosted := map[string]bool{}
@@ -65,6 +67,45 @@ func FilterContent(query Query, in Result) *Result {
 	}
 }
 
+func FilterAccounts(query Query, in Result) *Result {
+	if len(query.AccountIds) == 0 || StringsContain(query.AccountIds, in.AccountId) {
+		return &in
+	}
+	logrus.Debug("Filtering by account: ", in.Id)
+	return nil
+}
+
+// drop results that don't match the query's fields (eg from: or size>)
+func FilterFields(query Query, in Result) *Result {
+	if !query.HasFieldFilters() {
+		return &in
+	}
+
+	owner, _ := in.Details["owner"].(string)
+	size := in.SizeBytes()
+	if (len(query.From) > 0 && !anyEqualFold(query.From, in.Addresses("from"))) ||
+		(len(query.To) > 0 && !anyEqualFold(query.To, in.Addresses("to"))) ||
+		(len(query.Owners) > 0 && !anyEqualFold(query.Owners, []string{owner})) ||
+		(len(query.Extensions) > 0 && !anyEqualFold(query.Extensions, []string{in.Extension()})) ||
+		(query.MinSize != nil && size <= *query.MinSize) ||
+		(query.MaxSize != nil && size >= *query.MaxSize) ||
+		(query.Unread && !in.Unread) {
+		logrus.Debug("Filtering by fields: ", in.Id)
+		return nil
+	}
+	return &in
+}
+
+func anyEqualFold(wanted []string, values []string) bool {
+	for _, w := range wanted {
+		for _, v := range values {
+			if strings.EqualFold(w, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
 
 func SetId(query Query, in Result) *Result {
 	if in.Id == "" {
@@ -73,6 +114,34 @@ func SetId(query Query, in Result) *Result {
 	return &in
 }
 
+var emailAddress = regexp.MustCompile(`[\w.+-]+@[\w-]+\.[\w.-]+`)
+var longNumber = regexp.MustCompile(`\b(?:\d[ -]?){9,}\d\b`) // phone, card and account numbers
+
+// mask email addresses and long numbers on the result's contents
+func Redact(query Query, in Result) *Result {
+	in.Title = redact(in.Title)
+	in.Body = redact(in.Body)
+	in.Snippet = nil // highlighted again on the redacted content
+
+	if len(in.Details) > 0 {
+		details := map[string]interface{}{}
+		for k, v := range in.Details {
+			if s, ok := v.(string); ok {
+				v = redact(s)
+			}
+			details[k] = v
+		}
+		in.Details = details
+	}
+
+	return &in
+}
+
+func redact(s string) string {
+	s = emailAddress.ReplaceAllString(s, "[redacted]")
+	return longNumber.ReplaceAllString(s, "[redacted]")
+}
+
 func typesInclude(types []ContentType, t ContentType) bool {
 	for _, tt := range types {
 		if t == tt {
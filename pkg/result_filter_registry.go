@@ -0,0 +1,129 @@
+package cloudsearch
+
+import (
+	"sort"
+	"strings"
+)
+
+// builds a filter for a single search, so filters can keep state (eg dedup) for the duration of it
+type FilterBuilder func(q Query) ResultFilter
+
+// filters run in ascending order. Filters that drop results should run before the ones rewriting
+// or grouping them, so there's less work to do down the line.
+const (
+	FilterOrderPrepare   = 0   // eg setting ids
+	FilterOrderExclude   = 100 // dropping results that shouldn't be shown
+	FilterOrderDedup     = 200
+	FilterOrderRewrite   = 300 // eg redacting content
+	FilterOrderHighlight = 350 // after rewrites, so snippets don't show content that got rewritten
+	FilterOrderGroup     = 400
+)
+
+type registeredFilter struct {
+	name      string
+	order     int
+	builder   FilterBuilder
+	byDefault bool
+	required  bool
+}
+
+// register a named filter. Filters enabled by default run on every search, unless disabled by config or query
+// options - the others only run when enabled.
+func (r *Registry) RegisterFilter(name string, order int, enabledByDefault bool, builder FilterBuilder) {
+	r.filters[name] = registeredFilter{
+		name:      name,
+		order:     order,
+		builder:   builder,
+		byDefault: enabledByDefault,
+	}
+}
+
+// register a filter that always runs and can't be disabled (eg for privacy rules)
+func (r *Registry) RegisterRequiredFilter(name string, order int, builder FilterBuilder) {
+	r.filters[name] = registeredFilter{
+		name:      name,
+		order:     order,
+		builder:   builder,
+		byDefault: true,
+		required:  true,
+	}
+}
+
+func (r *Registry) SupportedFilters() []string {
+	res := []string{}
+	for n := range r.filters {
+		res = append(res, n)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// build the filter pipeline for a query, given the filters enabled or disabled by config. Query options
+// (eg filter:redact or nofilter:dedup) take precedence over the config.
+func (r *Registry) FilterPipeline(enabled []string, disabled []string) func(q Query) []ResultFilter {
+	return func(q Query) []ResultFilter {
+		active := []registeredFilter{}
+		for _, f := range r.filters {
+			on := f.byDefault
+			if StringsContain(enabled, f.name) || StringsContain(q.Filters, f.name) {
+				on = true
+			}
+			if StringsContain(disabled, f.name) && !StringsContain(q.Filters, f.name) {
+				on = false
+			}
+			if StringsContain(q.DisabledFilters, f.name) {
+				on = false
+			}
+			if f.required {
+				on = true
+			}
+
+			if on {
+				active = append(active, f)
+			}
+		}
+
+		// stable ordering, even for filters w/ the same order
+		sort.Slice(active, func(i, j int) bool {
+			if active[i].order == active[j].order {
+				return active[i].name < active[j].name
+			}
+			return active[i].order < active[j].order
+		})
+
+		res := []ResultFilter{}
+		for _, f := range active {
+			res = append(res, f.builder(q))
+		}
+		return res
+	}
+}
+
+// filter names aren't case sensitive on queries
+func (r *Registry) parseFilterName(name string) (string, bool) {
+	for n := range r.filters {
+		if strings.EqualFold(n, name) {
+			return n, true
+		}
+	}
+	return "", false
+}
+
+// the default pipeline, as it was before filters were configurable
+func (r *Registry) RegisterDefaultFilters() {
+	r.RegisterFilter("setId", FilterOrderPrepare, true, Stateless(SetId)) // no better place to set this ugh
+	r.RegisterFilter("range", FilterOrderExclude, true, Stateless(FilterNotInRange))
+	r.RegisterFilter("content", FilterOrderExclude, true, Stateless(FilterContent))
+	r.RegisterFilter("accounts", FilterOrderExclude, true, Stateless(FilterAccounts))
+	r.RegisterFilter("fields", FilterOrderExclude, true, Stateless(FilterFields))
+	r.RegisterFilter("dedup", FilterOrderDedup, true, Dedup)
+	r.RegisterFilter("highlight", FilterOrderHighlight, true, Stateless(SetSnippet))
+	r.RegisterFilter("group", FilterOrderGroup, true, Group)
+}
+
+// a builder for filters that don't need any state
+func Stateless(f ResultFilter) FilterBuilder {
+	return func(q Query) ResultFilter {
+		return f
+	}
+}
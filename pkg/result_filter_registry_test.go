@@ -0,0 +1,144 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+// a filter appending its name to the title, to check which filters ran and in what order
+func tag(name string) cloudsearch.FilterBuilder {
+	return cloudsearch.Stateless(func(q cloudsearch.Query, in cloudsearch.Result) *cloudsearch.Result {
+		in.Title += name
+		return &in
+	})
+}
+
+func taggingRegistry() *cloudsearch.Registry {
+	reg := test.DefaultRegistry()
+	reg.RegisterFilter("c", cloudsearch.FilterOrderRewrite, true, tag("c"))
+	reg.RegisterFilter("a", cloudsearch.FilterOrderExclude, true, tag("a"))
+	reg.RegisterFilter("b", cloudsearch.FilterOrderExclude, true, tag("b"))
+	reg.RegisterFilter("d", cloudsearch.FilterOrderRewrite, false, tag("d"))
+	return reg
+}
+
+func apply(filters []cloudsearch.ResultFilter, q cloudsearch.Query, r cloudsearch.Result) *cloudsearch.Result {
+	c := &r
+	for _, f := range filters {
+		c = f(q, *c)
+		if c == nil {
+			return nil
+		}
+	}
+	return c
+}
+
+func TestFiltersRunInOrder(t *testing.T) {
+	pipeline := taggingRegistry().FilterPipeline(nil, nil)
+	q := cloudsearch.Query{}
+
+	r := apply(pipeline(q), q, cloudsearch.Result{OriginalId: "1"})
+	if r == nil || r.Title != "abc" {
+		t.Fatal("Should run the default filters in order: ", r)
+	}
+}
+
+func TestFiltersEnabledByConfigAndQuery(t *testing.T) {
+	reg := taggingRegistry()
+
+	pipeline := reg.FilterPipeline([]string{"d"}, []string{"a"})
+	q := cloudsearch.Query{}
+	if r := apply(pipeline(q), q, cloudsearch.Result{OriginalId: "1"}); r.Title != "bcd" {
+		t.Fatal("Should use the configured filters: ", r.Title)
+	}
+
+	q = cloudsearch.ParseQuery("foo filter:A nofilter:c", "1", reg)
+	if q.Text != "foo" {
+		t.Fatal("Should strip the filter options from the query: ", q.Text)
+	}
+	if r := apply(pipeline(q), q, cloudsearch.Result{OriginalId: "1"}); r.Title != "abd" {
+		t.Fatal("Should let query options override the config: ", r.Title)
+	}
+}
+
+func TestEngineComposesFilters(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "a", AccountType: cloudsearch.Dropbox, Active: true},
+	)
+	reg := taggingRegistry()
+	reg.RegisterAccountType(cloudsearch.Dropbox, func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{staticSearch("x")}, []string{"static"}, nil
+	}, nil)
+
+	e := cloudsearch.NewMultiSearch(cloudsearch.Env{}, accounts, nil, reg, reg.FilterPipeline(nil, nil))
+
+	res := []cloudsearch.Result{}
+	for r := range e.Search(cloudsearch.Query{Text: "foo"}, context.Background()) {
+		res = append(res, r)
+	}
+
+	if len(res) != 1 || res[0].Title != "xabc" {
+		t.Fatal("Should apply every filter on top of the previous one: ", res)
+	}
+}
+
+func TestExcludeLabels(t *testing.T) {
+	f := cloudsearch.ExclusionRules{Labels: []string{"SPAM", "TRASH"}}.Filter
+
+	if f(cloudsearch.Query{}, cloudsearch.Result{Labels: []string{"INBOX", "SPAM"}}) != nil {
+		t.Fatal("Should drop results w/ excluded labels")
+	}
+	if f(cloudsearch.Query{}, cloudsearch.Result{Labels: []string{"INBOX"}}) == nil {
+		t.Fatal("Should keep other results")
+	}
+}
+
+func TestExcludePaths(t *testing.T) {
+	rules := cloudsearch.ExclusionRules{Paths: []string{"/HR"}}
+	rules.Compile()
+	f := rules.Filter
+
+	if f(cloudsearch.Query{}, cloudsearch.Result{Details: map[string]interface{}{"path": "/hr/salaries.xls"}}) != nil {
+		t.Fatal("Should drop results under excluded paths")
+	}
+	if f(cloudsearch.Query{}, cloudsearch.Result{Details: map[string]interface{}{"path": "/docs/hr.doc"}}) == nil {
+		t.Fatal("Should keep other results")
+	}
+}
+
+func TestFilterFields(t *testing.T) {
+	reg := test.DefaultRegistry()
+	email := cloudsearch.Result{Unread: true, Details: map[string]interface{}{"from": "Foo <foo@bar.com>"}}
+	file := cloudsearch.Result{Title: "q1.pdf", Details: map[string]interface{}{"sizeBytes": int64(2048), "owner": "me@bar.com"}}
+
+	for q, expected := range map[string][]bool{ // whether the email and the file are kept
+		"foo":                   {true, true},
+		"foo from:FOO@bar.com":  {true, false},
+		"foo owner:me@bar.com":  {false, true},
+		"foo ext:pdf size>1KB":  {false, true},
+		"foo ext:pdf size<1KB":  {false, false},
+		"foo is:unread":         {true, false},
+		"foo to:nobody@bar.com": {false, false},
+	} {
+		query := cloudsearch.ParseQuery(q, "1", reg)
+		kept := []bool{cloudsearch.FilterFields(query, email) != nil, cloudsearch.FilterFields(query, file) != nil}
+		if kept[0] != expected[0] || kept[1] != expected[1] {
+			t.Fatal("Should filter on fields for ", q, ": ", kept)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	r := cloudsearch.Redact(cloudsearch.Query{}, cloudsearch.Result{
+		Title:   "mail from foo@bar.com",
+		Body:    "card 4111 1111 1111 1111 exp 12/20",
+		Details: map[string]interface{}{"from": "Foo <foo@bar.com>", "labels": []string{"INBOX"}},
+	})
+
+	if r.Title != "mail from [redacted]" || r.Body != "card [redacted] exp 12/20" || r.Details["from"] != "Foo <[redacted]>" {
+		t.Fatal("Should redact emails and long numbers: ", r)
+	}
+}
@@ -0,0 +1,118 @@
+package cloudsearch
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// collapse results representing the same thing (eg messages on the same thread, or copies of the same file)
+// into a single one. Whenever a result joins a group, the updated group leader is emitted again (with the same Id),
+// so consumers should replace results they already have.
+//
+// The same content found on different services isn't collapsed, but linked to each other as siblings. Siblings found
+// earlier are emitted again too (on the result's Updated), w/ the link to the new one.
+func Group(query Query) ResultFilter {
+	lock := sync.Mutex{}
+	groups := map[string]*Result{}
+	siblings := map[string][]*Result{}
+
+	return func(query Query, in Result) *Result {
+		if in.Status != ResultFound {
+			return &in
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		key := groupKey(in)
+		if key != "" {
+			if leader, ok := groups[key]; ok {
+				logrus.Debug("Grouping ", in.Id, " into ", leader.Id)
+				leader.Members = append(leader.Members, in)
+				return leader.copy()
+			}
+		}
+
+		res := &in
+		updated := []Result{}
+		skey := siblingKey(in)
+		if skey != "" {
+			for _, s := range siblings[skey] {
+				if s.AccountType != in.AccountType {
+					s.Siblings = append(s.Siblings, in.Id)
+					res.Siblings = append(res.Siblings, s.Id)
+					updated = append(updated, *s.copy())
+				}
+			}
+			siblings[skey] = append(siblings[skey], res)
+		}
+
+		if key != "" {
+			groups[key] = res
+		}
+
+		c := res.copy()
+		if len(updated) > 0 {
+			c.Updated = updated
+		}
+		return c
+	}
+}
+
+// results are reused by the grouping, so hand out copies that won't change under the consumers' feet
+func (r *Result) copy() *Result {
+	c := *r
+	c.Members = append([]Result{}, r.Members...)
+	c.Siblings = append([]string{}, r.Siblings...)
+	c.Updated = nil
+	if len(c.Members) == 0 {
+		c.Members = nil
+	}
+	if len(c.Siblings) == 0 {
+		c.Siblings = nil
+	}
+	return &c
+}
+
+// results w/ the same key on the same account are collapsed together
+func groupKey(r Result) string {
+	switch {
+	case r.ContentType == Email:
+		thread := detail(r, "threadId")
+		if thread != "" {
+			return fmt.Sprintf("thread_%s_%s", r.AccountId, thread)
+		}
+	case ContainsType(FileTypes, r.ContentType) && r.ContentType != Folder:
+		hash := detail(r, "hash")
+		if hash != "" {
+			return fmt.Sprintf("file_%s_%s_%d_%s", r.AccountId, strings.ToLower(r.Title), r.SizeBytes(), hash)
+		}
+	}
+	return ""
+}
+
+// the same file across services - hashes aren't comparable between them, so go by name and size
+func siblingKey(r Result) string {
+	if !ContainsType(FileTypes, r.ContentType) || r.ContentType == Folder {
+		return ""
+	}
+
+	size := r.SizeBytes()
+	if size <= 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s_%d", strings.ToLower(path.Base(r.Title)), size)
+}
+
+func detail(r Result, name string) string {
+	if r.Details == nil {
+		return ""
+	}
+	s, _ := r.Details[name].(string)
+	return s
+}
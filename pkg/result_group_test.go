@@ -0,0 +1,126 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+func message(id string, thread string) cloudsearch.Result {
+	r := cloudsearch.Result{
+		AccountId:   "1",
+		AccountType: cloudsearch.Google,
+		OriginalId:  id,
+		Title:       "msg " + id,
+		ContentType: cloudsearch.Email,
+		Details:     map[string]interface{}{"threadId": thread},
+	}
+	r.SetId()
+	return r
+}
+
+func file(id string, account cloudsearch.AccountType, name string, size int64, hash string) cloudsearch.Result {
+	r := cloudsearch.Result{
+		AccountId:   string(account),
+		AccountType: account,
+		OriginalId:  id,
+		Title:       name,
+		ContentType: cloudsearch.Document,
+		Details:     map[string]interface{}{"sizeBytes": size, "hash": hash},
+	}
+	r.SetId()
+	return r
+}
+
+func TestGroupsThreads(t *testing.T) {
+	group := cloudsearch.Group(cloudsearch.Query{})
+
+	first := group(cloudsearch.Query{}, message("1", "t1"))
+	if first == nil || first.MemberCount() != 1 {
+		t.Fatal("Should pass the first message along: ", first)
+	}
+
+	other := group(cloudsearch.Query{}, message("2", "t2"))
+	if other == nil || other.Id == first.Id {
+		t.Fatal("Should not group messages on different threads: ", other)
+	}
+
+	updated := group(cloudsearch.Query{}, message("3", "t1"))
+	if updated == nil || updated.Id != first.Id || updated.MemberCount() != 2 || updated.Members[0].OriginalId != "3" {
+		t.Fatal("Should re-emit the thread w/ the new member: ", updated)
+	}
+
+	if first.MemberCount() != 1 {
+		t.Fatal("Should not change results already emitted: ", first)
+	}
+}
+
+func TestGroupsCopiesOfTheSameFile(t *testing.T) {
+	group := cloudsearch.Group(cloudsearch.Query{})
+
+	a := group(cloudsearch.Query{}, file("a", cloudsearch.Google, "report.pdf", 100, "abc"))
+	b := group(cloudsearch.Query{}, file("b", cloudsearch.Google, "report.pdf", 100, "abc"))
+	if b.Id != a.Id || b.MemberCount() != 2 {
+		t.Fatal("Should collapse copies of the same file: ", b)
+	}
+
+	c := group(cloudsearch.Query{}, file("c", cloudsearch.Google, "report.pdf", 100, "def"))
+	if c.Id == a.Id {
+		t.Fatal("Should not collapse files w/ different contents: ", c)
+	}
+}
+
+func TestCrossServiceDuplicatesAreSiblings(t *testing.T) {
+	group := cloudsearch.Group(cloudsearch.Query{})
+
+	drive := group(cloudsearch.Query{}, file("a", cloudsearch.Google, "report.pdf", 100, "abc"))
+	dropbox := group(cloudsearch.Query{}, file("b", cloudsearch.Dropbox, "report.pdf", 100, "xyz"))
+
+	if dropbox.Id == drive.Id || dropbox.MemberCount() != 1 {
+		t.Fatal("Should not collapse results from different services: ", dropbox)
+	}
+
+	if len(dropbox.Siblings) != 1 || dropbox.Siblings[0] != drive.Id {
+		t.Fatal("Should link the duplicates as siblings: ", dropbox.Siblings)
+	}
+	if len(dropbox.Updated) != 1 || dropbox.Updated[0].Id != drive.Id ||
+		len(dropbox.Updated[0].Siblings) != 1 || dropbox.Updated[0].Siblings[0] != dropbox.Id {
+		t.Fatal("Should emit the earlier sibling again, linked to the new one: ", dropbox.Updated)
+	}
+}
+
+func TestEngineEmitsUpdatedSiblings(t *testing.T) {
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: string(cloudsearch.Google), AccountType: cloudsearch.Google, Active: true},
+		cloudsearch.AccountData{ID: string(cloudsearch.Dropbox), AccountType: cloudsearch.Dropbox, Active: true},
+	)
+	builder := func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
+		return []cloudsearch.SearchFunc{
+			func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+				res := make(chan cloudsearch.Result, 1)
+				res <- file("f", a.AccountType, "report.pdf", 100, "")
+				close(res)
+				return res
+			},
+		}, []string{"static"}, nil
+	}
+	reg := test.DefaultRegistry()
+	reg.RegisterAccountType(cloudsearch.Google, builder, nil)
+	reg.RegisterAccountType(cloudsearch.Dropbox, builder, nil)
+
+	e := cloudsearch.NewMultiSearch(cloudsearch.Env{}, accounts, nil, reg, func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+		return []cloudsearch.ResultFilter{cloudsearch.Group(q)}
+	})
+
+	results, _ := cloudsearch.Collect(e.Search(cloudsearch.Query{Text: "report"}, context.Background()), nil)
+	if len(results) != 2 {
+		t.Fatal("Should find both copies: ", results)
+	}
+	for _, r := range results {
+		if len(r.Siblings) != 1 || r.Siblings[0] == r.Id || len(r.Updated) > 0 {
+			t.Fatal("Should link both copies to each other: ", r.Id, r.Siblings)
+		}
+	}
+}
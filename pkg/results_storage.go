@@ -7,13 +7,21 @@ type ResultsStorage interface {
 	Save(result Result) (Result, error)  // fully override a result
 	Merge(result Result) (Result, error) // save a result, merging data such as favorite status if it's set
 	Search(query Query) ([]Result, error)
+	Matching(query Query) (<-chan Result, error) // every result matching the query, not only the best ones
 	Get(resultId string) (*Result, error)
+	MarkOpened(resultId string, at time.Time) error // only changes when it was last opened, keeping its cache time
 
+	All() (<-chan Result, error)
 	FindOlderThan(maxTime time.Time) (<-chan Result, error)
+	FindCachedBefore(maxTime time.Time) (<-chan Result, error) // results that haven't been refreshed since
 	DeleteAllFromAccount(accountId string) ([]string, error)
 	Delete(resultId string) error
 
+	Size() (int64, error) // in bytes
+	Compact() error       // reclaim space left behind by removed results
+
 	AllFavorited() ([]Result, error)
+	AllFavoritedIds() ([]string, error)
 	IsFavorite(resultId string) (bool, error)
 	ToggleFavorite(resultId string) (bool, error)
 }
@@ -0,0 +1,270 @@
+package cloudsearch
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// how long results are kept on the cache, by account and/or content type. Empty fields match anything.
+type RetentionRule struct {
+	AccountId   string
+	ContentType ContentType
+	MaxAge      time.Duration // by the result's timestamp. Zero keeps results forever.
+}
+
+func (r RetentionRule) matches(res Result) bool {
+	return (r.AccountId == "" || r.AccountId == res.AccountId) &&
+		(r.ContentType == "" || r.ContentType == res.ContentType)
+}
+
+// the more fields set, the more specific - an account's rule wins over a content type's
+func (r RetentionRule) specificity() int {
+	s := 0
+	if r.AccountId != "" {
+		s += 2
+	}
+	if r.ContentType != "" {
+		s += 1
+	}
+	return s
+}
+
+// what's kept on the cache. Favorited results are always kept.
+type RetentionPolicy struct {
+	Rules   []RetentionRule
+	MaxSize int64 // in bytes - the least recently used results are evicted past it. Zero means no limit.
+}
+
+func (p RetentionPolicy) IsEmpty() bool {
+	return len(p.Rules) == 0 && p.MaxSize == 0
+}
+
+// how long a result is kept, by the most specific rule matching it. Zero means forever.
+func (p RetentionPolicy) MaxAge(r Result) time.Duration {
+	var rule *RetentionRule
+	for i, rr := range p.Rules {
+		if rr.matches(r) && (rule == nil || rr.specificity() > rule.specificity()) {
+			rule = &p.Rules[i]
+		}
+	}
+	if rule == nil {
+		return 0
+	}
+	return rule.MaxAge
+}
+
+func (p RetentionPolicy) IsExpired(r Result, now time.Time) bool {
+	maxAge := p.MaxAge(r)
+	return !r.Favorited && maxAge > 0 && !r.Timestamp.IsZero() && now.Sub(r.Timestamp) > maxAge
+}
+
+// nothing expires before this. Zero if nothing expires at all.
+func (p RetentionPolicy) Shortest() time.Duration {
+	var res time.Duration
+	for _, r := range p.Rules {
+		if r.MaxAge > 0 && (res == 0 || r.MaxAge < res) {
+			res = r.MaxAge
+		}
+	}
+	return res
+}
+
+// when a result was last seen on a search or opened, whichever is later
+func LastUsed(r Result) time.Time {
+	if r.LastOpened.After(r.CachedAt) {
+		return r.LastOpened
+	}
+	return r.CachedAt
+}
+
+type CacheStats struct {
+	Results   int                 `json:"results"`
+	Favorited int                 `json:"favorited"`
+	SizeBytes int64               `json:"sizeBytes"`
+	ByAccount map[string]int      `json:"byAccount"`
+	ByType    map[ContentType]int `json:"byType"`
+	Oldest    time.Time           `json:"oldest"` // by timestamp
+	Newest    time.Time           `json:"newest"`
+}
+
+func GetCacheStats(results ResultsStorage) (CacheStats, error) {
+	stats := CacheStats{
+		ByAccount: map[string]int{},
+		ByType:    map[ContentType]int{},
+	}
+
+	size, err := results.Size()
+	if err != nil {
+		return stats, errors.Wrap(err, "measuring the cache")
+	}
+	stats.SizeBytes = size
+
+	all, err := results.All()
+	if err != nil {
+		return stats, errors.Wrap(err, "listing cached results")
+	}
+	for r := range all {
+		stats.Results += 1
+		stats.ByAccount[r.AccountId] += 1
+		stats.ByType[r.ContentType] += 1
+		if r.Favorited {
+			stats.Favorited += 1
+		}
+		if !r.Timestamp.IsZero() {
+			if stats.Oldest.IsZero() || r.Timestamp.Before(stats.Oldest) {
+				stats.Oldest = r.Timestamp
+			}
+			if r.Timestamp.After(stats.Newest) {
+				stats.Newest = r.Timestamp
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+type PruneStats struct {
+	Expired    int   `json:"expired"`
+	Orphaned   int   `json:"orphaned"` // from accounts that were removed
+	Evicted    int   `json:"evicted"`  // to get the cache under its max size
+	SizeBefore int64 `json:"sizeBefore"`
+	SizeAfter  int64 `json:"sizeAfter"`
+}
+
+func (s PruneStats) Removed() int {
+	return s.Expired + s.Orphaned + s.Evicted
+}
+
+// remove expired results and results from removed accounts, then evict the least recently used ones until
+// the cache fits its max size. The cache is compacted when anything gets removed.
+func Prune(results ResultsStorage, accounts AccountsStorage, policy RetentionPolicy, now time.Time) (PruneStats, error) {
+	stats := PruneStats{}
+
+	size, err := results.Size()
+	if err != nil {
+		return stats, errors.Wrap(err, "measuring the cache")
+	}
+	stats.SizeBefore = size
+	stats.SizeAfter = size
+
+	favorites := map[string]bool{}
+	favs, err := results.AllFavoritedIds()
+	if err != nil {
+		return stats, errors.Wrap(err, "listing favorites")
+	}
+	for _, id := range favs {
+		favorites[id] = true
+	}
+
+	removed := map[string]bool{}
+
+	// expired results
+	if shortest := policy.Shortest(); shortest > 0 {
+		old, err := results.FindOlderThan(now.Add(-shortest))
+		if err != nil {
+			return stats, errors.Wrap(err, "listing old results")
+		}
+
+		// don't delete while iterating, as that shifts the pages under the iterator
+		expired := []string{}
+		for r := range old {
+			if !favorites[r.Id] && policy.IsExpired(r, now) {
+				expired = append(expired, r.Id)
+			}
+		}
+		for _, id := range expired {
+			logrus.Debug("Removing expired result: ", id)
+			if err := results.Delete(id); err != nil {
+				return stats, errors.Wrap(err, "removing "+id)
+			}
+			removed[id] = true
+			stats.Expired += 1
+		}
+	}
+
+	// results from accounts that don't exist anymore
+	accts, err := accounts.All()
+	if err != nil {
+		return stats, errors.Wrap(err, "listing accounts")
+	}
+	existing := map[string]bool{}
+	for _, a := range accts {
+		existing[a.ID] = true
+	}
+
+	all, err := results.All()
+	if err != nil {
+		return stats, errors.Wrap(err, "listing cached results")
+	}
+	count := 0
+	orphans := map[string]bool{}
+	candidates := []Result{}
+	for r := range all {
+		if removed[r.Id] {
+			continue
+		}
+		count += 1
+		if !existing[r.AccountId] {
+			orphans[r.AccountId] = true
+		} else if !favorites[r.Id] {
+			candidates = append(candidates, r)
+		}
+	}
+	for id := range orphans {
+		ids, err := results.DeleteAllFromAccount(id)
+		if err != nil {
+			return stats, errors.Wrap(err, "removing results from "+id)
+		}
+		logrus.Debug("Removed results from removed account ", id, ": ", len(ids))
+		stats.Orphaned += len(ids)
+		count -= len(ids)
+	}
+
+	if stats.Removed() > 0 {
+		if stats.SizeAfter, err = compact(results); err != nil {
+			return stats, err
+		}
+	}
+
+	// least recently used results, until it fits
+	if policy.MaxSize > 0 && stats.SizeAfter > policy.MaxSize && count > 0 {
+		perResult := stats.SizeAfter / int64(count)
+		if perResult <= 0 {
+			perResult = 1
+		}
+		n := int((stats.SizeAfter - policy.MaxSize + perResult - 1) / perResult)
+
+		sort.Slice(candidates, func(i, j int) bool {
+			return LastUsed(candidates[i]).Before(LastUsed(candidates[j]))
+		})
+		for _, r := range candidates {
+			if stats.Evicted >= n {
+				break
+			}
+			logrus.Debug("Evicting result: ", r.Id)
+			if err := results.Delete(r.Id); err != nil {
+				return stats, errors.Wrap(err, "evicting "+r.Id)
+			}
+			stats.Evicted += 1
+		}
+
+		if stats.Evicted > 0 {
+			if stats.SizeAfter, err = compact(results); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// reclaim space from removed results, returning the new size
+func compact(results ResultsStorage) (int64, error) {
+	if err := results.Compact(); err != nil {
+		return 0, errors.Wrap(err, "compacting the cache")
+	}
+	return results.Size()
+}
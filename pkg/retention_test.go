@@ -0,0 +1,107 @@
+package cloudsearch_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+const day = 24 * time.Hour
+
+func TestRetentionMaxAge(t *testing.T) {
+	p := cloudsearch.RetentionPolicy{
+		Rules: []cloudsearch.RetentionRule{
+			{MaxAge: 30 * day},
+			{ContentType: cloudsearch.Email, MaxAge: 365 * day},
+			{AccountId: "work", MaxAge: 90 * day},
+			{AccountId: "work", ContentType: cloudsearch.Email},
+		},
+	}
+
+	cases := []struct {
+		result   cloudsearch.Result
+		expected time.Duration
+	}{
+		{cloudsearch.Result{AccountId: "home", ContentType: cloudsearch.File}, 30 * day},
+		{cloudsearch.Result{AccountId: "home", ContentType: cloudsearch.Email}, 365 * day},
+		{cloudsearch.Result{AccountId: "work", ContentType: cloudsearch.File}, 90 * day},
+		{cloudsearch.Result{AccountId: "work", ContentType: cloudsearch.Email}, 0},
+	}
+	for _, c := range cases {
+		if m := p.MaxAge(c.result); m != c.expected {
+			t.Fatal("Should use the most specific rule for ", c.result.AccountId, c.result.ContentType, ": ", m)
+		}
+	}
+
+	if p.Shortest() != 30*day {
+		t.Fatal("Should find the shortest max age: ", p.Shortest())
+	}
+
+	old := cloudsearch.Result{AccountId: "home", ContentType: cloudsearch.File, Timestamp: time.Now().Add(-60 * day)}
+	if !p.IsExpired(old, time.Now()) {
+		t.Fatal("Should expire old results")
+	}
+	old.Favorited = true
+	if p.IsExpired(old, time.Now()) {
+		t.Fatal("Should keep favorited results forever")
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	results := test.NewResultsStorage(
+		cloudsearch.Result{Id: "expired", AccountId: "1", ContentType: cloudsearch.Email, Timestamp: now.Add(-400 * day), CachedAt: now},
+		cloudsearch.Result{Id: "favorite", AccountId: "1", ContentType: cloudsearch.Email, Timestamp: now.Add(-400 * day), Favorited: true},
+		cloudsearch.Result{Id: "orphan", AccountId: "2", ContentType: cloudsearch.File, Timestamp: now, CachedAt: now},
+		cloudsearch.Result{Id: "unused", AccountId: "1", ContentType: cloudsearch.File, Timestamp: now, CachedAt: now.Add(-10 * day)},
+		cloudsearch.Result{Id: "opened", AccountId: "1", ContentType: cloudsearch.File, Timestamp: now, CachedAt: now.Add(-20 * day), LastOpened: now},
+		cloudsearch.Result{Id: "recent", AccountId: "1", ContentType: cloudsearch.File, Timestamp: now, CachedAt: now.Add(-day)},
+	)
+	results.ResultSize = 10
+	accounts := test.NewAccountsStorage(cloudsearch.AccountData{ID: "1"})
+
+	policy := cloudsearch.RetentionPolicy{
+		Rules:   []cloudsearch.RetentionRule{{ContentType: cloudsearch.Email, MaxAge: 365 * day}},
+		MaxSize: 30,
+	}
+	stats, err := cloudsearch.Prune(results, accounts, policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Expired != 1 || stats.Orphaned != 1 || stats.Evicted != 1 {
+		t.Fatal("Should remove expired, orphaned and least recently used results: ", stats)
+	}
+	if stats.SizeBefore != 60 || stats.SizeAfter != 30 {
+		t.Fatal("Should get the cache under its max size: ", stats)
+	}
+	if results.Compactions == 0 {
+		t.Fatal("Should compact the cache")
+	}
+
+	for _, id := range []string{"expired", "orphan", "unused"} {
+		if r, _ := results.Get(id); r != nil {
+			t.Fatal("Should remove ", id)
+		}
+	}
+	for _, id := range []string{"favorite", "opened", "recent"} {
+		if r, _ := results.Get(id); r == nil {
+			t.Fatal("Should keep ", id)
+		}
+	}
+}
+
+func TestPruneWithNothingToRemove(t *testing.T) {
+	results := test.NewResultsStorage(cloudsearch.Result{Id: "1", AccountId: "1", Timestamp: time.Now()})
+	accounts := test.NewAccountsStorage(cloudsearch.AccountData{ID: "1"})
+
+	stats, err := cloudsearch.Prune(results, accounts, cloudsearch.RetentionPolicy{}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Removed() != 0 || results.Compactions != 0 {
+		t.Fatal("Should leave the cache alone: ", stats, results.Compactions)
+	}
+}
@@ -0,0 +1,104 @@
+package cloudsearch
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// searches kept by name, on the storage path
+const SavedSearchesFileName = "searches.json"
+
+type SavedSearch struct {
+	Name  string `json:"name"`
+	Query string `json:"query"` // as typed, macros included
+}
+
+// the searches saved on a storage path, sorted by name
+type SavedSearches struct {
+	StoragePath string
+}
+
+func (s SavedSearches) All() ([]SavedSearch, error) {
+	res := []SavedSearch{}
+
+	data, err := ioutil.ReadFile(FileAt(s.StoragePath, SavedSearchesFileName))
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return res, err
+	}
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return res, errors.Wrap(err, "invalid "+SavedSearchesFileName)
+	}
+	return res, nil
+}
+
+func (s SavedSearches) Get(name string) (*SavedSearch, error) {
+	all, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range all {
+		if a.Name == name {
+			return &a, nil
+		}
+	}
+	return nil, nil
+}
+
+// add a search, replacing the one w/ the same name
+func (s SavedSearches) Save(search SavedSearch) error {
+	if !profileName.MatchString(search.Name) {
+		return errors.New("search names can only have letters, numbers, _ and -")
+	}
+	if strings.TrimSpace(search.Query) == "" {
+		return errors.New("the search for " + search.Name + " is empty")
+	}
+
+	all, err := s.All()
+	if err != nil {
+		return err
+	}
+	res := []SavedSearch{search}
+	for _, a := range all {
+		if a.Name != search.Name {
+			res = append(res, a)
+		}
+	}
+	return s.write(res)
+}
+
+func (s SavedSearches) Delete(name string) error {
+	all, err := s.All()
+	if err != nil {
+		return err
+	}
+	res := []SavedSearch{}
+	for _, a := range all {
+		if a.Name != name {
+			res = append(res, a)
+		}
+	}
+	if len(res) == len(all) {
+		return errors.New("no search named " + name)
+	}
+	return s.write(res)
+}
+
+func (s SavedSearches) write(all []SavedSearch) error {
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Name < all[j].Name
+	})
+	data, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(FileAt(s.StoragePath, SavedSearchesFileName), data, 0600)
+}
@@ -0,0 +1,48 @@
+package cloudsearch_test
+
+import (
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+)
+
+func TestSavedSearches(t *testing.T) {
+	s := cloudsearch.SavedSearches{StoragePath: t.TempDir()}
+
+	if all, err := s.All(); err != nil || len(all) != 0 {
+		t.Fatal("Should start w/o searches: ", all, err)
+	}
+
+	for _, q := range []cloudsearch.SavedSearch{
+		{Name: "reports", Query: "report"},
+		{Name: "invoices", Query: "invoice type:Email"},
+		{Name: "reports", Query: "report type:Document"},
+	} {
+		if err := s.Save(q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, q := range []cloudsearch.SavedSearch{{Name: "../foo", Query: "foo"}, {Name: "empty", Query: " "}} {
+		if err := s.Save(q); err == nil {
+			t.Fatal("Should not save invalid searches: ", q)
+		}
+	}
+
+	all, _ := s.All()
+	if len(all) != 2 || all[0].Name != "invoices" || all[1].Query != "report type:Document" {
+		t.Fatal("Should keep a single search per name, sorted: ", all)
+	}
+	if r, _ := s.Get("reports"); r == nil || r.Query != "report type:Document" {
+		t.Fatal("Should get searches by name: ", r)
+	}
+
+	if err := s.Delete("reports"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("reports"); err == nil {
+		t.Fatal("Should not delete searches that don't exist")
+	}
+	if r, _ := s.Get("reports"); r != nil {
+		t.Fatal("Should delete searches: ", r)
+	}
+}
@@ -2,34 +2,39 @@ package bleve_test
 
 import (
 	"context"
-	bl "github.com/blevesearch/bleve"
 	"github.com/herval/cloudsearch/pkg"
 	"github.com/herval/cloudsearch/pkg/search/bleve"
+	"github.com/herval/cloudsearch/pkg/secrets"
 	bl1 "github.com/herval/cloudsearch/pkg/storage/bleve"
+	"io/ioutil"
 	"log"
+	"os"
 	"reflect"
-	"strconv"
 	"testing"
 	"time"
 )
 
 var savedResults []cloudsearch.Result
-var index bl.Index
 var ts time.Time
 var searchable cloudsearch.SearchFunc
 
 func TestMain(m *testing.M) {
-	env := cloudsearch.Env{
-		StoragePath: "./",
-	}
 	dropb := cloudsearch.AccountData{
 		ID:          "123",
 		Token:       "dropboxtoken",
 		AccountType: cloudsearch.Dropbox,
 	}
 
-	var err error
-	index, err = bl1.NewIndex(env.StoragePath, strconv.Itoa(int(time.Now().Unix())))
+	dir, err := ioutil.TempDir("", "cloudsearch")
+	if err != nil {
+		log.Fatal(err)
+	}
+	key, _ := secrets.RandomKey()
+	c, err := secrets.NewCipher(key)
+	if err != nil {
+		log.Fatal(err)
+	}
+	storage, err := bl1.OpenResultStorage(dir, c)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -69,7 +74,6 @@ func TestMain(m *testing.M) {
 		},
 	}
 
-	storage := bl1.NewBleveResultStorage(index)
 	for i, r := range savedResults {
 		savedResults[i], err = storage.Save(r)
 		if err != nil {
@@ -79,7 +83,19 @@ func TestMain(m *testing.M) {
 
 	searchable = bleve.NewIndexedResultsSearchable(storage)
 
-	m.Run()
+	code := m.Run()
+	storage.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// hit scores and snippets depend on the query, so they aren't part of the saved result. Timestamps lose
+// their location once serialized.
+func saved(r cloudsearch.Result) cloudsearch.Result {
+	r.CacheHitScore = 0
+	r.Snippet = nil
+	r.CachedAt = r.CachedAt.UTC()
+	return r
 }
 
 func TestSearchAllFilters(t *testing.T) {
@@ -94,7 +110,7 @@ func TestSearchAllFilters(t *testing.T) {
 	}, context.TODO())
 
 	r := <-res
-	if !reflect.DeepEqual(r, savedResults[0]) {
+	if !reflect.DeepEqual(saved(r), saved(savedResults[0])) {
 		t.Fatal("Did not deserialize correctly:\n", r, "vs\n", savedResults[0])
 	}
 }
@@ -122,7 +138,7 @@ func TestHtmlTokenizing(t *testing.T) {
 	}, context.TODO())
 
 	r := <-res
-	if !reflect.DeepEqual(r, savedResults[2]) {
+	if !reflect.DeepEqual(saved(r), saved(savedResults[2])) {
 		t.Fatal("Did not deserialize correctly:\n", r, "vs\n", savedResults[2])
 	}
 }
@@ -133,7 +149,19 @@ func TestSlashes(t *testing.T) {
 	}, context.TODO())
 
 	r := <-res
-	if !reflect.DeepEqual(r, savedResults[2]) {
+	if !reflect.DeepEqual(saved(r), saved(savedResults[2])) {
 		t.Fatal("Did not deserialize correctly:\n", r, "vs\n", savedResults[2])
 	}
 }
+
+// fuzzy matches get highlighted too
+func TestHighlighting(t *testing.T) {
+	res := searchable(cloudsearch.Query{
+		Text: "boz",
+	}, context.TODO())
+
+	r := <-res
+	if r.Snippet == nil || r.Snippet.Field != "Body" || r.Snippet.Mark("[", "]") != "bar <b>[baz]</b>[boz] foo/[bor]/[boz]" {
+		t.Fatal("Should highlight the matches: ", r.Snippet)
+	}
+}
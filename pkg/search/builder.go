@@ -9,26 +9,40 @@ import (
 func NewCachedSearchableBuilder(
 	results cloudsearch.ResultsStorage,
 	remotes cloudsearch.SearchableBuilder,
+	policy cloudsearch.CachePolicy,
+	verifiers cloudsearch.VerifierBuilder,
 ) cloudsearch.SearchableBuilder {
 	return func(a cloudsearch.AccountData) ([]cloudsearch.SearchFunc, []string, error) {
 		search, ids, err := remotes(a)
 		if err != nil {
+			// cached results are still searchable, even if the remote service isn't
 			logrus.Error("Could not setup a remote searchable for ", a.ID, " - ", err)
 			search = []cloudsearch.SearchFunc{
 				cloudsearch.NoopSearchable(),
 			}
+			ids = []string{cloudsearch.CacheSource}
+		}
+
+		// stale results get checked against the service, if it supports it
+		p := policy
+		if verifiers != nil {
+			v, verr := verifiers(a)
+			if verr != nil {
+				logrus.Error("Could not setup a verifier for ", a.ID, " - ", verr)
+			}
+			p.Verify = v
 		}
 
 		// support cached results
 		cached := []cloudsearch.SearchFunc{}
 		for i, c := range search {
 			cs := bleve.NewIndexedResultsSearchable(results)
-			ca := cloudsearch.NewCachedSearchable(ids[i], results, cs, c, a.AccountType)
+			ca := cloudsearch.NewCachedSearchable(ids[i], results, cs, c, a, p)
 			cached = append(cached, ca)
 		}
 		search = cached
 
-		return search, ids, nil
+		return search, ids, err
 	}
 }
 
@@ -42,9 +56,15 @@ func Builder(name string, search func(cloudsearch.AccountData) cloudsearch.Searc
 }
 
 
-func WithCaching(s cloudsearch.SearchableBuilder, enableCaching bool, results cloudsearch.ResultsStorage) cloudsearch.SearchableBuilder {
+func WithCaching(
+	s cloudsearch.SearchableBuilder,
+	enableCaching bool,
+	results cloudsearch.ResultsStorage,
+	policy cloudsearch.CachePolicy,
+	verifiers cloudsearch.VerifierBuilder,
+) cloudsearch.SearchableBuilder {
 	if enableCaching {
-		return NewCachedSearchableBuilder(results, s)
+		return NewCachedSearchableBuilder(results, s, policy, verifiers)
 	}
 	return s
 }
\ No newline at end of file
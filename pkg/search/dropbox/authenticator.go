@@ -1,27 +1,55 @@
 package dropbox
 
 import (
+	"context"
+	"net/http"
+
 	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/httpclient"
 	"github.com/herval/dropbox-sdk-go-unofficial/dropbox"
 	"github.com/herval/dropbox-sdk-go-unofficial/dropbox/users"
+	"golang.org/x/oauth2"
 )
 
-func NewAuthenticator() cloudsearch.IdentityService {
+func NewAuthenticator(
+	authService cloudsearch.OAuth2Authenticator,
+	accounts cloudsearch.AccountsStorage,
+	localRedirectUrl string,
+) cloudsearch.IdentityService {
 	return &DropboxAuth{
+		oauth2:           authService,
+		accounts:         accounts,
+		localRedirectUrl: localRedirectUrl,
 	}
 }
 
 type DropboxAuth struct {
+	oauth2           cloudsearch.OAuth2Authenticator
+	accounts         cloudsearch.AccountsStorage
+	localRedirectUrl string
 }
 
+// access tokens are short-lived now, but older accounts have long-lived ones (w/o an expiry) that are kept as they are
 func (d *DropboxAuth) RefreshAccountIfNeeded(a cloudsearch.AccountData) (acc cloudsearch.AccountData, accountChanged bool, err error) {
-	return a, false, nil
+	account, shouldSave, err := d.oauth2.RefreshTokenIfNeeded(a, d.localRedirectUrl)
+	if err != nil {
+		return a, false, err
+	}
+	if shouldSave {
+		err = d.accounts.Save(&account)
+		if err != nil {
+			return a, false, err
+		}
+	}
+
+	return account, shouldSave, err
 }
 
 func (d *DropboxAuth) FetchIdentityInfo(data cloudsearch.AccountData) (*cloudsearch.AccountData, error) {
 	c := dropbox.Config{
 		Token:    data.Token,
 		LogLevel: dropbox.LogOff,
+		Client:   NewHttpClient(data),
 	}
 	acc, err := users.New(c).GetCurrentAccount()
 	if err != nil {
@@ -35,3 +63,12 @@ func (d *DropboxAuth) FetchIdentityInfo(data cloudsearch.AccountData) (*cloudsea
 
 	return &data, nil
 }
+
+// an authenticated client for Dropbox's API, throttling and retrying requests
+func NewHttpClient(a cloudsearch.AccountData) *http.Client {
+	conf := &oauth2.Config{Endpoint: dropbox.OAuthEndpoint("")}
+	tok := &oauth2.Token{AccessToken: a.Token}
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpclient.NewClient(a.ID, httpclient.DefaultOptions))
+	return conf.Client(ctx, tok)
+}
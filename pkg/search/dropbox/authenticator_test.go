@@ -0,0 +1,44 @@
+package dropbox_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/search/dropbox"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+// refreshes tokens about to expire
+type fakeOAuth struct {
+	cloudsearch.OAuth2Authenticator
+}
+
+func (f fakeOAuth) RefreshTokenIfNeeded(a cloudsearch.AccountData, redirectUrl string) (cloudsearch.AccountData, bool, error) {
+	if !a.ShouldReauth() {
+		return a, false, nil
+	}
+	a.Token = "refreshed"
+	a.Expiry = time.Now().Add(4 * time.Hour)
+	return a, true, nil
+}
+
+func TestRefresh(t *testing.T) {
+	accounts := test.NewAccountsStorage()
+	auth := dropbox.NewAuthenticator(fakeOAuth{}, accounts, "")
+
+	expiring := cloudsearch.AccountData{ID: "1", Token: "token", RefreshToken: "refresh", Expiry: time.Now().Add(time.Minute)}
+	acc, changed, err := auth.RefreshAccountIfNeeded(expiring)
+	if err != nil || !changed || acc.Token != "refreshed" {
+		t.Fatal("Should refresh expiring tokens ", err, acc)
+	}
+	if saved := accounts.Get("1"); saved.Token != "refreshed" {
+		t.Fatal("Should save the new token ", saved)
+	}
+
+	// long-lived tokens, from before Dropbox expired them
+	legacy := cloudsearch.AccountData{ID: "2", Token: "token"}
+	if acc, changed, err := auth.RefreshAccountIfNeeded(legacy); err != nil || changed || acc.Token != "token" {
+		t.Fatal("Should keep tokens w/o an expiry ", err, acc)
+	}
+}
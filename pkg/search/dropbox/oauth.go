@@ -0,0 +1,25 @@
+package dropbox
+
+import (
+	"github.com/herval/cloudsearch/pkg/auth"
+	"golang.org/x/oauth2"
+)
+
+// the SDK's endpoints are still the v1 ones
+var OAuthEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://www.dropbox.com/oauth2/authorize",
+	TokenURL: "https://api.dropboxapi.com/oauth2/token",
+}
+
+// for talking to Dropbox's OAuth2 endpoints directly, w/ an app from the Dropbox App Console
+func OAuthProvider(clientId string, clientSecret string) auth.Provider {
+	return auth.Provider{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Endpoint:     OAuthEndpoint,
+		// access tokens only last a few hours, so a refresh token is needed too
+		Params: map[string]string{
+			"token_access_type": "offline",
+		},
+	}
+}
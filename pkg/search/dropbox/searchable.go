@@ -8,6 +8,7 @@ import (
 	"github.com/herval/dropbox-sdk-go-unofficial/dropbox/files"
 	"github.com/sirupsen/logrus"
 	"path"
+	"strconv"
 	"time"
 )
 
@@ -15,9 +16,10 @@ func NewSearch(account cloudsearch.AccountData) cloudsearch.SearchFunc {
 	c := dropbox.Config{
 		Token:    account.Token,
 		LogLevel: dropbox.LogOff,
+		Client:   NewHttpClient(account),
 	}
 	db := files.New(c)
-	db.HttpClient().Timeout = time.Second * 2
+	db.HttpClient().Timeout = time.Second * 10 // covers retries on throttled requests as well
 
 	s := searchable{
 		db:      db,
@@ -40,17 +42,46 @@ func (s *searchable) SearchSnippets(query cloudsearch.Query, ctx context.Context
 		return out
 	}
 
+	pageToken, ok := query.PageToken(s.account, "dropbox")
+	if !ok {
+		close(out)
+		return out
+	}
+	start, _ := strconv.ParseUint(pageToken, 10, 64)
+
 	go func() {
 		defer close(out)
-		res, err := s.search(query.Text)
-		if err != nil {
-			logrus.Trace("Error searching:", err)
-			return
-		} else {
+		budget, cancel := cloudsearch.WithTimeBudget(ctx)
+		defer cancel()
+
+		// page through results until we have enough of them, or time runs out
+		remaining := uint64(query.Limit())
+		for remaining > 0 {
+			res, more, next, err := s.searchWithin(budget, query.Text, start, remaining)
+			if cloudsearch.OutOfTime(ctx, budget) {
+				break // the page that was cut short is fetched again on the next one
+			}
+			if err != nil {
+				logrus.Trace("Error searching:", err)
+				cloudsearch.ReportError(ctx, "dropbox", err)
+				return
+			}
+
 			for _, r := range s.toResults(res) {
+				if ctx.Err() != nil {
+					return
+				}
 				out <- r
 			}
+
+			if !more || next <= start {
+				return
+			}
+			remaining -= min(next-start, remaining)
+			start = next
 		}
+
+		out <- cloudsearch.MoreResults(s.account, "dropbox", strconv.FormatUint(start, 10))
 	}()
 
 	return out
@@ -79,17 +110,42 @@ func (s *searchable) toResults(contents []Content) []cloudsearch.Result {
 			[]string{},
 			e.IsDir,
 		)
+		res[i].Details["hash"] = e.Hash
 	}
 	return res
 }
 
-func (s *searchable) search(query string) ([]Content, error) {
-	logrus.Trace("Searching:", query)
+// fetch a single page of results, returning whether there are more and where the next page starts
+// the api doesn't take a context, so stop waiting on it once time runs out
+func (s *searchable) searchWithin(ctx context.Context, query string, start uint64, max uint64) ([]Content, bool, uint64, error) {
+	type page struct {
+		res  []Content
+		more bool
+		next uint64
+		err  error
+	}
+	done := make(chan page, 1)
+	go func() {
+		res, more, next, err := s.search(query, start, max)
+		done <- page{res, more, next, err}
+	}()
+
+	select {
+	case p := <-done:
+		return p.res, p.more, p.next, p.err
+	case <-ctx.Done():
+		return nil, false, start, ctx.Err()
+	}
+}
+
+func (s *searchable) search(query string, start uint64, max uint64) ([]Content, bool, uint64, error) {
+	logrus.Trace("Searching:", query, " from ", start)
 
 	res, err := s.db.Search(&files.SearchArg{
 		Path:       "",
 		Query:      query,
-		MaxResults: 100, // TODO configure?
+		Start:      start,
+		MaxResults: min(max, 1000), // the api won't return more than that in one go
 		Mode: &files.SearchMode{
 			Tagged: dropbox.Tagged{
 				Tag: files.SearchModeFilenameAndContent,
@@ -98,18 +154,25 @@ func (s *searchable) search(query string) ([]Content, error) {
 	})
 
 	if err != nil {
-		return nil, err
+		return nil, false, start, err
 	}
 
-	results := make([]Content, len(res.Matches))
-	for i, r := range res.Matches {
+	results := []Content{}
+	for _, r := range res.Matches {
 		c := convert(r)
 		if c != nil {
-			results[i] = *c
+			results = append(results, *c)
 		}
 	}
 
-	return results, nil
+	return results, res.More, res.Start, nil
+}
+
+func min(a uint64, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
 }
 
 func convert(e *files.SearchMatch) *Content {
@@ -14,8 +14,7 @@ import (
 
 func TestDropbox(t *testing.T) {
 	if os.Getenv("DROPBOX_TOKEN") == "" {
-		t.Log("Skipping d test (no token set)")
-		t.Skipped()
+		t.Skip("Skipping d test (no token set)")
 	}
 
 	d := dropbox.NewSearch(
@@ -25,16 +24,14 @@ func TestDropbox(t *testing.T) {
 		},
 	)
 
-	var fetched *cloudsearch.Result = nil
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
 
-	go func() {
-		time.Sleep(time.Second * 10)
-		if fetched == nil {
-			t.Fatal("No data found")
-		}
-	}()
+	data := d(cloudsearch.ParseQuery("clear_a.gif", "id", test.DefaultRegistry()), ctx)
 
-	data := d(cloudsearch.ParseQuery("clear_a.gif", "id", test.DefaultRegistry()), context.Background())
-
-	fmt.Println(<-data)
+	fetched, ok := <-data
+	if !ok {
+		t.Fatal("No data found")
+	}
+	fmt.Println(fetched)
 }
@@ -0,0 +1,42 @@
+package dropbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/dropbox-sdk-go-unofficial/dropbox"
+	"github.com/herval/dropbox-sdk-go-unofficial/dropbox/files"
+	"github.com/pkg/errors"
+)
+
+func NewVerifier(account cloudsearch.AccountData) (cloudsearch.Verifier, error) {
+	c := dropbox.Config{
+		Token:    account.Token,
+		LogLevel: dropbox.LogOff,
+		Client:   NewHttpClient(account),
+	}
+	db := files.New(c)
+	db.HttpClient().Timeout = time.Second * 10
+
+	return func(ctx context.Context, r cloudsearch.Result) (cloudsearch.Result, error) {
+		// ids work as paths, and survive files being moved around
+		m, err := db.GetMetadata(files.NewGetMetadataArg(r.OriginalId))
+		if err != nil {
+			if e, ok := err.(files.GetMetadataAPIError); ok && notFound(e) {
+				return cloudsearch.NotFound(r), nil
+			}
+			return r, errors.Wrap(err, "checking dropbox file")
+		}
+		if _, deleted := m.(*files.DeletedMetadata); deleted {
+			return cloudsearch.NotFound(r), nil
+		}
+		return r, nil
+	}, nil
+}
+
+func notFound(e files.GetMetadataAPIError) bool {
+	return e.EndpointError != nil &&
+		e.EndpointError.Path != nil &&
+		e.EndpointError.Path.Tag == files.LookupErrorNotFound
+}
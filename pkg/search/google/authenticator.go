@@ -4,9 +4,11 @@ import (
 	"github.com/herval/cloudsearch/pkg"
 	"context"
 	"fmt"
+	"github.com/herval/cloudsearch/pkg/httpclient"
 	"golang.org/x/oauth2"
 	goauth2 "google.golang.org/api/oauth2/v2"
 	"net/http"
+	"strings"
 )
 
 
@@ -63,6 +65,31 @@ func (g *GoogleAuth) FetchIdentityInfo(a cloudsearch.AccountData) (*cloudsearch.
 	return &a, nil
 }
 
+// the scopes searching needs that weren't granted to the account's token
+func (g *GoogleAuth) MissingScopes(a cloudsearch.AccountData) ([]string, error) {
+	client, err := goauth2.New(NewHttpClient(a))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := client.Tokeninfo().AccessToken(a.Token).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	granted := map[string]bool{}
+	for _, s := range strings.Fields(info.Scope) {
+		granted[s] = true
+	}
+	missing := []string{}
+	for _, s := range Scopes {
+		if !granted[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing, nil
+}
+
 func NewHttpClient(a cloudsearch.AccountData) *http.Client {
 	tok := &oauth2.Token{
 		AccessToken:  a.Token,
@@ -71,7 +98,10 @@ func NewHttpClient(a cloudsearch.AccountData) *http.Client {
 		Expiry:       a.Expiry,
 	}
 	src := oauth2.StaticTokenSource(tok)
-	cli := oauth2.NewClient(context.Background(), src)
+
+	// throttle and retry requests to Google's APIs
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpclient.NewClient(a.ID, httpclient.DefaultOptions))
+	cli := oauth2.NewClient(ctx, src)
 
 	return cli
 }
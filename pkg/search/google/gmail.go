@@ -22,6 +22,9 @@ type Gmail struct {
 
 var GmailTimeFormat = "2006/01/02"
 
+// how many messages are fetched at the same time
+var GmailConcurrency = 8
+
 func NewGmail(
 	account cloudsearch.AccountData,
 	client *http.Client,
@@ -35,38 +38,102 @@ func NewGmail(
 	}, err
 }
 
-func (a *Gmail) Search(ctx context.Context, q string, pageToken string, out chan<- cloudsearch.Result) (string, error) {
+// fetch a single page of messages, returning the next page token and how many messages were listed
+func (a *Gmail) Search(ctx context.Context, q string, pageToken string, pageSize int, out chan<- cloudsearch.Result) (string, int, error) {
 	//logrus.Debug("gmail: ", q, " - token: ", pageToken)
 	r, err := a.api.Users.Messages.
 		List(a.account.Email).
 		Q(q).
+		MaxResults(int64(pageSize)).
 		PageToken(pageToken).
 		Context(ctx).
-		Fields("messages(id)").
+		Fields("nextPageToken,messages(id)").
 		Do()
 	if err != nil {
-		return "", errors.Wrap(err, "searching gmail")
+		return "", 0, errors.Wrap(err, "searching gmail")
+	}
+
+	ids := make([]string, len(r.Messages))
+	for i, m := range r.Messages {
+		ids[i] = m.Id
+	}
+
+	a.fetchAll(ctx, ids, out)
+	if ctx.Err() != nil {
+		//logrus.Debug("Cancelling gmail search...")
+		return r.NextPageToken, len(ids), ctx.Err()
+	}
+
+	return r.NextPageToken, len(ids), nil
+}
+
+// fetch message metadata in parallel, emitting results in the same order as the given ids
+func (a *Gmail) fetchAll(ctx context.Context, ids []string, out chan<- cloudsearch.Result) {
+	pending := make([]chan *gmail.Message, len(ids))
+	for i := range pending {
+		pending[i] = make(chan *gmail.Message, 1)
 	}
 
-	for _, m := range r.Messages {
+	go func() {
+		sem := make(chan bool, GmailConcurrency)
+		for i, id := range ids {
+			select {
+			case <-ctx.Done():
+				// unblock everyone waiting on the remaining messages
+				for _, p := range pending[i:] {
+					p <- nil
+				}
+				return
+			case sem <- true:
+			}
+
+			go func(id string, res chan<- *gmail.Message) {
+				defer func() { <-sem }()
+
+				m, err := a.fetch(ctx, id, "metadata")
+				if err != nil {
+					// throttled requests were already retried - skip this one and keep the rest of the results
+					logrus.Error("Couldn't fetch message: ", err.Error())
+				}
+				res <- m
+			}(id, pending[i])
+		}
+	}()
+
+	for _, p := range pending {
+		m := <-p
 		if ctx.Err() != nil {
-			//logrus.Debug("Cancelling gmail search...")
-			return r.NextPageToken, ctx.Err()
+			return
+		}
+		if m != nil {
+			out <- a.toPartialResult(m)
 		}
+	}
+}
 
-		m, err := a.api.Users.Messages.
-			Get(a.account.Email, m.Id).
-			Format("full").
-			Do()
+func (a *Gmail) fetch(ctx context.Context, id string, format string) (*gmail.Message, error) {
+	call := a.api.Users.Messages.
+		Get(a.account.Email, id).
+		Format(format).
+		Context(ctx)
+	if format == "metadata" {
+		call = call.MetadataHeaders("From", "To", "Subject")
+	}
+
+	return call.Do()
+}
+
+// the metadata has everything we need to list results, the full body is only loaded when indexing
+func (a *Gmail) toPartialResult(m *gmail.Message) cloudsearch.Result {
+	r := a.toResult(m)
+	r.Hydrate = func(ctx context.Context) (cloudsearch.Result, error) {
+		full, err := a.fetch(ctx, m.Id, "full")
 		if err != nil {
-			return "", err
-			//logrus.Error("Couldn't fetch message: ", err.Error())
-		} else {
-			out <- a.toResult(m)
+			return r, errors.Wrap(err, "loading message")
 		}
+		return a.toResult(full), nil
 	}
-
-	return r.NextPageToken, nil
+	return r
 }
 
 func (a *Gmail) SearchSnippets(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
@@ -77,6 +144,12 @@ func (a *Gmail) SearchSnippets(query cloudsearch.Query, ctx context.Context) <-c
 		return out
 	}
 
+	pageToken, ok := query.PageToken(a.account, "gmail")
+	if !ok {
+		close(out)
+		return out
+	}
+
 	q := a.buildQuery(query)
 	if ctx.Err() != nil {
 		close(out)
@@ -85,11 +158,29 @@ func (a *Gmail) SearchSnippets(query cloudsearch.Query, ctx context.Context) <-c
 
 	go func() {
 		defer close(out)
-		_, err := a.Search(ctx, q, "", out)
-		if err != nil {
-			//logrus.Error("Couldn't list:", err)
-			return
+		budget, cancel := cloudsearch.WithTimeBudget(ctx)
+		defer cancel()
+
+		// page through results until we have enough of them, or time runs out
+		remaining := query.Limit()
+		for remaining > 0 {
+			next, listed, err := a.Search(budget, q, pageToken, min(remaining, 100), out)
+			if cloudsearch.OutOfTime(ctx, budget) {
+				break // the page that was cut short is fetched again on the next one
+			}
+			if err != nil {
+				cloudsearch.ReportError(ctx, "gmail", err)
+				return
+			}
+
+			remaining -= listed
+			pageToken = next
+			if pageToken == "" || listed == 0 {
+				return
+			}
 		}
+
+		out <- cloudsearch.MoreResults(a.account, "gmail", pageToken)
 	}()
 
 	return out
@@ -177,15 +268,15 @@ func (a *Gmail) toResult(f *gmail.Message) cloudsearch.Result {
 		ContentType: cloudsearch.Email,
 		OriginalId:  f.Id,
 		Timestamp:   time.Unix(f.InternalDate/1000, 0),
-		Body:        fmt.Sprintf("%s %s %s %s", subject, body, strings.Join(recipients, " "), strings.Join(labels, " ")), // TODO store the actual body here and get rid of the details one so we can highlight properly
+		Body:        body, // recipients and labels are indexed separately
 		Unread:      unread,
 		InvolvesMe:  involvesMe,
+		Labels:      labels,
 		Details: map[string]interface{}{
-			"labels":  labels,
-			"from":    strings.Join(from, ", "),
-			"to":      strings.Join(to, ", "),
-			"subject": subject,
-			"body":    body,
+			"threadId": f.ThreadId,
+			"labels":   labels,
+			"from":     strings.Join(from, ", "),
+			"to":       strings.Join(to, ", "),
 		},
 	}
 }
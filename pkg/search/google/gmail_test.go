@@ -0,0 +1,150 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+)
+
+// a fake gmail api, answering message fetches in random order
+func fakeGmail(ids []string, fullFetches *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/messages") {
+			msgs := []map[string]string{}
+			for _, id := range ids {
+				msgs = append(msgs, map[string]string{"id": id})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"messages": msgs})
+			return
+		}
+
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		format := r.URL.Query().Get("format")
+		if format == "full" {
+			atomic.AddInt32(fullFetches, 1)
+		}
+
+		time.Sleep(time.Duration(rand.Intn(20)) * time.Millisecond)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":       id,
+			"threadId": "t" + id,
+			"snippet":  "snippet " + id,
+			"payload": map[string]interface{}{
+				"headers": []map[string]string{
+					{"name": "Subject", "value": "subject " + id + " " + format},
+				},
+			},
+		})
+	}))
+}
+
+func TestGmailStreamsInListOrder(t *testing.T) {
+	ids := []string{}
+	for i := 0; i < 30; i++ {
+		ids = append(ids, fmt.Sprintf("m%d", i))
+	}
+
+	var fullFetches int32
+	s := fakeGmail(ids, &fullFetches)
+	defer s.Close()
+
+	g, err := NewGmail(cloudsearch.AccountData{ID: "1", Email: "me@foo.com"}, s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.api.BasePath = s.URL + "/"
+
+	out := make(chan cloudsearch.Result)
+	go func() {
+		defer close(out)
+		if _, _, err := g.Search(context.Background(), "foo", "", 100, out); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	res := []cloudsearch.Result{}
+	for r := range out {
+		res = append(res, r)
+	}
+
+	if len(res) != len(ids) {
+		t.Fatal("Should fetch every message: ", len(res))
+	}
+	for i, r := range res {
+		if r.OriginalId != ids[i] || r.Title != "subject "+ids[i]+" metadata" {
+			t.Fatal("Should emit results in list order, only w/ metadata: ", i, r.OriginalId, r.Title)
+		}
+	}
+	if fullFetches != 0 {
+		t.Fatal("Should not fetch the full messages: ", fullFetches)
+	}
+
+	full, err := res[0].Hydrate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if full.Title != "subject m0 full" || full.Hydrate != nil || fullFetches != 1 {
+		t.Fatal("Should load the full message lazily: ", full.Title, fullFetches)
+	}
+}
+
+func TestGmailContinuesWhenOutOfTime(t *testing.T) {
+	// the second page takes longer than the search can wait
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/messages") {
+			if r.URL.Query().Get("pageToken") == "p2" {
+				select {
+				case <-time.After(5 * time.Second):
+				case <-r.Context().Done():
+				}
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"messages":      []map[string]string{{"id": "m1"}},
+				"nextPageToken": "p2",
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "m1", "payload": map[string]interface{}{}})
+	}))
+	defer s.Close()
+
+	g, err := NewGmail(cloudsearch.AccountData{ID: "1", Email: "me@foo.com"}, s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.api.BasePath = s.URL + "/"
+
+	errs := []error{}
+	ctx := cloudsearch.WithErrorReporter(context.Background(), func(source string, err error) {
+		errs = append(errs, err)
+	})
+	ctx, cancel := context.WithTimeout(ctx, cloudsearch.TimeBudgetMargin+500*time.Millisecond)
+	defer cancel()
+
+	found := 0
+	var more *cloudsearch.Result
+	for r := range g.SearchSnippets(cloudsearch.Query{Text: "foo"}, ctx) {
+		if r.Status == cloudsearch.ResultMoreAvailable {
+			more = &r
+		} else {
+			found++
+		}
+	}
+
+	if found != 1 || more == nil || more.Details["pageToken"] != "p2" {
+		t.Fatal("Should continue from the page that ran out of time: ", found, more)
+	}
+	if len(errs) > 0 {
+		t.Fatal("Should not report running out of time as an error: ", errs)
+	}
+}
@@ -32,15 +32,15 @@ func NewGoogleDrive(
 	}, err
 }
 
-func (a *GoogleDrive) Search(ctx context.Context, q string, pageToken string) (*drive.FileList, string, error) {
+func (a *GoogleDrive) Search(ctx context.Context, q string, pageToken string, pageSize int) (*drive.FileList, string, error) {
 	//logrus.Debug("gdrive: ", q, " - token: ", pageToken)
 	r, err := a.driveApi.Files.
 		List().
 		Q(q).
-		PageSize(100).
+		PageSize(int64(pageSize)).
 		PageToken(pageToken).
 		Context(ctx).
-		Fields("files(id,name,size,createdTime,modifiedTime,thumbnailLink,webViewLink,fileExtension,mimeType,iconLink)").
+		Fields("nextPageToken,files(id,name,size,md5Checksum,createdTime,modifiedTime,thumbnailLink,webViewLink,fileExtension,mimeType,iconLink,owners(emailAddress))").
 		Do()
 	if err != nil {
 		return nil, "", errors.Wrap(err, "searching gdrive")
@@ -56,6 +56,12 @@ func (a *GoogleDrive) SearchSnippets(query cloudsearch.Query, ctx context.Contex
 		return out
 	}
 
+	pageToken, ok := query.PageToken(a.account, "drive")
+	if !ok {
+		close(out)
+		return out
+	}
+
 	q := a.buildQuery(query)
 	if ctx.Err() != nil {
 		close(out)
@@ -64,24 +70,49 @@ func (a *GoogleDrive) SearchSnippets(query cloudsearch.Query, ctx context.Contex
 
 	go func() {
 		defer close(out)
-		r, _, err := a.Search(ctx, q, "")
-		if err != nil {
-			//logrus.Error("Couldn't list:", err)
-			return
-		} else {
+		budget, cancel := cloudsearch.WithTimeBudget(ctx)
+		defer cancel()
+
+		// page through results until we have enough of them, or time runs out
+		remaining := query.Limit()
+		for remaining > 0 {
+			r, next, err := a.Search(budget, q, pageToken, min(remaining, 100))
+			if cloudsearch.OutOfTime(ctx, budget) {
+				break // the page that was cut short is fetched again on the next one
+			}
+			if err != nil {
+				cloudsearch.ReportError(ctx, "drive", err)
+				return
+			}
+
 			for _, f := range r.Files {
 				if ctx.Err() != nil {
 					return
 				}
 
 				out <- a.ToResult(f)
+				remaining -= 1
+			}
+
+			pageToken = next
+			if pageToken == "" {
+				return
 			}
 		}
+
+		out <- cloudsearch.MoreResults(a.account, "drive", pageToken)
 	}()
 
 	return out
 }
 
+func min(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
 func (a *GoogleDrive) buildQuery(query cloudsearch.Query) string {
 	q := fmt.Sprintf("fullText contains '%s'", query.Text)
 
@@ -127,7 +158,7 @@ func (a *GoogleDrive) FormattedTime(t time.Time) string {
 }
 
 func (a *GoogleDrive) ToResult(f *drive.File) cloudsearch.Result {
-	return cloudsearch.FileOrFolderResult(
+	r := cloudsearch.FileOrFolderResult(
 		f.Id,
 		cloudsearch.Either(f.OriginalFilename, f.Name),
 		f.Name,
@@ -151,4 +182,10 @@ func (a *GoogleDrive) ToResult(f *drive.File) cloudsearch.Result {
 		[]string{},
 		false,
 	)
+	r.Details["hash"] = f.Md5Checksum
+	if len(f.Owners) > 0 {
+		r.Details["owner"] = f.Owners[0].EmailAddress
+	}
+
+	return r
 }
@@ -0,0 +1,39 @@
+package google
+
+import (
+	"github.com/herval/cloudsearch/pkg/auth"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/gmail/v1"
+	goauth2 "google.golang.org/api/oauth2/v2"
+)
+
+var OAuthEndpoint = oauth2.Endpoint{
+	AuthURL:  "https://accounts.google.com/o/oauth2/auth",
+	TokenURL: "https://oauth2.googleapis.com/token",
+}
+
+// what searching needs access to
+var Scopes = []string{
+	gmail.GmailReadonlyScope,
+	drive.DriveReadonlyScope,
+	goauth2.UserinfoEmailScope,
+	goauth2.UserinfoProfileScope,
+}
+
+// for talking to Google's OAuth2 endpoints directly, w/ a client from the Google Cloud console
+func OAuthProvider(clientId string, clientSecret string) auth.Provider {
+	return auth.Provider{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Endpoint:     OAuthEndpoint,
+		Scopes:       Scopes,
+		// refresh tokens are only given w/ offline access, and only on the first consent
+		Params: map[string]string{
+			"access_type": "offline",
+			"prompt":      "consent",
+		},
+		// Google only grants some scopes to devices, so logins fall back to pasting the code when it's refused
+		DeviceAuthURL: "https://oauth2.googleapis.com/device/code",
+	}
+}
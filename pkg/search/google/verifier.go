@@ -0,0 +1,85 @@
+package google
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/pkg/errors"
+	"google.golang.org/api/googleapi"
+)
+
+// checks emails on gmail and everything else on drive
+func NewVerifier(account cloudsearch.AccountData) (cloudsearch.Verifier, error) {
+	httpClient := NewHttpClient(account)
+	drive, err := NewGoogleDrive(account, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	gmail, err := NewGmail(account, httpClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(ctx context.Context, r cloudsearch.Result) (cloudsearch.Result, error) {
+		var exists bool
+		var err error
+		if r.ContentType == cloudsearch.Email {
+			exists, err = gmail.Exists(ctx, r.OriginalId)
+		} else {
+			exists, err = drive.Exists(ctx, r.OriginalId)
+		}
+		if err != nil {
+			return r, err
+		}
+		if !exists {
+			return cloudsearch.NotFound(r), nil
+		}
+		return r, nil
+	}, nil
+}
+
+// whether a message is still around. Trashed ones count as gone.
+func (a *Gmail) Exists(ctx context.Context, id string) (bool, error) {
+	m, err := a.api.Users.Messages.
+		Get(a.account.Email, id).
+		Format("minimal").
+		Context(ctx).
+		Fields("id,labelIds").
+		Do()
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "checking gmail message")
+	}
+
+	for _, l := range m.LabelIds {
+		if l == "TRASH" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// whether a file is still around. Trashed ones count as gone.
+func (a *GoogleDrive) Exists(ctx context.Context, id string) (bool, error) {
+	f, err := a.driveApi.Files.
+		Get(id).
+		Context(ctx).
+		Fields("id,trashed").
+		Do()
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "checking gdrive file")
+	}
+	return !f.Trashed, nil
+}
+
+func isNotFound(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == http.StatusNotFound
+}
@@ -0,0 +1,57 @@
+package google
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+)
+
+// a fake google api where "gone" doesn't exist and "trashed" is in the trash
+func fakeGoogle() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		switch id {
+		case "gone":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{"code": 404, "message": "Not Found"},
+			})
+		case "trashed":
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "labelIds": []string{"TRASH"}, "trashed": true})
+		default:
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "labelIds": []string{"INBOX"}})
+		}
+	}))
+}
+
+func TestExists(t *testing.T) {
+	s := fakeGoogle()
+	defer s.Close()
+
+	account := cloudsearch.AccountData{ID: "1", Email: "me@foo.com"}
+	gmail, err := NewGmail(account, s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	gmail.api.BasePath = s.URL + "/"
+
+	drive, err := NewGoogleDrive(account, s.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	drive.driveApi.BasePath = s.URL + "/"
+
+	for id, expected := range map[string]bool{"here": true, "gone": false, "trashed": false} {
+		if exists, err := gmail.Exists(context.Background(), id); err != nil || exists != expected {
+			t.Fatal("Gmail message ", id, " should exist: ", expected, err)
+		}
+		if exists, err := drive.Exists(context.Background(), id); err != nil || exists != expected {
+			t.Fatal("Drive file ", id, " should exist: ", expected, err)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package cloudsearch
+
+import (
+	"context"
+)
+
+type errorReporterKey struct{}
+
+// have searchables report errors through the context, as they'd otherwise only end their results early
+// (eg for health checks)
+func WithErrorReporter(ctx context.Context, report func(source string, err error)) context.Context {
+	return context.WithValue(ctx, errorReporterKey{}, report)
+}
+
+// report an error searching a source, if there's anyone listening
+func ReportError(ctx context.Context, source string, err error) {
+	if report, ok := ctx.Value(errorReporterKey{}).(func(string, error)); ok {
+		report(source, err)
+	}
+}
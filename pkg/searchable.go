@@ -3,3 +3,31 @@ package cloudsearch
 import "context"
 
 type SearchFunc func(query Query, context context.Context) <-chan Result
+
+// wait for a search to finish, returning its results and continuation token (if there are more).
+// Grouped results are re-sent as they grow, so they replace the ones already collected.
+func Collect(results <-chan Result, counter *FacetCounter) ([]Result, string) {
+	res := []Result{}
+	more := ""
+	for r := range results {
+		if r.Status == ResultMoreAvailable {
+			more = r.Continuation()
+			continue
+		}
+		if counter != nil {
+			counter.Add(r)
+		}
+		res = upsert(res, r)
+	}
+	return res, more
+}
+
+func upsert(results []Result, r Result) []Result {
+	for i, e := range results {
+		if e.Id == r.Id {
+			results[i] = r
+			return results
+		}
+	}
+	return append(results, r)
+}
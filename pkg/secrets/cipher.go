@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// marks encrypted values, so values from before encryption can still be read (and migrated)
+const encryptedPrefix = "enc1:"
+
+const KeySize = 32
+
+// encrypts secrets w/ a data key (AES-GCM)
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, errors.Errorf("keys must have %d bytes", KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// ciphers can end up on configs that get saved (eg the index's), but keys should never be
+func (c *Cipher) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+func RandomKey() ([]byte, error) {
+	return RandomBytes(KeySize)
+}
+
+func RandomBytes(size int) ([]byte, error) {
+	b := make([]byte, size)
+	_, err := io.ReadFull(rand.Reader, b)
+	return b, err
+}
+
+func (c *Cipher) Seal(plaintext []byte) ([]byte, error) {
+	nonce, err := RandomBytes(c.aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (c *Cipher) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, errors.New("encrypted value is too short")
+	}
+	n := c.aead.NonceSize()
+	res, err := c.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	return res, errors.Wrap(err, "decrypting (wrong key?)")
+}
+
+// encrypt a string to a printable string. Empty strings are kept empty.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" || IsEncrypted(plaintext) {
+		return plaintext, nil
+	}
+	sealed, err := c.Seal([]byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt a string from Encrypt. Strings that were never encrypted are returned as they are.
+func (c *Cipher) Decrypt(s string) (string, error) {
+	if !IsEncrypted(s) {
+		return s, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, encryptedPrefix))
+	if err != nil {
+		return "", errors.Wrap(err, "decoding encrypted value")
+	}
+	res, err := c.Open(sealed)
+	return string(res), err
+}
+
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, encryptedPrefix)
+}
@@ -0,0 +1,75 @@
+package secrets
+
+import (
+	"github.com/pkg/errors"
+)
+
+// a data key, sealed w/ a key from a KeySource. Secrets are encrypted w/ the data key, so changing
+// where the key comes from (rekeying) only means sealing the data key again.
+type Envelope struct {
+	Source  string // the KeySource name
+	Salt    []byte // given to the key source (eg to derive a key from a passphrase)
+	DataKey []byte // sealed
+}
+
+// a new random data key, sealed w/ a key from the given source
+func NewEnvelope(keys KeySource) (*Envelope, []byte, error) {
+	dataKey, err := RandomKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	e, err := Seal(dataKey, keys)
+	return e, dataKey, err
+}
+
+// seal a data key w/ a new key from the given source
+func Seal(dataKey []byte, keys KeySource) (*Envelope, error) {
+	salt, err := RandomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := keys.Key(salt, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the key from "+keys.Name())
+	}
+	sealer, err := NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := sealer.Seal(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{Source: keys.Name(), Salt: salt, DataKey: sealed}, nil
+}
+
+// the data key, unsealed w/ the key from the given source
+func (e *Envelope) Open(keys KeySource) ([]byte, error) {
+	if keys.Name() != e.Source {
+		return nil, errors.Errorf("secrets are protected w/ a key from %s, not %s", e.Source, keys.Name())
+	}
+
+	key, err := keys.Key(e.Salt, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting the key from "+keys.Name())
+	}
+	sealer, err := NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return sealer.Open(e.DataKey)
+}
+
+// remove the key sealing this envelope from its source, if it keeps keys
+func (e *Envelope) Forget() error {
+	keys, err := KeySourceNamed(e.Source)
+	if err != nil {
+		return err
+	}
+	if f, ok := keys.(Forgetter); ok {
+		return f.Forget(e.Salt)
+	}
+	return nil
+}
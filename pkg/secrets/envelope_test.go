@@ -0,0 +1,44 @@
+package secrets_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg/secrets"
+)
+
+func TestEnvelope(t *testing.T) {
+	defer os.Unsetenv(secrets.PassphraseVar)
+	os.Setenv(secrets.PassphraseVar, "correct horse")
+
+	env, dataKey, err := secrets.NewEnvelope(secrets.Passphrase{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := secrets.NewCipher(dataKey)
+
+	encrypted, err := c.Encrypt("token")
+	if err != nil || encrypted == "token" || !secrets.IsEncrypted(encrypted) {
+		t.Fatal("Should encrypt ", err, encrypted)
+	}
+	if plain, err := c.Decrypt("token"); err != nil || plain != "token" {
+		t.Fatal("Should read values that were never encrypted ", err, plain)
+	}
+
+	opened, err := env.Open(secrets.Passphrase{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ = secrets.NewCipher(opened)
+	if plain, err := c.Decrypt(encrypted); err != nil || plain != "token" {
+		t.Fatal("Should decrypt w/ the unsealed data key ", err, plain)
+	}
+
+	if _, err := env.Open(secrets.EnvKey{}); err == nil {
+		t.Fatal("Should not open w/ keys from another source")
+	}
+	os.Setenv(secrets.PassphraseVar, "wrong")
+	if _, err := env.Open(secrets.Passphrase{}); err == nil {
+		t.Fatal("Should not open w/ the wrong passphrase")
+	}
+}
@@ -0,0 +1,180 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	KeyVar        = "CLOUDSEARCH_KEY"        // a base64-encoded 32 byte key, for headless use
+	PassphraseVar = "CLOUDSEARCH_PASSPHRASE" // so passphrases don't have to be typed in (eg on cron jobs)
+)
+
+// where the key protecting secrets at rest comes from
+type KeySource interface {
+	Name() string
+	// the key for a given salt. A new key is made (and kept, if the source keeps keys) when create is set.
+	Key(salt []byte, create bool) ([]byte, error)
+}
+
+// sources keeping keys around, which can remove keys that aren't used anymore
+type Forgetter interface {
+	Forget(salt []byte) error
+}
+
+// the key source used before, or the best one available for new secrets
+func DefaultKeySource(previous string) (KeySource, error) {
+	if previous != "" {
+		return KeySourceNamed(previous)
+	}
+	if os.Getenv(KeyVar) != "" {
+		return EnvKey{}, nil
+	}
+	if KeyringAvailable() {
+		return Keyring{}, nil
+	}
+	if os.Getenv(PassphraseVar) != "" || canPrompt() {
+		return Passphrase{}, nil
+	}
+	return nil, errors.New("no key to encrypt account tokens w/ - set " + KeyVar + " (eg 'head -c 32 /dev/urandom | base64') or " + PassphraseVar)
+}
+
+// whether there's someone to ask for a passphrase
+func canPrompt() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+func KeySourceNamed(name string) (KeySource, error) {
+	switch name {
+	case EnvKey{}.Name():
+		return EnvKey{}, nil
+	case Keyring{}.Name():
+		return Keyring{}, nil
+	case Passphrase{}.Name():
+		return Passphrase{}, nil
+	}
+	return nil, errors.New("unknown key source: " + name)
+}
+
+// a key taken from the environment
+type EnvKey struct{}
+
+func (e EnvKey) Name() string {
+	return "env"
+}
+
+func (e EnvKey) Key(salt []byte, create bool) ([]byte, error) {
+	v := os.Getenv(KeyVar)
+	if v == "" {
+		return nil, errors.New(KeyVar + " is not set")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+	if err != nil || len(key) != KeySize {
+		return nil, errors.Errorf("%s must be a base64-encoded %d byte key (eg 'head -c %d /dev/urandom | base64')", KeyVar, KeySize, KeySize)
+	}
+	return key, nil
+}
+
+// random keys kept on the OS keyring, through the Secret Service API
+type Keyring struct{}
+
+func KeyringAvailable() bool {
+	_, err := exec.LookPath("secret-tool")
+	return err == nil && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != ""
+}
+
+func (k Keyring) Name() string {
+	return "keyring"
+}
+
+// each key is kept under its salt, so a new key doesn't replace the previous one before secrets are rekeyed
+func (k Keyring) attributes(salt []byte) []string {
+	return []string{"service", "cloudsearch", "salt", hex.EncodeToString(salt)}
+}
+
+func (k Keyring) Key(salt []byte, create bool) ([]byte, error) {
+	if create {
+		key, err := RandomKey()
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command("secret-tool", append([]string{"store", "--label=cloudsearch"}, k.attributes(salt)...)...)
+		cmd.Stdin = strings.NewReader(base64.StdEncoding.EncodeToString(key))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, errors.Wrap(err, "storing the key on the keyring: "+string(out))
+		}
+		return key, nil
+	}
+
+	out, err := exec.Command("secret-tool", append([]string{"lookup"}, k.attributes(salt)...)...).Output()
+	if err != nil || len(bytes.TrimSpace(out)) == 0 {
+		return nil, errors.New("key not found on the keyring")
+	}
+	return base64.StdEncoding.DecodeString(string(bytes.TrimSpace(out)))
+}
+
+func (k Keyring) Forget(salt []byte) error {
+	out, err := exec.Command("secret-tool", append([]string{"clear"}, k.attributes(salt)...)...).CombinedOutput()
+	return errors.Wrap(err, string(out))
+}
+
+// keys derived from a passphrase (scrypt)
+type Passphrase struct{}
+
+func (p Passphrase) Name() string {
+	return "passphrase"
+}
+
+func (p Passphrase) Key(salt []byte, create bool) ([]byte, error) {
+	pass := os.Getenv(PassphraseVar)
+	if pass == "" {
+		var err error
+		if pass, err = p.prompt(create); err != nil {
+			return nil, err
+		}
+	}
+	return scrypt.Key([]byte(pass), salt, 1<<15, 8, 1, KeySize)
+}
+
+func (p Passphrase) prompt(create bool) (string, error) {
+	if !canPrompt() {
+		return "", errors.New("no passphrase - set " + PassphraseVar)
+	}
+	fd := int(os.Stdin.Fd())
+
+	read := func(prompt string) (string, error) {
+		fmt.Fprint(os.Stderr, prompt)
+		pass, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(pass), err
+	}
+
+	if !create {
+		return read("Passphrase: ")
+	}
+
+	pass, err := read("New passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass == "" {
+		return "", errors.New("passphrases can't be empty")
+	}
+	again, err := read("Repeat the passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if pass != again {
+		return "", errors.New("passphrases don't match")
+	}
+	return pass, nil
+}
@@ -0,0 +1,31 @@
+package secrets_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg/secrets"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+func TestDefaultKeySourceWithoutTerminal(t *testing.T) {
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		t.Skip("passphrases can be asked for on a terminal")
+	}
+	if bus, ok := os.LookupEnv("DBUS_SESSION_BUS_ADDRESS"); ok {
+		os.Unsetenv("DBUS_SESSION_BUS_ADDRESS") // no keyring
+		defer os.Setenv("DBUS_SESSION_BUS_ADDRESS", bus)
+	}
+
+	_, err := secrets.DefaultKeySource("")
+	if err == nil || !strings.Contains(err.Error(), secrets.KeyVar) || !strings.Contains(err.Error(), secrets.PassphraseVar) {
+		t.Fatal("Should ask for a key or passphrase on the env: ", err)
+	}
+
+	defer os.Unsetenv(secrets.PassphraseVar)
+	os.Setenv(secrets.PassphraseVar, "correct horse")
+	if k, err := secrets.DefaultKeySource(""); err != nil || k.Name() != (secrets.Passphrase{}).Name() {
+		t.Fatal("Should use the passphrase on the env: ", k, err)
+	}
+}
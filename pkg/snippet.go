@@ -0,0 +1,153 @@
+package cloudsearch
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// how much of a field is kept on a snippet, and how much of it comes before the first match
+const (
+	SnippetLength  = 160
+	SnippetContext = 40
+)
+
+// a fragment of a result's content showing where it matched the query
+type Snippet struct {
+	Field    string  `json:"field"` // Title or Body
+	Fragment string  `json:"fragment"`
+	Matches  []Match `json:"matches"` // in order, as byte offsets on the fragment
+}
+
+type Match struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// wrap the matches on the fragment (eg w/ color codes)
+func (s *Snippet) Mark(before string, after string) string {
+	res := ""
+	curr := 0
+	for _, m := range s.Matches {
+		res += s.Fragment[curr:m.Start] + before + s.Fragment[m.Start:m.End] + after
+		curr = m.End
+	}
+	return res + s.Fragment[curr:]
+}
+
+// build a snippet around the first match on a field's text. Matches are byte offsets on the text.
+func NewSnippet(field string, text string, matches []Match) *Snippet {
+	matches = normalizeMatches(text, matches)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	start := 0
+	if matches[0].Start > SnippetContext {
+		start = matches[0].Start - SnippetContext
+		// don't cut words (or runes) in half
+		if i := strings.IndexAny(text[start:matches[0].Start], " \t\r\n"); i >= 0 {
+			start += i + 1
+		}
+		for start < len(text) && !utf8.RuneStart(text[start]) {
+			start++
+		}
+	}
+
+	end := start + SnippetLength
+	if end >= len(text) {
+		end = len(text)
+	} else {
+		for end > start && !utf8.RuneStart(text[end]) {
+			end--
+		}
+	}
+
+	s := &Snippet{
+		Field:    field,
+		Fragment: strings.NewReplacer("\r", " ", "\n", " ", "\t", " ").Replace(text[start:end]),
+	}
+	for _, m := range matches {
+		if m.Start >= start && m.End <= end {
+			s.Matches = append(s.Matches, Match{m.Start - start, m.End - start})
+		}
+	}
+
+	return s
+}
+
+// sorted, within the text and not overlapping
+func normalizeMatches(text string, matches []Match) []Match {
+	res := []Match{}
+	for _, m := range matches {
+		if m.Start >= 0 && m.End <= len(text) && m.Start < m.End {
+			res = append(res, m)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Start < res[j].Start
+	})
+
+	merged := []Match{}
+	for _, m := range res {
+		if l := len(merged) - 1; l >= 0 && m.Start <= merged[l].End {
+			if m.End > merged[l].End {
+				merged[l].End = m.End
+			}
+			continue
+		}
+		merged = append(merged, m)
+	}
+	return merged
+}
+
+// a snippet for results that didn't come from the index (eg live ones), preferring matches on the body
+func Highlight(query Query, r Result) *Snippet {
+	terms := queryTerms(query.Text)
+	if terms == nil {
+		return nil
+	}
+
+	if s := NewSnippet("Body", r.Body, findMatches(terms, r.Body)); s != nil {
+		return s
+	}
+	return NewSnippet("Title", r.Title, findMatches(terms, r.Title))
+}
+
+// a filter setting snippets on results that don't have one yet
+func SetSnippet(query Query, in Result) *Result {
+	if in.Snippet == nil && in.Status == ResultFound {
+		in.Snippet = Highlight(query, in)
+	}
+	return &in
+}
+
+// a case-insensitive regex matching any of the words on the query
+func queryTerms(text string) *regexp.Regexp {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return r == ' ' || r == '"' || r == '\''
+	})
+	if len(words) == 0 {
+		return nil
+	}
+
+	// longer words first, so they win over their prefixes
+	sort.Slice(words, func(i, j int) bool {
+		return len(words[i]) > len(words[j])
+	})
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+
+	return regexp.MustCompile("(?i)" + strings.Join(words, "|"))
+}
+
+func findMatches(terms *regexp.Regexp, text string) []Match {
+	res := []Match{}
+	for _, m := range terms.FindAllStringIndex(text, -1) {
+		res = append(res, Match{m[0], m[1]})
+	}
+	return res
+}
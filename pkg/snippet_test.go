@@ -0,0 +1,57 @@
+package cloudsearch_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+)
+
+func TestHighlightPrefersBody(t *testing.T) {
+	q := cloudsearch.Query{Text: "quarterly report"}
+
+	s := cloudsearch.Highlight(q, cloudsearch.Result{Title: "Report", Body: "the Quarterly numbers\nare in"})
+	if s == nil || s.Field != "Body" || s.Mark("[", "]") != "the [Quarterly] numbers are in" {
+		t.Fatal("Should highlight the body: ", s)
+	}
+
+	s = cloudsearch.Highlight(q, cloudsearch.Result{Title: "Monthly Report", Body: "nothing to see"})
+	if s == nil || s.Field != "Title" || s.Mark("[", "]") != "Monthly [Report]" {
+		t.Fatal("Should fall back to the title: ", s)
+	}
+
+	if s := cloudsearch.Highlight(q, cloudsearch.Result{Title: "foo", Body: "bar"}); s != nil {
+		t.Fatal("Should not highlight results w/o matches: ", s)
+	}
+}
+
+func TestSnippetAroundFirstMatch(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 20) + "needle " + strings.Repeat("dolor sit ", 30)
+	start := strings.Index(text, "needle")
+
+	s := cloudsearch.NewSnippet("Body", text, []cloudsearch.Match{{Start: start, End: start + 6}})
+	if len(s.Fragment) > cloudsearch.SnippetLength || strings.HasPrefix(s.Fragment, " ") {
+		t.Fatal("Should cut the fragment at word boundaries: ", s.Fragment)
+	}
+	if len(s.Matches) != 1 || s.Fragment[s.Matches[0].Start:s.Matches[0].End] != "needle" {
+		t.Fatal("Should point to the match on the fragment: ", s)
+	}
+}
+
+func TestSnippetMergesOverlappingMatches(t *testing.T) {
+	s := cloudsearch.NewSnippet("Title", "foobar", []cloudsearch.Match{{Start: 3, End: 6}, {Start: 0, End: 4}, {Start: 2, End: 10}})
+	if s.Mark("[", "]") != "[foobar]" {
+		t.Fatal("Should merge overlapping matches: ", s)
+	}
+}
+
+func TestRedactedResultsAreHighlightedAgain(t *testing.T) {
+	q := cloudsearch.Query{Text: "card"}
+	r := cloudsearch.SetSnippet(q, cloudsearch.Result{Body: "card 4111 1111 1111 1111"})
+	r = cloudsearch.Redact(q, *r)
+	r = cloudsearch.SetSnippet(q, *r)
+
+	if r.Snippet.Fragment != "card [redacted]" {
+		t.Fatal("Should not show redacted content on snippets: ", r.Snippet)
+	}
+}
@@ -0,0 +1,58 @@
+package bleve
+
+import (
+	bl "github.com/blevesearch/bleve"
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// count what's on the index and read every result back, to find the ones that can't be anymore
+func (s *BleveResultStorage) Check() (cloudsearch.IndexStats, error) {
+	stats := cloudsearch.IndexStats{}
+
+	docs, err := s.index.DocCount()
+	if err != nil {
+		return stats, errors.Wrap(err, "counting results")
+	}
+	stats.Docs = docs
+
+	version, err := SchemaVersionOf(s.current)
+	if err != nil {
+		return stats, errors.Wrap(err, "reading the schema version")
+	}
+	stats.SchemaVersion = version
+	stats.UpToDate = version == SchemaVersion || s.migrating()
+
+	ids, err := s.findIds(bl.NewMatchAllQuery())
+	if err != nil {
+		return stats, err
+	}
+	for id := range ids {
+		if _, err := s.Get(id); err != nil {
+			logrus.Debug("Can't read ", id, ": ", err)
+			stats.Unreadable += 1
+		}
+	}
+
+	return stats, nil
+}
+
+func (s *BleveResultStorage) migrating() bool {
+	if s.migrated == nil {
+		return false
+	}
+	select {
+	case <-s.migrated:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *WriteBehindStorage) Check() (cloudsearch.IndexStats, error) {
+	if err := s.Flush(); err != nil {
+		return cloudsearch.IndexStats{}, err
+	}
+	return s.BleveResultStorage.Check()
+}
@@ -0,0 +1,52 @@
+package bleve_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/storage/bleve"
+)
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := bleve.OpenResultStorage(dir, newCipher(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1", Title: "foo"}, s, t)
+	assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "2", Title: "bar"}, s, t)
+
+	stats, err := s.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Docs != 2 || stats.Unreadable != 0 || !stats.UpToDate || stats.SchemaVersion != bleve.SchemaVersion {
+		t.Fatal("Should find a healthy index ", stats)
+	}
+
+	// w/o a schema version, and a result that can't be read back
+	broken := rawIndex(t, filepath.Join(dir, "broken.bleve"))
+	b := bleve.NewBleveResultStorage(broken).(*bleve.BleveResultStorage)
+	defer b.Close()
+	assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1", Title: "foo"}, b, t)
+	if err := broken.Index("broken", map[string]interface{}{"Type": "result", "Details": "{"}); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err = b.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Docs != 2 || stats.Unreadable != 1 || stats.UpToDate {
+		t.Fatal("Should find what's wrong w/ the index ", stats)
+	}
+}
@@ -0,0 +1,169 @@
+package bleve
+
+import (
+	"os"
+	"path/filepath"
+
+	bl "github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// how many results are copied at once when rebuilding the index
+var rebuildBatchSize = 100
+
+// size of the index on disk
+func (s *BleveResultStorage) Size() (int64, error) {
+	var size int64
+	err := filepath.Walk(s.index.Name(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// the index never shrinks on its own, so copy every result over to a fresh one and swap them
+func (s *BleveResultStorage) Compact() error {
+	path := s.index.Name()
+	tmp := path + ".compact"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+
+	mapping, err := NewMapping()
+	if err != nil {
+		return err
+	}
+	compacted, err := newIndex(tmp, mapping, s.cipher)
+	if err != nil {
+		return errors.Wrap(err, "creating compacted index")
+	}
+	version, err := SchemaVersionOf(s.current)
+	if err == nil {
+		err = setSchemaVersion(compacted, version)
+	}
+	if err != nil {
+		compacted.Close()
+		return err
+	}
+
+	old, err := s.rebuild(compacted)
+	if err != nil {
+		compacted.Close()
+		os.RemoveAll(tmp)
+		return err
+	}
+
+	if err := old.Close(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(path); err != nil {
+		return err
+	}
+
+	// the compacted index takes the old one's place (it's still open, but that's fine)
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	s.index.SetName(path)
+	return nil
+}
+
+// copy every result over to another index and swap it in, returning the one swapped out. Searches keep
+// going to the current index until then.
+func (s *BleveResultStorage) rebuild(into bl.Index) (bl.Index, error) {
+	s.writeLock.Lock()
+	if s.rebuilding {
+		s.writeLock.Unlock()
+		return nil, errors.New("the index is already being rebuilt")
+	}
+	s.rebuilding = true
+	s.dirty = map[string]bool{}
+	s.writeLock.Unlock()
+
+	done := false
+	defer func() {
+		if !done {
+			s.writeLock.Lock()
+			s.rebuilding = false
+			s.writeLock.Unlock()
+		}
+	}()
+
+	found, err := s.findIds(query.NewMatchAllQuery())
+	if err != nil {
+		return nil, err
+	}
+
+	// list everything first, as writing while paging through the index isn't reliable
+	ids := []string{}
+	for id := range found {
+		ids = append(ids, id)
+	}
+	if err := s.copyTo(into, ids); err != nil {
+		return nil, err
+	}
+
+	// results written in the meantime get copied again, w/ writes on hold until the swap
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	s.stateLock.Lock()
+	ids = []string{}
+	for id := range s.dirty {
+		ids = append(ids, id)
+	}
+	s.dirty = map[string]bool{}
+	s.stateLock.Unlock()
+
+	if err := s.copyTo(into, ids); err != nil {
+		return nil, err
+	}
+
+	old := s.current
+	s.index.Swap([]bl.Index{into}, []bl.Index{old})
+	s.index.SetName(into.Name())
+	s.mapping = into.Mapping()
+	s.current = into
+	s.rebuilding = false
+	done = true
+
+	return old, nil
+}
+
+// copy results from the current index, removing the ones that don't exist anymore
+func (s *BleveResultStorage) copyTo(into bl.Index, ids []string) error {
+	b := into.NewBatch()
+	for _, id := range ids {
+		if s.isClosed() {
+			return errors.New("the index was closed")
+		}
+
+		r, err := s.Get(id)
+		if err != nil {
+			logrus.Error("Couldn't copy ", id, ": ", err)
+			continue
+		}
+
+		if r == nil {
+			b.Delete(id)
+		} else if err := b.Index(id, searchable(*r)); err != nil { // indexed as-is, so cache times are kept
+			return errors.Wrap(err, "copying "+id)
+		}
+
+		if b.Size() >= rebuildBatchSize {
+			if err := into.Batch(b); err != nil {
+				return errors.Wrap(err, "copying results")
+			}
+			b = into.NewBatch()
+		}
+	}
+
+	return errors.Wrap(into.Batch(b), "copying results")
+}
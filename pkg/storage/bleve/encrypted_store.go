@@ -0,0 +1,247 @@
+package bleve
+
+import (
+	bl "github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/index/store"
+	"github.com/blevesearch/bleve/index/store/boltdb"
+	"github.com/blevesearch/bleve/index/upsidedown"
+	m "github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/registry"
+	"github.com/herval/cloudsearch/pkg/secrets"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// a boltdb store w/ every value encrypted - stored fields (bodies, titles, details), term vectors, etc.
+// Keys are kept as they are, so the index can still look terms up.
+const EncryptedStoreName = "encryptedBolt"
+
+// the store config entry w/ the cipher for values. It's given when the index is opened and never saved.
+const cipherConfig = "cipher"
+
+func init() {
+	registry.RegisterKVStore(EncryptedStoreName, newEncryptedStore)
+}
+
+// a new index, encrypted if there's a cipher
+func newIndex(path string, mapping *m.IndexMappingImpl, c *secrets.Cipher) (bl.Index, error) {
+	if c == nil {
+		return bl.New(path, mapping)
+	}
+	return bl.NewUsing(path, mapping, upsidedown.Name, EncryptedStoreName, map[string]interface{}{cipherConfig: c})
+}
+
+// the cipher is only needed when the index is encrypted
+func openIndex(path string, c *secrets.Cipher) (bl.Index, error) {
+	if c == nil {
+		return bl.Open(path)
+	}
+	return bl.OpenUsing(path, map[string]interface{}{cipherConfig: c})
+}
+
+func newEncryptedStore(mo store.MergeOperator, config map[string]interface{}) (store.KVStore, error) {
+	c, ok := config[cipherConfig].(*secrets.Cipher)
+	if !ok || c == nil {
+		return nil, errors.New("the index is encrypted, but there's no key for it")
+	}
+
+	s, err := boltdb.New(&encryptedMerge{mo: mo, cipher: c}, config)
+	if err != nil {
+		return nil, err
+	}
+	// bleve doesn't close stores it fails to open, which would keep the db locked
+	if err := checkKey(s, c); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return &encryptedStore{KVStore: s, cipher: c}, nil
+}
+
+// try decrypting any value, so a wrong key fails right away
+func checkKey(s store.KVStore, c *secrets.Cipher) error {
+	r, err := s.Reader()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	it := r.RangeIterator(nil, nil)
+	defer it.Close()
+	if _, v, ok := it.Current(); ok {
+		_, err = c.Open(v)
+	}
+	return err
+}
+
+type encryptedStore struct {
+	store.KVStore
+	cipher *secrets.Cipher
+}
+
+func (s *encryptedStore) Reader() (store.KVReader, error) {
+	r, err := s.KVStore.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedReader{KVReader: r, cipher: s.cipher}, nil
+}
+
+func (s *encryptedStore) Writer() (store.KVWriter, error) {
+	w, err := s.KVStore.Writer()
+	if err != nil {
+		return nil, err
+	}
+	return &encryptedWriter{KVWriter: w, cipher: s.cipher}, nil
+}
+
+// merges happen on the values as they're stored, so they're decrypted and encrypted again around it
+type encryptedMerge struct {
+	mo     store.MergeOperator
+	cipher *secrets.Cipher
+}
+
+func (m *encryptedMerge) FullMerge(key, existingValue []byte, operands [][]byte) ([]byte, bool) {
+	var existing []byte
+	if existingValue != nil {
+		var err error
+		if existing, err = m.cipher.Open(existingValue); err != nil {
+			logrus.Error("Couldn't decrypt index value: ", err)
+			return nil, false
+		}
+	}
+
+	merged, ok := m.mo.FullMerge(key, existing, operands)
+	if !ok {
+		return nil, false
+	}
+	sealed, err := m.cipher.Seal(merged)
+	if err != nil {
+		logrus.Error("Couldn't encrypt index value: ", err)
+		return nil, false
+	}
+	return sealed, true
+}
+
+// operands are only kept in memory, unencrypted
+func (m *encryptedMerge) PartialMerge(key, leftOperand, rightOperand []byte) ([]byte, bool) {
+	return m.mo.PartialMerge(key, leftOperand, rightOperand)
+}
+
+func (m *encryptedMerge) Name() string {
+	return "encrypted" + m.mo.Name()
+}
+
+type encryptedReader struct {
+	store.KVReader
+	cipher *secrets.Cipher
+}
+
+func (r *encryptedReader) Get(key []byte) ([]byte, error) {
+	v, err := r.KVReader.Get(key)
+	if err != nil || v == nil {
+		return v, err
+	}
+	return r.cipher.Open(v)
+}
+
+func (r *encryptedReader) MultiGet(keys [][]byte) ([][]byte, error) {
+	vals, err := r.KVReader.MultiGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range vals {
+		if v == nil {
+			continue
+		}
+		if vals[i], err = r.cipher.Open(v); err != nil {
+			return nil, err
+		}
+	}
+	return vals, nil
+}
+
+func (r *encryptedReader) PrefixIterator(prefix []byte) store.KVIterator {
+	return &encryptedIterator{KVIterator: r.KVReader.PrefixIterator(prefix), cipher: r.cipher}
+}
+
+func (r *encryptedReader) RangeIterator(start, end []byte) store.KVIterator {
+	return &encryptedIterator{KVIterator: r.KVReader.RangeIterator(start, end), cipher: r.cipher}
+}
+
+type encryptedIterator struct {
+	store.KVIterator
+	cipher *secrets.Cipher
+}
+
+func (i *encryptedIterator) Value() []byte {
+	return i.open(i.KVIterator.Value())
+}
+
+func (i *encryptedIterator) Current() ([]byte, []byte, bool) {
+	k, v, ok := i.KVIterator.Current()
+	if !ok {
+		return k, v, ok
+	}
+	return k, i.open(v), ok
+}
+
+// iterators can't fail, so values that can't be decrypted are skipped as empty
+func (i *encryptedIterator) open(v []byte) []byte {
+	if v == nil {
+		return nil
+	}
+	res, err := i.cipher.Open(v)
+	if err != nil {
+		logrus.Error("Couldn't decrypt index value: ", err)
+		return nil
+	}
+	return res
+}
+
+type encryptedWriter struct {
+	store.KVWriter
+	cipher *secrets.Cipher
+}
+
+func (w *encryptedWriter) NewBatch() store.KVBatch {
+	return &encryptedBatch{KVBatch: w.KVWriter.NewBatch(), cipher: w.cipher}
+}
+
+func (w *encryptedWriter) NewBatchEx(options store.KVBatchOptions) ([]byte, store.KVBatch, error) {
+	buf, b, err := w.KVWriter.NewBatchEx(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	return buf, &encryptedBatch{KVBatch: b, cipher: w.cipher}, nil
+}
+
+func (w *encryptedWriter) ExecuteBatch(batch store.KVBatch) error {
+	b, ok := batch.(*encryptedBatch)
+	if !ok {
+		return errors.New("wrong type of batch")
+	}
+	if b.err != nil {
+		return b.err
+	}
+	return w.KVWriter.ExecuteBatch(b.KVBatch)
+}
+
+type encryptedBatch struct {
+	store.KVBatch
+	cipher *secrets.Cipher
+	err    error // batches can't fail until they're executed
+}
+
+func (b *encryptedBatch) Set(key, val []byte) {
+	sealed, err := b.cipher.Seal(val)
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.KVBatch.Set(key, sealed)
+}
+
+func (b *encryptedBatch) Reset() {
+	b.KVBatch.Reset()
+	b.err = nil
+}
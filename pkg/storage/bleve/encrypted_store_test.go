@@ -0,0 +1,82 @@
+package bleve_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/secrets"
+	"github.com/herval/cloudsearch/pkg/storage/bleve"
+)
+
+func newCipher(t testing.TB) *secrets.Cipher {
+	key, _ := secrets.RandomKey()
+	c, err := secrets.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEncryptedIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	c := newCipher(t)
+
+	s, err := bleve.OpenResultStorage(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := assertSave(cloudsearch.Result{
+		ContentType: cloudsearch.Email,
+		OriginalId:  "1",
+		Title:       "quarterly numbers",
+		Body:        "the quarterly numbers are attached",
+		Details:     map[string]interface{}{"to": "someone@example.com"},
+	}, s, t)
+	if _, err := s.ToggleFavorite(r.Id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	if res, err := s.Search(cloudsearch.Query{Text: "numbers"}); err != nil || len(res) != 1 || res[0].Body != r.Body || !res[0].Favorited {
+		t.Fatal("Should search the encrypted index ", err, res)
+	}
+	s.Close()
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "index"+strconv.Itoa(bleve.SchemaVersion)+".bleve", "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// terms are still there, but not what's stored (bodies, details, etc)
+	for _, plain := range []string{r.Body, `"to":"someone@example.com"`} {
+		if bytes.Contains(raw, []byte(plain)) {
+			t.Fatal("Should not store results in plaintext: ", plain)
+		}
+	}
+
+	if _, err := bleve.OpenResultStorage(dir, nil); err == nil {
+		t.Fatal("Should not open the index w/o the key")
+	}
+	if _, err := bleve.OpenResultStorage(dir, newCipher(t)); err == nil {
+		t.Fatal("Should not open the index w/ the wrong key")
+	}
+
+	s, err = bleve.OpenResultStorage(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if res, err := s.Get(r.Id); err != nil || res == nil || res.Title != r.Title {
+		t.Fatal("Should reopen the index w/ the key ", err, res)
+	}
+}
@@ -0,0 +1,82 @@
+package bleve
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/registry"
+)
+
+// a token filter replacing accented latin letters w/ their ascii versions, so "cafe" matches "café"
+const FoldingName = "asciiFolding"
+
+var folded = map[rune]string{}
+
+func init() {
+	for ascii, runes := range map[string]string{
+		"a":  "àáâãäåāăą",
+		"c":  "çćĉċč",
+		"d":  "ďđð",
+		"e":  "èéêëēĕėęě",
+		"g":  "ĝğġģ",
+		"h":  "ĥħ",
+		"i":  "ìíîïĩīĭįı",
+		"j":  "ĵ",
+		"k":  "ķ",
+		"l":  "ĺļľŀł",
+		"n":  "ñńņňŉ",
+		"o":  "òóôõöøōŏő",
+		"r":  "ŕŗř",
+		"s":  "śŝşš",
+		"t":  "ţťŧ",
+		"u":  "ùúûüũūŭůűų",
+		"w":  "ŵ",
+		"y":  "ýÿŷ",
+		"z":  "źżž",
+		"ae": "æ",
+		"oe": "œ",
+		"ss": "ß",
+		"th": "þ",
+	} {
+		for _, r := range runes {
+			folded[r] = ascii
+		}
+	}
+
+	registry.RegisterTokenFilter(FoldingName, func(config map[string]interface{}, cache *registry.Cache) (analysis.TokenFilter, error) {
+		return foldingFilter{}, nil
+	})
+}
+
+type foldingFilter struct{}
+
+func (f foldingFilter) Filter(input analysis.TokenStream) analysis.TokenStream {
+	for _, t := range input {
+		t.Term = []byte(fold(string(t.Term)))
+	}
+	return input
+}
+
+func fold(s string) string {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return s
+	}
+
+	b := strings.Builder{}
+	for _, r := range s {
+		if f, ok := folded[r]; ok {
+			b.WriteString(f)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
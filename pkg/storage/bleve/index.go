@@ -1,22 +1,22 @@
 package bleve
 
 import (
-	"github.com/herval/cloudsearch/pkg"
-	"fmt"
 	"github.com/blevesearch/bleve"
 	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/analysis/analyzer/simple"
 	"github.com/blevesearch/bleve/analysis/char/html"
 	"github.com/blevesearch/bleve/analysis/datetime/optional"
 	"github.com/blevesearch/bleve/analysis/token/camelcase"
 	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/tokenizer/single"
 	"github.com/blevesearch/bleve/analysis/tokenizer/web"
-	"os"
+	m "github.com/blevesearch/bleve/mapping"
 )
 
-func NewIndex(storagePath string, version string) (bleve.Index, error) {
+// how results are indexed. Changes here need a SchemaVersion bump.
+func NewMapping() (*m.IndexMappingImpl, error) {
 	var err error
-	path := cloudsearch.FileAt(storagePath, fmt.Sprintf("index" + version + ".bleve"))
 	mapping := bleve.NewIndexMapping()
 
 	lowerCase := bleve.NewTextFieldMapping()
@@ -38,7 +38,17 @@ func NewIndex(storagePath string, version string) (bleve.Index, error) {
 		"type":          custom.Name,
 		"char_filters":  []string{html.Name},
 		"tokenizer":     web.Name,
-		"token_filters": []string{camelcase.Name, lowercase.Name},
+		"token_filters": []string{camelcase.Name, lowercase.Name, FoldingName},
+	}); err != nil {
+		return nil, err
+	}
+
+	// whole values, case insensitive (eg labels, addresses)
+	exactAnalyser := "exactAnalyser"
+	if err = mapping.AddCustomAnalyzer(exactAnalyser, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     single.Name,
+		"token_filters": []string{lowercase.Name},
 	}); err != nil {
 		return nil, err
 	}
@@ -50,26 +60,99 @@ func NewIndex(storagePath string, version string) (bleve.Index, error) {
 	simpleContent := bleve.NewTextFieldMapping()
 	simpleContent.Analyzer = simple.Name
 
+	exact := bleve.NewTextFieldMapping()
+	exact.Analyzer = exactAnalyser
+	exact.IncludeTermVectors = false
+
+	// only used to find results, not to rebuild them
+	exactIndexed := bleve.NewTextFieldMapping()
+	exactIndexed.Analyzer = exactAnalyser
+	exactIndexed.IncludeTermVectors = false
+	exactIndexed.Store = false
+
+	id := bleve.NewTextFieldMapping()
+	id.Analyzer = keyword.Name
+	id.IncludeTermVectors = false
+
+	// only used to rebuild results
+	stored := bleve.NewTextFieldMapping()
+	stored.Index = false
+	stored.IncludeTermVectors = false
+	stored.IncludeInAll = false
+
+	numeric := bleve.NewNumericFieldMapping()
+
+	numericIndexed := bleve.NewNumericFieldMapping()
+	numericIndexed.Store = false
+
+	boolean := bleve.NewBooleanFieldMapping()
+
 	dateTime := bleve.NewDateTimeFieldMapping()
 
-	// bundle the entire thing together
-	d := bleve.NewDocumentMapping()
-	d.AddFieldMappingsAt("ContentType", lowerCase)
-	d.AddFieldMappingsAt("Title", keywordContent)
-	d.AddFieldMappingsAt("Permalink", lowerCase, simpleContent)
-	d.AddFieldMappingsAt("Body", keywordContent)
-	d.AddFieldMappingsAt("Timestamp", dateTime)
+	// stemmed w/ the result's language, only used to find results
+	stemmed := func(field string, lang string) *m.FieldMapping {
+		f := bleve.NewTextFieldMapping()
+		f.Name = languageField(field, lang)
+		f.Analyzer = languageAnalyser(lang)
+		f.Store = false
+		f.IncludeInAll = false
+		return f
+	}
 
-	mapping.AddDocumentMapping("searchableResult", d)
+	// bundle the entire thing together. Results are rebuilt from stored fields, so anything
+	// that's on a Result and isn't stored is lost.
+	result := func(lang string) *m.DocumentMapping {
+		d := bleve.NewDocumentMapping()
+		d.Dynamic = false
+		d.AddFieldMappingsAt("ContentType", lowerCase)
+		d.AddFieldMappingsAt("AccountType", lowerCase)
+		d.AddFieldMappingsAt("AccountId", id)
+		d.AddFieldMappingsAt("OriginalId", stored)
+		d.AddFieldMappingsAt("Permalink", simpleContent)
+		d.AddFieldMappingsAt("Thumbnail", stored)
+		d.AddFieldMappingsAt("People", simpleContent)
+		d.AddFieldMappingsAt("Labels", exact)
+		d.AddFieldMappingsAt("From", exactIndexed)
+		d.AddFieldMappingsAt("To", exactIndexed)
+		d.AddFieldMappingsAt("Owner", exactIndexed)
+		d.AddFieldMappingsAt("Extension", exactIndexed)
+		d.AddFieldMappingsAt("Language", exactIndexed)
+		d.AddFieldMappingsAt("Size", numericIndexed)
+		d.AddFieldMappingsAt("Status", numeric)
+		d.AddFieldMappingsAt("Unread", boolean)
+		d.AddFieldMappingsAt("Favorited", boolean)
+		d.AddFieldMappingsAt("InvolvesMe", boolean)
+		d.AddFieldMappingsAt("Timestamp", dateTime)
+		d.AddFieldMappingsAt("CachedAt", dateTime)
+		d.AddFieldMappingsAt("LastOpened", dateTime)
+		d.AddFieldMappingsAt("Details", stored)
+
+		if lang == "" {
+			d.AddFieldMappingsAt("Title", keywordContent)
+			d.AddFieldMappingsAt("Body", keywordContent)
+		} else {
+			d.AddFieldMappingsAt("Title", keywordContent, stemmed("Title", lang))
+			d.AddFieldMappingsAt("Body", keywordContent, stemmed("Body", lang))
+		}
+		return d
+	}
+
+	mapping.AddDocumentMapping(resultType(""), result(""))
+	for _, lang := range Languages {
+		mapping.AddDocumentMapping(resultType(lang), result(lang))
+	}
 	mapping.DefaultDateTimeParser = optional.Name
 	//mapping.DefaultAnalyzer = resultAnalyser
 
-	// this is defaulted to "searchableResult" for now, we can have more types maybe?
+	// results w/ a detected language get their own type (eg "searchableResult_pt")
 	mapping.TypeField = "Type"
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return bleve.New(path, mapping)
-	} else {
-		return bleve.Open(path)
+	return mapping, nil
+}
+
+func resultType(lang string) string {
+	if lang == "" {
+		return "searchableResult"
 	}
+	return "searchableResult_" + lang
 }
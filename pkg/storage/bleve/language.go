@@ -0,0 +1,113 @@
+package bleve
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/blevesearch/bleve/analysis"
+	"github.com/blevesearch/bleve/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/analysis/char/html"
+	"github.com/blevesearch/bleve/analysis/lang/de"
+	"github.com/blevesearch/bleve/analysis/lang/en"
+	"github.com/blevesearch/bleve/analysis/lang/es"
+	"github.com/blevesearch/bleve/analysis/lang/fr"
+	"github.com/blevesearch/bleve/analysis/lang/it"
+	"github.com/blevesearch/bleve/analysis/lang/pt"
+	"github.com/blevesearch/bleve/analysis/token/camelcase"
+	"github.com/blevesearch/bleve/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/analysis/token/porter"
+	"github.com/blevesearch/bleve/analysis/tokenizer/web"
+	"github.com/blevesearch/bleve/registry"
+)
+
+// languages w/ their own analyzers, in the order they're picked when detection is a tie
+var Languages = []string{"en", "pt", "de", "es", "fr", "it"}
+
+// stemming and stop words for each language, applied after lowercasing
+var languageFilters = map[string][]string{
+	"en": {en.PossessiveName, en.StopName, porter.Name},
+	"pt": {pt.StopName, pt.LightStemmerName},
+	"de": {de.StopName, de.NormalizeName, de.LightStemmerName},
+	"es": {es.StopName, es.LightStemmerName},
+	"fr": {fr.ElisionName, fr.StopName, fr.LightStemmerName},
+	"it": {it.ElisionName, it.StopName, it.LightStemmerName},
+}
+
+var stopWords = map[string]analysis.TokenMap{}
+
+// how much of a text is looked at, and how many stop words it takes to tell its language
+var (
+	detectedWords = 500
+	minStopWords  = 2
+)
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+func init() {
+	for lang, words := range map[string][]byte{
+		"en": en.EnglishStopWords,
+		"pt": pt.PortugueseStopWords,
+		"de": de.GermanStopWords,
+		"es": es.SpanishStopWords,
+		"fr": fr.FrenchStopWords,
+		"it": it.ItalianStopWords,
+	} {
+		stopWords[lang] = analysis.NewTokenMap()
+		if err := stopWords[lang].LoadBytes(words); err != nil {
+			panic(err)
+		}
+	}
+
+	// registered globally (and not on the mapping), so they can be used when searching indexes from older schemas too
+	for _, lang := range Languages {
+		filters := append([]string{camelcase.Name, lowercase.Name}, languageFilters[lang]...)
+		filters = append(filters, FoldingName)
+
+		registry.RegisterAnalyzer(languageAnalyser(lang), func(config map[string]interface{}, cache *registry.Cache) (*analysis.Analyzer, error) {
+			return custom.AnalyzerConstructor(map[string]interface{}{
+				"type":          custom.Name,
+				"char_filters":  []string{html.Name},
+				"tokenizer":     web.Name,
+				"token_filters": filters,
+			}, cache)
+		})
+	}
+}
+
+func languageAnalyser(lang string) string {
+	return "resultAnalyser_" + lang
+}
+
+// the field a language's analyzer is applied to (eg Body_pt)
+func languageField(field string, lang string) string {
+	return field + "_" + lang
+}
+
+// guess the language of a text by the stop words in it. Empty if it's none we have analyzers for.
+func DetectLanguage(text string) string {
+	if len(text) > detectedWords*20 {
+		text = text[:detectedWords*20]
+	}
+	words := strings.FieldsFunc(strings.ToLower(tags.ReplaceAllString(text, " ")), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	if len(words) > detectedWords {
+		words = words[:detectedWords]
+	}
+
+	detected, found := "", minStopWords-1
+	for _, lang := range Languages {
+		count := 0
+		for _, w := range words {
+			if _, ok := stopWords[lang][w]; ok {
+				count++
+			}
+		}
+		if count > found {
+			detected, found = lang, count
+		}
+	}
+
+	return detected
+}
@@ -0,0 +1,23 @@
+package bleve_test
+
+import (
+	"testing"
+
+	"github.com/herval/cloudsearch/pkg/storage/bleve"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	for text, lang := range map[string]string{
+		"The quarterly reports are in the shared folder":                        "en",
+		"Os relatórios de vendas estão na pasta do projeto":                     "pt",
+		"Die Berichte über den Umsatz sind in dem Ordner":                       "de",
+		"Los informes de ventas están en la carpeta del proyecto":               "es",
+		"Les rapports de ventes sont dans le dossier du projet":                 "fr",
+		"<p>Gli <b>appunti</b> della riunione sono nella cartella del progetto": "it",
+		"Q1 numbers": "",
+	} {
+		if detected := bleve.DetectLanguage(text); detected != lang {
+			t.Fatal("Should detect ", lang, " on ", text, ", got ", detected)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package bleve
+
+import (
+	"sync"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+)
+
+// a results storage that's only opened the first time it's used, so the key for the index
+// is only asked for by commands that need it
+type LazyStorage struct {
+	open func() (*WriteBehindStorage, error)
+
+	lock    sync.Mutex
+	storage *WriteBehindStorage
+	err     error // opening is only tried once (eg not to ask for a passphrase over and over)
+}
+
+func NewLazyStorage(open func() (*WriteBehindStorage, error)) *LazyStorage {
+	return &LazyStorage{open: open}
+}
+
+func (s *LazyStorage) get() (*WriteBehindStorage, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.storage == nil && s.err == nil {
+		s.storage, s.err = s.open()
+	}
+	return s.storage, s.err
+}
+
+// whether the storage was opened yet
+func (s *LazyStorage) Opened() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.storage != nil
+}
+
+// nothing to write back if it was never opened
+func (s *LazyStorage) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.storage != nil {
+		s.storage.Close()
+	}
+}
+
+func (s *LazyStorage) Save(result cloudsearch.Result) (cloudsearch.Result, error) {
+	st, err := s.get()
+	if err != nil {
+		return result, err
+	}
+	return st.Save(result)
+}
+
+func (s *LazyStorage) Merge(result cloudsearch.Result) (cloudsearch.Result, error) {
+	st, err := s.get()
+	if err != nil {
+		return result, err
+	}
+	return st.Merge(result)
+}
+
+func (s *LazyStorage) Search(query cloudsearch.Query) ([]cloudsearch.Result, error) {
+	st, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return st.Search(query)
+}
+
+func (s *LazyStorage) Matching(query cloudsearch.Query) (<-chan cloudsearch.Result, error) {
+	st, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return st.Matching(query)
+}
+
+func (s *LazyStorage) Get(resultId string) (*cloudsearch.Result, error) {
+	st, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return st.Get(resultId)
+}
+
+func (s *LazyStorage) MarkOpened(resultId string, at time.Time) error {
+	st, err := s.get()
+	if err != nil {
+		return err
+	}
+	return st.MarkOpened(resultId, at)
+}
+
+func (s *LazyStorage) All() (<-chan cloudsearch.Result, error) {
+	st, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return st.All()
+}
+
+func (s *LazyStorage) FindOlderThan(maxTime time.Time) (<-chan cloudsearch.Result, error) {
+	st, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return st.FindOlderThan(maxTime)
+}
+
+func (s *LazyStorage) FindCachedBefore(maxTime time.Time) (<-chan cloudsearch.Result, error) {
+	st, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return st.FindCachedBefore(maxTime)
+}
+
+func (s *LazyStorage) DeleteAllFromAccount(accountId string) ([]string, error) {
+	st, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return st.DeleteAllFromAccount(accountId)
+}
+
+func (s *LazyStorage) Delete(resultId string) error {
+	st, err := s.get()
+	if err != nil {
+		return err
+	}
+	return st.Delete(resultId)
+}
+
+func (s *LazyStorage) Size() (int64, error) {
+	st, err := s.get()
+	if err != nil {
+		return 0, err
+	}
+	return st.Size()
+}
+
+func (s *LazyStorage) Compact() error {
+	st, err := s.get()
+	if err != nil {
+		return err
+	}
+	return st.Compact()
+}
+
+func (s *LazyStorage) AllFavorited() ([]cloudsearch.Result, error) {
+	st, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return st.AllFavorited()
+}
+
+func (s *LazyStorage) AllFavoritedIds() ([]string, error) {
+	st, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	return st.AllFavoritedIds()
+}
+
+func (s *LazyStorage) IsFavorite(resultId string) (bool, error) {
+	st, err := s.get()
+	if err != nil {
+		return false, err
+	}
+	return st.IsFavorite(resultId)
+}
+
+func (s *LazyStorage) ToggleFavorite(resultId string) (bool, error) {
+	st, err := s.get()
+	if err != nil {
+		return false, err
+	}
+	return st.ToggleFavorite(resultId)
+}
+
+func (s *LazyStorage) Check() (cloudsearch.IndexStats, error) {
+	st, err := s.get()
+	if err != nil {
+		return cloudsearch.IndexStats{}, err
+	}
+	return st.Check()
+}
@@ -0,0 +1,54 @@
+package bleve_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/storage/bleve"
+)
+
+func TestLazyStorage(t *testing.T) {
+	opens := 0
+	s := bleve.NewLazyStorage(func() (*bleve.WriteBehindStorage, error) {
+		opens++
+		return writeBehind(t, 1000, time.Hour), nil
+	})
+
+	s.Close()
+	if opens != 0 || s.Opened() {
+		t.Fatal("Should not open the storage until it's used")
+	}
+
+	r, err := s.Merge(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found, err := s.Get(r.Id); err != nil || found == nil {
+		t.Fatal("Should find saved results ", err, found)
+	}
+	if stats, err := s.Check(); err != nil || stats.SchemaVersion != bleve.SchemaVersion {
+		t.Fatal("Should check the index ", err, stats)
+	}
+	if opens != 1 || !s.Opened() {
+		t.Fatal("Should open the storage once ", opens)
+	}
+	s.Close()
+}
+
+func TestLazyStorageFailingToOpen(t *testing.T) {
+	opens := 0
+	s := bleve.NewLazyStorage(func() (*bleve.WriteBehindStorage, error) {
+		opens++
+		return nil, errors.New("no key")
+	})
+	defer s.Close()
+
+	if _, err := s.Search(cloudsearch.Query{Text: "foo"}); err == nil {
+		t.Fatal("Should fail w/o a storage")
+	}
+	if _, err := s.All(); err == nil || opens != 1 {
+		t.Fatal("Should only try to open the storage once ", err, opens)
+	}
+}
@@ -0,0 +1,158 @@
+package bleve
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	bl "github.com/blevesearch/bleve"
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/secrets"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// bumped whenever the mapping or what's indexed changes, so existing indexes get rebuilt
+const SchemaVersion = 4
+
+var schemaVersionKey = []byte("schemaVersion")
+
+// indexes from before schemas were versioned are version 0
+func indexPath(storagePath string, version int) string {
+	if version == 0 {
+		return cloudsearch.FileAt(storagePath, "index.bleve")
+	}
+	return cloudsearch.FileAt(storagePath, fmt.Sprintf("index%d.bleve", version))
+}
+
+func SchemaVersionOf(index bl.Index) (int, error) {
+	v, err := index.GetInternal(schemaVersionKey)
+	if err != nil || v == nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(v))
+}
+
+func setSchemaVersion(index bl.Index, version int) error {
+	return index.SetInternal(schemaVersionKey, []byte(strconv.Itoa(version)))
+}
+
+// the results storage for the current schema. Results on an index from an older schema are migrated in
+// the background, and searched on the old index until that's done. Stored results are encrypted w/ the
+// cipher, if there's one.
+func OpenResultStorage(storagePath string, c *secrets.Cipher) (*BleveResultStorage, error) {
+	path := indexPath(storagePath, SchemaVersion)
+
+	if _, err := os.Stat(path); err == nil {
+		index, err := openIndex(path, c)
+		if err != nil {
+			return nil, err
+		}
+		if v, err := SchemaVersionOf(index); err == nil && v == SchemaVersion {
+			return newEncryptedStorage(index, c), nil
+		}
+
+		// the version is only set once a migration is done
+		logrus.Info("Removing incomplete index: ", path)
+		index.Close()
+		if err := os.RemoveAll(path); err != nil {
+			return nil, err
+		}
+	}
+
+	mapping, err := NewMapping()
+	if err != nil {
+		return nil, err
+	}
+	current, err := newIndex(path, mapping, c)
+	if err != nil {
+		return nil, err
+	}
+
+	olds := olderIndexes(storagePath)
+	if len(olds) > 0 {
+		old, err := openIndex(olds[0], c)
+		if err == nil {
+			logrus.Info("Migrating index ", olds[0], " to schema version ", SchemaVersion)
+			s := newEncryptedStorage(old, c)
+			s.migrated = make(chan bool)
+			go s.migrate(current, olds)
+			return s, nil
+		}
+		logrus.Error("Couldn't open the old index, starting from scratch: ", err)
+	}
+
+	if err := setSchemaVersion(current, SchemaVersion); err != nil {
+		current.Close()
+		return nil, err
+	}
+	return newEncryptedStorage(current, c), nil
+}
+
+// indexes from previous schemas, most recent first
+func olderIndexes(storagePath string) []string {
+	res := []string{}
+	for v := SchemaVersion - 1; v >= 0; v-- {
+		if _, err := os.Stat(indexPath(storagePath, v)); err == nil {
+			res = append(res, indexPath(storagePath, v))
+		}
+	}
+	return res
+}
+
+func (s *BleveResultStorage) migrate(into bl.Index, olds []string) {
+	defer close(s.migrated)
+
+	m := cloudsearch.NewStopwatch("migrate_index")
+	old, err := s.rebuild(into)
+	if err != nil {
+		// it'll be tried again next time
+		logrus.Error("Couldn't migrate the index: ", err)
+		into.Close()
+		return
+	}
+	m.Lap()
+
+	if err := old.Close(); err != nil {
+		logrus.Error("Couldn't close the old index: ", err)
+	}
+	if err := setSchemaVersion(into, SchemaVersion); err != nil {
+		logrus.Error("Couldn't set the index schema version: ", err)
+		return
+	}
+	for _, path := range olds {
+		if err := os.RemoveAll(path); err != nil {
+			logrus.Error("Couldn't remove old index ", path, ": ", err)
+		}
+	}
+	logrus.Info("Index migrated to schema version ", SchemaVersion)
+}
+
+// block until a background migration is done, if there's one
+func (s *BleveResultStorage) WaitMigration() {
+	if s.migrated != nil {
+		<-s.migrated
+	}
+}
+
+func (s *BleveResultStorage) isClosed() bool {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	return s.closed
+}
+
+// stop whatever migration is going on and close the index
+func (s *BleveResultStorage) Close() {
+	s.stateLock.Lock()
+	if s.closed {
+		s.stateLock.Unlock()
+		return
+	}
+	s.closed = true
+	s.stateLock.Unlock()
+
+	s.WaitMigration()
+	if err := s.current.Close(); err != nil {
+		logrus.Error("Couldn't close the index: ", errors.Wrap(err, s.index.Name()))
+	}
+}
@@ -0,0 +1,73 @@
+package bleve_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	bl "github.com/blevesearch/bleve"
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/storage/bleve"
+)
+
+func TestMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudsearch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an index from before schemas were versioned, where results were kept as json
+	legacy, err := bl.New(filepath.Join(dir, "index.bleve"), bl.NewIndexMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := &cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1", Title: "foo", CachedAt: time.Now(), Labels: []string{"a", "b"}}
+	saved.SetId()
+	data, _ := json.Marshal(saved)
+	if err := legacy.Index(saved.Id, map[string]interface{}{"Title": saved.Title, "OriginalData": string(data)}); err != nil {
+		t.Fatal(err)
+	}
+	legacy.Close()
+
+	// and one from a migration that didn't finish
+	incomplete := rawIndex(t, filepath.Join(dir, "index"+strconv.Itoa(bleve.SchemaVersion)+".bleve"))
+	stray := assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "2", Title: "foo"}, bleve.NewBleveResultStorage(incomplete), t)
+	incomplete.Close()
+
+	// results get encrypted when they're migrated
+	c := newCipher(t)
+	s, err := bleve.OpenResultStorage(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := s.Search(cloudsearch.Query{Text: "foo"}); err != nil || len(res) != 1 {
+		t.Fatal("Should be searchable while migrating ", err, res)
+	}
+	s.WaitMigration()
+
+	if r, err := s.Get(saved.Id); err != nil || r == nil || !r.CachedAt.Equal(saved.CachedAt) || len(r.Labels) != 2 {
+		t.Fatal("Should migrate results as they were ", err, r)
+	}
+	if r, _ := s.Get(stray.Id); r != nil {
+		t.Fatal("Should start incomplete migrations over ", r)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.bleve")); !os.IsNotExist(err) {
+		t.Fatal("Should remove the old index ", err)
+	}
+	s.Close()
+
+	// already migrated
+	s, err = bleve.OpenResultStorage(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if r, err := s.Get(saved.Id); err != nil || r == nil {
+		t.Fatal("Should reopen the migrated index ", err, r)
+	}
+}
@@ -8,31 +8,58 @@ import (
 	"github.com/blevesearch/bleve/search"
 	"github.com/blevesearch/bleve/search/query"
 	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/secrets"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"strings"
+	"sync"
 	"time"
 )
 
 type BleveResultStorage struct {
-	index   bl.Index
+	index   bl.IndexAlias // searches keep going to the same alias when the index underneath is rebuilt
+	current bl.Index
 	mapping m.IndexMapping
+	cipher  *secrets.Cipher // for indexes created when compacting or migrating, when the index is encrypted
+
+	writeLock  sync.RWMutex // writes stop while indexes are swapped
+	rebuilding bool
+	migrated   chan bool // closed once a background migration is done
+
+	stateLock sync.Mutex
+	dirty     map[string]bool // written while rebuilding, so they're copied again before swapping
+	closed    bool
 }
 
 // store a Result in a search-optimized way
 type searchableResult struct {
-	Body        string
+	Type string
+
+	AccountId   string
+	AccountType string
+	ContentType string
+	OriginalId  string
 	Title       string
 	Permalink   string
-	Labels      string // space-separated list of labels
-	Timestamp   time.Time
-	Type        string
-	ContentType string
-	AccountType string
+	Thumbnail   string
+	Body        string
+	People      string // senders and recipients, for matching on names
+	Labels      []string
+	From        []string // addresses only
+	To          []string
+	Owner       string
+	Extension   string
+	Language    string
+	Size        int64
+	Status      int
+	Unread      bool
 	Favorited   bool
-	AccountId   string
+	InvolvesMe  bool
+	Timestamp   time.Time
+	CachedAt    time.Time
+	LastOpened  time.Time
 
-	OriginalData string // a serializable json version of the Result
+	Details string // json, as it varies w/ each service
 }
 
 func NewBleveResultStorage(index bl.Index) cloudsearch.ResultsStorage {
@@ -42,10 +69,41 @@ func NewBleveResultStorage(index bl.Index) cloudsearch.ResultsStorage {
 		logrus.Debug("Opening index w/ docs: ", docs)
 	}
 
+	return newStorage(index)
+}
+
+func newStorage(index bl.Index) *BleveResultStorage {
+	alias := bl.NewIndexAlias(index)
+	alias.SetName(index.Name())
+
 	return &BleveResultStorage{
-		index:   index,
+		index:   alias,
+		current: index,
 		mapping: index.Mapping(),
+		dirty:   map[string]bool{},
+	}
+}
+
+func newEncryptedStorage(index bl.Index, c *secrets.Cipher) *BleveResultStorage {
+	s := newStorage(index)
+	s.cipher = c
+	return s
+}
+
+// writes on the index are kept track of while it's being rebuilt
+func (s *BleveResultStorage) write(ids []string, write func() error) error {
+	s.writeLock.RLock()
+	defer s.writeLock.RUnlock()
+
+	if s.rebuilding {
+		s.stateLock.Lock()
+		for _, id := range ids {
+			s.dirty[id] = true
+		}
+		s.stateLock.Unlock()
 	}
+
+	return write()
 }
 
 func (f *BleveResultStorage) DeleteAllFromAccount(accountId string) ([]string, error) {
@@ -56,9 +114,15 @@ func (f *BleveResultStorage) DeleteAllFromAccount(accountId string) ([]string, e
 		return nil, err
 	}
 
-	var ret []string
+	// don't delete while iterating, as that shifts the pages under the iterator
+	ids := []string{}
 	for r := range res {
-		err = f.index.Delete(r)
+		ids = append(ids, r)
+	}
+
+	var ret []string
+	for _, r := range ids {
+		err = f.Delete(r)
 		if err != nil {
 			logrus.Error("Deleting ", err)
 		} else {
@@ -88,9 +152,25 @@ func (f *BleveResultStorage) AllFavoritedIds() ([]string, error) {
 func (s *BleveResultStorage) FindOlderThan(maxTime time.Time) (<-chan cloudsearch.Result, error) {
 	var zero time.Time
 
-	d, err := s.findIds(
-		timeRange("Timestamp", &zero, &maxTime),
+	return s.findAll(
+		timeRange("Timestamp", &maxTime, &zero),
+	)
+}
+
+func (s *BleveResultStorage) FindCachedBefore(maxTime time.Time) (<-chan cloudsearch.Result, error) {
+	var zero time.Time
+
+	return s.findAll(
+		timeRange("CachedAt", &maxTime, &zero),
 	)
+}
+
+func (s *BleveResultStorage) All() (<-chan cloudsearch.Result, error) {
+	return s.findAll(bl.NewMatchAllQuery())
+}
+
+func (s *BleveResultStorage) findAll(q query.Query) (<-chan cloudsearch.Result, error) {
+	d, err := s.findIds(q)
 
 	res := make(chan cloudsearch.Result)
 	go func() {
@@ -112,7 +192,9 @@ func (s *BleveResultStorage) FindOlderThan(maxTime time.Time) (<-chan cloudsearc
 }
 
 func (s *BleveResultStorage) Delete(resultId string) error {
-	err := s.index.Delete(resultId)
+	err := s.write([]string{resultId}, func() error {
+		return s.index.Delete(resultId)
+	})
 	if err != nil {
 		return err
 	}
@@ -150,10 +232,6 @@ func (s *BleveResultStorage) findIds(q query.Query) (<-chan string, error) {
 	return res, nil
 }
 
-func (s *BleveResultStorage) Close() {
-	_ = s.index.Close()
-}
-
 func (s *BleveResultStorage) Get(resultId string) (*cloudsearch.Result, error) {
 	doc, err := s.index.Document(resultId)
 	if err != nil {
@@ -178,6 +256,9 @@ func (s *BleveResultStorage) Merge(r cloudsearch.Result) (cloudsearch.Result, er
 	if existing != nil {
 		// maintain status/avoid overriding existing preferences
 		r.Favorited = existing.Favorited
+		if r.LastOpened.IsZero() {
+			r.LastOpened = existing.LastOpened
+		}
 		// TODO add other stuff here (eg scores)
 	}
 
@@ -185,6 +266,18 @@ func (s *BleveResultStorage) Merge(r cloudsearch.Result) (cloudsearch.Result, er
 }
 
 func (s *BleveResultStorage) Save(result cloudsearch.Result) (cloudsearch.Result, error) {
+	result, err := prepare(result)
+	if err != nil {
+		return result, err
+	}
+
+	return result, s.write([]string{result.Id}, func() error {
+		return s.index.Index(result.Id, searchable(result))
+	})
+}
+
+// validate a result and set what's set on every save (eg cache time)
+func prepare(result cloudsearch.Result) (cloudsearch.Result, error) {
 	if result.OriginalId == "" {
 		logrus.WithField("result", result).Debug("original id is empty!")
 		return result, errors.New("original id must be set")
@@ -215,7 +308,7 @@ func (s *BleveResultStorage) Save(result cloudsearch.Result) (cloudsearch.Result
 	result.Timestamp = result.Timestamp.Truncate(time.Second)
 	result.CachedAt = result.CachedAt.Truncate(time.Second)
 
-	return result, s.index.Index(result.Id, searchable(result))
+	return result, nil
 }
 
 func (f *BleveResultStorage) IsFavorite(resultId string) (bool, error) {
@@ -228,6 +321,19 @@ func (f *BleveResultStorage) IsFavorite(resultId string) (bool, error) {
 	return res != nil && res.Favorited, nil
 }
 
+// indexed as-is, so opening a result doesn't count as refreshing it
+func (s *BleveResultStorage) MarkOpened(resultId string, at time.Time) error {
+	res, err := s.Get(resultId)
+	if err != nil || res == nil {
+		return err
+	}
+
+	res.LastOpened = at.Truncate(time.Second)
+	return s.write([]string{resultId}, func() error {
+		return s.index.Index(resultId, searchable(*res))
+	})
+}
+
 func (f *BleveResultStorage) ToggleFavorite(resultId string) (bool, error) {
 	res, err := f.Get(resultId)
 	if err != nil {
@@ -265,23 +371,56 @@ func (f *BleveResultStorage) AllFavorited() ([]cloudsearch.Result, error) {
 }
 
 func searchable(result cloudsearch.Result) searchableResult {
-	d, _ := json.Marshal(result)
+	d, _ := json.Marshal(result.Details)
+	lang := DetectLanguage(result.Title + "\n" + result.Body)
 	return searchableResult{
-		Body:         result.Body,
-		Permalink:    result.Permalink,
-		Title:        result.Title,
-		Timestamp:    result.Timestamp,
-		OriginalData: string(d),
-		Type:         "searchableResult",
-		AccountId:    result.AccountId,
-		AccountType:  string(result.AccountType),
-		ContentType:  string(result.ContentType),
+		Type:        resultType(lang),
+		AccountId:   result.AccountId,
+		AccountType: string(result.AccountType),
+		ContentType: string(result.ContentType),
+		OriginalId:  result.OriginalId,
+		Title:       result.Title,
+		Permalink:   result.Permalink,
+		Thumbnail:   result.Thumbnail,
+		Body:        result.Body,
+		People:      people(result),
+		Labels:      result.Labels,
+		From:        result.Addresses("from"),
+		To:          result.Addresses("to"),
+		Owner:       detail(result, "owner"),
+		Extension:   result.Extension(),
+		Language:    lang,
+		Size:        result.SizeBytes(),
+		Status:      int(result.Status),
+		Unread:      result.Unread,
+		Favorited:   result.Favorited,
+		InvolvesMe:  result.InvolvesMe,
+		Timestamp:   result.Timestamp,
+		CachedAt:    result.CachedAt,
+		LastOpened:  result.LastOpened,
+		Details:     string(d),
+	}
+}
+
+func detail(r cloudsearch.Result, name string) string {
+	s, _ := r.Details[name].(string)
+	return s
+}
+
+func people(r cloudsearch.Result) string {
+	res := []string{}
+	for _, k := range []string{"from", "to"} {
+		if p, ok := r.Details[k].(string); ok && p != "" {
+			res = append(res, p)
+		}
 	}
+	return strings.Join(res, " ")
 }
 
 // finds a single page of results
 func (s *BleveResultStorage) find(q query.Query) ([]cloudsearch.Result, error) {
 	req := bl.NewSearchRequestOptions(q, 20, 0, false)
+	req.IncludeLocations = true // for highlighting
 
 	res, err := s.index.Search(req)
 	if err != nil {
@@ -295,39 +434,75 @@ func (s *BleveResultStorage) find(q query.Query) ([]cloudsearch.Result, error) {
 func (s *BleveResultStorage) Search(q cloudsearch.Query) ([]cloudsearch.Result, error) {
 	logrus.Debug("Searching Cache: ", q)
 
+	union, err := searchQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO increase the score for newer content
+	// TODO time ranges
+	// TODO accounts
+
+	return s.find(union)
+}
+
+func (s *BleveResultStorage) Matching(q cloudsearch.Query) (<-chan cloudsearch.Result, error) {
+	sq, err := searchQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return s.findAll(sq)
+}
+
+func searchQuery(q cloudsearch.Query) (query.Query, error) {
 	subqueries := []query.Query{
 		anyOf(matchTypes(contentTypeStrings(q.ContentTypes), "ContentType")...),  // match any content type provided
 		anyOf(matchTypes(accountTypesStrings(q.AccountTypes), "AccountType")...), // match any account type provided
+		anyOf(matchTypes(q.AccountIds, "AccountId")...),                          // match any account provided
 		timeRange("Timestamp", q.Before, q.After),
+		anyOf(terms(q.From, "From")...),
+		anyOf(terms(q.To, "To")...),
+		anyOf(terms(q.Owners, "Owner")...),
+		anyOf(terms(q.Extensions, "Extension")...),
+		sizeRange(q.MinSize, q.MaxSize),
+	}
+	if q.Unread {
+		subqueries = append(subqueries, matchBool(true, "Unread", 1))
 	}
 
 	// empty searches for content types may still yield results
 	str := strings.Trim(q.Text, " ")
 	if str != "" {
-		subqueries = append(subqueries,
-			anyOf( // any match on body, title, permalink
-				match(q.Text, "Title", 3),
-				match(q.Text, "Body", 3),
-				prefix(q.Text, "Title", 2),
-				prefix(q.Text, "Body", 2),
-				prefix(q.Text, "Permalink", 1),
-				fuzzy(q.Text, "Title", 1.5),
-				fuzzy(q.Text, "Body", 1.5),
-			),
-		)
-	}
-
-	if str == "" && len(q.ContentTypes) == 0 {
-		return nil, errors.New("Cannot search - empty query")
-	}
+		// terms aren't analyzed on prefix and fuzzy queries
+		terms := fold(strings.ToLower(q.Text))
+
+		matches := []query.Query{ // any match on body, title, permalink
+			match(q.Text, "Title", 3),
+			match(q.Text, "Body", 3),
+			match(q.Text, "People", 2),
+			match(q.Text, "Labels", 1),
+			prefix(terms, "Title", 2),
+			prefix(terms, "Body", 2),
+			prefix(terms, "Permalink", 1),
+			fuzzy(terms, "Title", 1.5),
+			fuzzy(terms, "Body", 1.5),
+		}
+		// stemmed matches on results in each language, analyzed the same way they were indexed
+		for _, lang := range Languages {
+			matches = append(matches,
+				matchAnalysed(q.Text, languageField("Title", lang), languageAnalyser(lang), 2),
+				matchAnalysed(q.Text, languageField("Body", lang), languageAnalyser(lang), 2),
+			)
+		}
 
-	union := allOf(subqueries...)
+		subqueries = append(subqueries, anyOf(matches...))
+	}
 
-	// TODO increase the score for newer content
-	// TODO time ranges
-	// TODO accounts
+	if str == "" && len(q.ContentTypes) == 0 && !q.HasFieldFilters() {
+		return nil, errors.New("Cannot search - empty query")
+	}
 
-	return s.find(union)
+	return allOf(subqueries...), nil
 }
 
 func (f *BleveResultStorage) Truncate() error {
@@ -337,7 +512,13 @@ func (f *BleveResultStorage) Truncate() error {
 		return err
 	}
 
+	// don't delete while iterating, as that shifts the pages under the iterator
+	all := []string{}
 	for i := range ids {
+		all = append(all, i)
+	}
+
+	for _, i := range all {
 		err = f.Delete(i)
 		if err != nil {
 			return err
@@ -362,6 +543,7 @@ func toResults(index bl.Index, hits search.DocumentMatchCollection) ([]cloudsear
 			// TODO clean up the record?
 		}
 		if r != nil {
+			r.Snippet = snippetFor(*r, h.Locations)
 			res = append(res, *r)
 		}
 	}
@@ -369,6 +551,35 @@ func toResults(index bl.Index, hits search.DocumentMatchCollection) ([]cloudsear
 	return res, nil
 }
 
+// highlight the terms matched on the Body (or the Title, if nothing matched there)
+func snippetFor(r cloudsearch.Result, locations search.FieldTermLocationMap) *cloudsearch.Snippet {
+	fields := map[string]string{
+		"Body":  r.Body,
+		"Title": r.Title,
+	}
+
+	// stemmed fields (eg Body_en) have the same offsets as the fields they come from
+	matches := map[string][]cloudsearch.Match{}
+	for field, terms := range locations {
+		f := strings.SplitN(field, "_", 2)[0]
+		for _, locs := range terms {
+			for _, l := range locs {
+				matches[f] = append(matches[f], cloudsearch.Match{Start: int(l.Start), End: int(l.End)})
+			}
+		}
+	}
+
+	for _, f := range []string{"Body", "Title"} {
+		matches := matches[f]
+
+		if s := cloudsearch.NewSnippet(f, fields[f], matches); s != nil {
+			return s
+		}
+	}
+
+	return nil
+}
+
 func timeRange(field string, before *time.Time, after *time.Time) query.Query {
 	if before == nil && after == nil {
 		return nil
@@ -389,6 +600,37 @@ func timeRange(field string, before *time.Time, after *time.Time) query.Query {
 	return q
 }
 
+// exact values, on fields indexed as a single lowercased term
+func terms(values []string, field string) []query.Query {
+	res := []query.Query{}
+	for _, v := range values {
+		q := bl.NewTermQuery(strings.ToLower(v))
+		q.SetField(field)
+		res = append(res, q)
+	}
+	return res
+}
+
+func sizeRange(min *int64, max *int64) query.Query {
+	if min == nil && max == nil {
+		return nil
+	}
+
+	var from, to *float64
+	if min != nil {
+		f := float64(*min)
+		from = &f
+	}
+	if max != nil {
+		t := float64(*max)
+		to = &t
+	}
+	n := false
+	q := bl.NewNumericRangeInclusiveQuery(from, to, &n, &n)
+	q.SetField("Size")
+	return q
+}
+
 func allOf(queries ...query.Query) query.Query {
 	res := []query.Query{}
 	for _, q := range queries {
@@ -426,6 +668,14 @@ func match(query string, field string, boost float64) query.Query {
 	return mm
 }
 
+func matchAnalysed(query string, field string, analyser string, boost float64) query.Query {
+	mm := bl.NewMatchQuery(query)
+	mm.SetField(field)
+	mm.Analyzer = analyser
+	mm.SetBoost(boost)
+	return mm
+}
+
 func matchBool(boolean bool, field string, boost float64) query.Query {
 	mm := bl.NewBoolFieldQuery(boolean)
 	mm.SetField(field)
@@ -448,70 +698,98 @@ func fuzzy(query string, field string, boost float64) *query.FuzzyQuery {
 	return fuzzyMatch
 }
 
-type bleveResult struct {
-	ID     string                 `json:"id"`
-	Fields map[string]interface{} `json:"fields"`
-}
-
+// rebuild a result from its stored fields
 func toResult(doc *document.Document, hitScore float64) (*cloudsearch.Result, error) {
 	if doc == nil {
 		return nil, nil
 	}
 
-	// first map it all to a bleve result thing
-	rv := bleveResult{
-		ID:     doc.ID,
-		Fields: map[string]interface{}{},
-	}
-	for _, field := range doc.Fields {
-		var newval interface{}
-		switch field := field.(type) {
-		case *document.TextField:
-			newval = string(field.Value())
-			// no need for any of this w/ current impl
-			//case *document.NumericField:
-			//	n, err := field.Number()
-			//	if err == nil {
-			//		newval = n
-			//	}
-			//case *document.BooleanField:
-			//	d, err := field.Boolean()
-			//	if err == nil {
-			//		newval = d
-			//	}
-			//case *document.DateTimeField:
-			//	d, err := field.DateTime()
-			//	if err == nil {
-			//		newval = d.Format(time.RFC3339Nano)
-			//	}
+	res := cloudsearch.Result{
+		Id:            doc.ID,
+		CacheHitScore: hitScore,
+	}
+	var err error
+	for _, f := range doc.Fields {
+		switch f.Name() {
+		case "AccountId":
+			res.AccountId = text(f)
+		case "AccountType":
+			res.AccountType = cloudsearch.AccountType(text(f))
+		case "ContentType":
+			res.ContentType = cloudsearch.ContentType(text(f))
+		case "OriginalId":
+			res.OriginalId = text(f)
+		case "Title":
+			res.Title = text(f)
+		case "Permalink":
+			res.Permalink = text(f)
+		case "Thumbnail":
+			res.Thumbnail = text(f)
+		case "Body":
+			res.Body = text(f)
+		case "Labels":
+			res.Labels = append(res.Labels, text(f))
+		case "Status":
+			var s float64
+			s, err = numeric(f)
+			res.Status = cloudsearch.ResultStatus(s)
+		case "Unread":
+			res.Unread, err = boolean(f)
+		case "Favorited":
+			res.Favorited, err = boolean(f)
+		case "InvolvesMe":
+			res.InvolvesMe, err = boolean(f)
+		case "Timestamp":
+			res.Timestamp, err = dateTime(f)
+		case "CachedAt":
+			res.CachedAt, err = dateTime(f)
+		case "LastOpened":
+			res.LastOpened, err = dateTime(f)
+		case "Details":
+			err = json.Unmarshal(f.Value(), &res.Details)
+		case "OriginalData": // indexes from before schema version 2 only had the json, so they can be migrated
+			legacy := cloudsearch.Result{}
+			if err := json.Unmarshal(f.Value(), &legacy); err != nil {
+				return nil, errors.Wrap(err, f.Name())
+			}
+			legacy.CacheHitScore = hitScore
+			return &legacy, nil
 		}
 
-		existing, existed := rv.Fields[field.Name()]
-		if existed {
-			switch existing := existing.(type) {
-			case []interface{}:
-				rv.Fields[field.Name()] = append(existing, newval)
-			case interface{}:
-				arr := make([]interface{}, 2)
-				arr[0] = existing
-				arr[1] = newval
-				rv.Fields[field.Name()] = arr
-			}
-		} else {
-			//fmt.Println(field, newval)
-			rv.Fields[field.Name()] = newval
+		if err != nil {
+			return nil, errors.Wrap(err, f.Name())
 		}
 	}
 
-	// then map all fields
-	res := cloudsearch.Result{}
-	err := json.Unmarshal([]byte(rv.Fields["OriginalData"].(string)), &res)
-	if err != nil {
-		return nil, err
+	return &res, nil
+}
+
+func text(f document.Field) string {
+	return string(f.Value())
+}
+
+func numeric(f document.Field) (float64, error) {
+	n, ok := f.(*document.NumericField)
+	if !ok {
+		return 0, errors.New("not a number")
 	}
-	res.CacheHitScore = hitScore
+	return n.Number()
+}
 
-	return &res, nil
+func boolean(f document.Field) (bool, error) {
+	b, ok := f.(*document.BooleanField)
+	if !ok {
+		return false, errors.New("not a boolean")
+	}
+	return b.Boolean()
+}
+
+func dateTime(f document.Field) (time.Time, error) {
+	d, ok := f.(*document.DateTimeField)
+	if !ok {
+		return time.Time{}, errors.New("not a date")
+	}
+	return d.DateTime()
 }
 
 func accountTypesStrings(c []cloudsearch.AccountType) []string {
@@ -1,28 +1,41 @@
 package bleve_test
 
 import (
+	bl "github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/search/query"
 	"github.com/herval/cloudsearch/pkg"
 	"github.com/herval/cloudsearch/pkg/storage/bleve"
 	"github.com/herval/cloudsearch/pkg/test"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 )
 
-func searchable(t *testing.T) *bleve.BleveResultStorage {
-	index, err := bleve.NewIndex("./", "")
+// an empty, encrypted storage
+func searchable(t testing.TB) *bleve.BleveResultStorage {
+	s, err := bleve.OpenResultStorage(t.TempDir(), newCipher(t))
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	s := bleve.NewBleveResultStorage(index).(*bleve.BleveResultStorage)
-
-	err = s.Truncate()
-	//if err != nil {
-	//	t.Fatal("Couldnt truncate ", err)
-	//}
-
 	return s
 }
 
+// an unencrypted index w/ the results mapping (and no schema version), to look at what gets indexed
+func rawIndex(t testing.TB, path string) bl.Index {
+	mapping, err := bleve.NewMapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := bl.New(path, mapping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return index
+}
+
 func assertSave(r cloudsearch.Result, s cloudsearch.ResultsStorage, t *testing.T) *cloudsearch.Result {
 	r, err := s.Save(r)
 	if err != nil {
@@ -90,3 +103,304 @@ func TestContentTypeQuery(t *testing.T) {
 	}
 
 }
+
+func TestMatching(t *testing.T) {
+	s := searchable(t)
+	defer s.Close()
+
+	// early in the month, so going back a month doesn't skip one
+	y, m, _ := time.Now().Date()
+	now := time.Date(y, m, 2, 0, 0, 0, 0, time.UTC)
+	for i, r := range []cloudsearch.Result{
+		{ContentType: cloudsearch.Email, AccountType: cloudsearch.Google, AccountId: "4ea6c1b258d360c95d04eefca4e4151e", Title: "foo", Timestamp: now},
+		{ContentType: cloudsearch.Email, AccountType: cloudsearch.Google, AccountId: "4ea6c1b258d360c95d04eefca4e4151e", Title: "foo bar", Timestamp: now},
+		{ContentType: cloudsearch.Image, AccountType: cloudsearch.Dropbox, AccountId: "68fe3fb2eb897e53e1a5a6559e39a060", Title: "foo.png", Timestamp: now.AddDate(0, -1, 0)},
+		{ContentType: cloudsearch.Image, AccountType: cloudsearch.Dropbox, AccountId: "68fe3fb2eb897e53e1a5a6559e39a060", Title: "bar.png", Timestamp: now},
+	} {
+		r.OriginalId = strconv.Itoa(i)
+		assertSave(r, s, t)
+	}
+
+	found, err := s.Matching(cloudsearch.ParseQuery("foo", "", test.DefaultRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cloudsearch.NewFacetCounter()
+	for r := range found {
+		c.Add(r)
+	}
+	f := c.Facets()
+
+	if f.Get(cloudsearch.FacetType, "Email") != 2 || f.Get(cloudsearch.FacetType, "Image") != 1 {
+		t.Fatal("Should count matching results by type: ", f)
+	}
+	if f.Get(cloudsearch.FacetService, "Google") != 2 || f.Get(cloudsearch.FacetAccount, "68fe3fb2eb897e53e1a5a6559e39a060") != 1 {
+		t.Fatal("Should count matching results by service and account: ", f)
+	}
+	if f.Get(cloudsearch.FacetMonth, now.Format("2006-01")) != 2 || f.Get(cloudsearch.FacetMonth, now.AddDate(0, -1, 0).Format("2006-01")) != 1 {
+		t.Fatal("Should count matching results by month: ", f)
+	}
+}
+
+func TestFindCachedBefore(t *testing.T) {
+	s := searchable(t)
+	defer s.Close()
+	r := assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1"}, s, t)
+
+	count := func(maxTime time.Time) []string {
+		found, err := s.FindCachedBefore(maxTime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for f := range found {
+			ids = append(ids, f.Id)
+		}
+		return ids
+	}
+
+	if ids := count(time.Now().Add(time.Minute)); len(ids) != 1 || ids[0] != r.Id {
+		t.Fatal("Should find results cached before the given time ", ids)
+	}
+	if ids := count(time.Now().Add(-time.Hour)); len(ids) != 0 {
+		t.Fatal("Should not find results cached after the given time ", ids)
+	}
+}
+
+func TestFindOlderThan(t *testing.T) {
+	s := searchable(t)
+	defer s.Close()
+	now := time.Now()
+	old := assertSave(cloudsearch.Result{ContentType: cloudsearch.Email, OriginalId: "old", Timestamp: now.AddDate(-2, 0, 0)}, s, t)
+	assertSave(cloudsearch.Result{ContentType: cloudsearch.Email, OriginalId: "new", Timestamp: now}, s, t)
+
+	found, err := s.FindOlderThan(now.AddDate(-1, 0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for f := range found {
+		ids = append(ids, f.Id)
+	}
+	if len(ids) != 1 || ids[0] != old.Id {
+		t.Fatal("Should find results older than the given time ", ids)
+	}
+}
+
+func TestPruneExpired(t *testing.T) {
+	s := searchable(t)
+	defer s.Close()
+	now := time.Now()
+	old := assertSave(cloudsearch.Result{AccountId: "1", ContentType: cloudsearch.Email, OriginalId: "old", Timestamp: now.AddDate(-2, 0, 0)}, s, t)
+	recent := assertSave(cloudsearch.Result{AccountId: "1", ContentType: cloudsearch.Email, OriginalId: "new", Timestamp: now}, s, t)
+
+	policy := cloudsearch.RetentionPolicy{
+		Rules: []cloudsearch.RetentionRule{{ContentType: cloudsearch.Email, MaxAge: 365 * 24 * time.Hour}},
+	}
+	stats, err := cloudsearch.Prune(s, test.NewAccountsStorage(cloudsearch.AccountData{ID: "1"}), policy, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Expired != 1 {
+		t.Fatal("Should remove expired results ", stats)
+	}
+	if r, _ := s.Get(old.Id); r != nil {
+		t.Fatal("Should remove results older than the retention rules ", r)
+	}
+	if r, _ := s.Get(recent.Id); r == nil {
+		t.Fatal("Should keep recent results")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	s := searchable(t)
+	defer s.Close()
+
+	kept := assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "kept", Title: "foo"}, s, t)
+	for i := 0; i < 50; i++ {
+		r := assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: strconv.Itoa(i), Title: "foo bar"}, s, t)
+		if err := s.Delete(r.Id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.Compact(); err != nil {
+		t.Fatal("Should compact the index ", err)
+	}
+
+	r, err := s.Get(kept.Id)
+	if err != nil || r == nil || !r.CachedAt.Equal(kept.CachedAt) {
+		t.Fatal("Should keep results as they were ", err, r)
+	}
+
+	res, err := s.Search(cloudsearch.Query{Text: "foo"})
+	if err != nil || len(res) != 1 {
+		t.Fatal("Should still be searchable ", err, res)
+	}
+	if size, err := s.Size(); err != nil || size <= 0 {
+		t.Fatal("Should measure the index ", err, size)
+	}
+}
+
+func TestStructuredFields(t *testing.T) {
+	index := rawIndex(t, filepath.Join(t.TempDir(), "index.bleve"))
+	s := bleve.NewBleveResultStorage(index)
+	defer s.Close()
+
+	email := assertSave(cloudsearch.Result{
+		AccountId:   "Account-1",
+		AccountType: cloudsearch.Google,
+		ContentType: cloudsearch.Email,
+		OriginalId:  "1",
+		Title:       "quarterly report",
+		Body:        "numbers",
+		Timestamp:   time.Now(),
+		Labels:      []string{"INBOX", "UNREAD"},
+		Unread:      true,
+		Details: map[string]interface{}{
+			"from": "Foo Bar <Foo@bar.com>",
+			"to":   "baz@bar.com, Qux <qux@bar.com>",
+		},
+	}, s, t)
+	file := assertSave(cloudsearch.FileOrFolderResult(
+		"2", "/reports/q1.PDF", "q1.PDF", "", "", time.Now(), "https://dropbox.com/q1", 2048, "",
+		cloudsearch.AccountData{ID: "Account-2", AccountType: cloudsearch.Dropbox}, "", true, nil, false,
+	), s, t)
+	file.Details["owner"] = "owner@bar.com"
+	assertSave(*file, s, t)
+
+	r, err := s.Get(email.Id)
+	if err != nil || r == nil {
+		t.Fatal("Should find the result ", err, r)
+	}
+	if r.Title != email.Title || r.AccountId != email.AccountId || r.ContentType != cloudsearch.Email ||
+		!r.Unread || !reflect.DeepEqual(r.Labels, email.Labels) || r.Details["from"] != "Foo Bar <Foo@bar.com>" ||
+		!r.Timestamp.Equal(email.Timestamp) || !r.CachedAt.Equal(email.CachedAt) {
+		t.Fatal("Should rebuild results from stored fields ", r)
+	}
+
+	find := func(q query.Query) []string {
+		res, err := index.Search(bl.NewSearchRequest(q))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, h := range res.Hits {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+	term := func(field string, value string) query.Query {
+		q := bl.NewTermQuery(value)
+		q.SetField(field)
+		return q
+	}
+	min := float64(1024)
+	size := bl.NewNumericRangeQuery(&min, nil)
+	size.SetField("Size")
+	unread := bl.NewBoolFieldQuery(true)
+	unread.SetField("Unread")
+
+	for name, c := range map[string]struct {
+		q        query.Query
+		expected string
+	}{
+		"labels":    {term("Labels", "unread"), email.Id},
+		"from":      {term("From", "foo@bar.com"), email.Id},
+		"to":        {term("To", "qux@bar.com"), email.Id},
+		"owner":     {term("Owner", "owner@bar.com"), file.Id},
+		"extension": {term("Extension", "pdf"), file.Id},
+		"account":   {term("AccountId", "Account-2"), file.Id},
+		"size":      {size, file.Id},
+		"unread":    {unread, email.Id},
+	} {
+		if ids := find(c.q); len(ids) != 1 || ids[0] != c.expected {
+			t.Fatal("Should filter on ", name, ": ", ids)
+		}
+	}
+}
+
+func TestFieldQueries(t *testing.T) {
+	s := searchable(t)
+	defer s.Close()
+
+	email := assertSave(cloudsearch.Result{
+		AccountId:   "1",
+		AccountType: cloudsearch.Google,
+		ContentType: cloudsearch.Email,
+		OriginalId:  "1",
+		Title:       "quarterly report",
+		Unread:      true,
+		Details: map[string]interface{}{
+			"from": "Foo Bar <Foo@bar.com>",
+			"to":   "baz@bar.com, Qux <qux@bar.com>",
+		},
+	}, s, t)
+	file := cloudsearch.FileOrFolderResult(
+		"2", "/reports/q1.PDF", "quarterly q1.PDF", "", "", time.Now(), "https://dropbox.com/q1", 2048, "",
+		cloudsearch.AccountData{ID: "2", AccountType: cloudsearch.Dropbox}, "", true, nil, false,
+	)
+	file.Details["owner"] = "owner@bar.com"
+	assertSave(file, s, t)
+	file.SetId()
+
+	for q, expected := range map[string][]string{
+		"quarterly from:foo@bar.com":  {email.Id},
+		"from:FOO@bar.com":            {email.Id},
+		"to:qux@bar.com":              {email.Id},
+		"quarterly to:nobody@bar.com": {},
+		"owner:owner@bar.com":         {file.Id},
+		"quarterly ext:pdf":           {file.Id},
+		"ext:.PDF":                    {file.Id},
+		"quarterly size>1KB":          {file.Id},
+		"quarterly size<1KB":          {email.Id},
+		"quarterly size>1KB size<2KB": {},
+		"quarterly is:unread":         {email.Id},
+		"quarterly ext:pdf is:unread": {},
+		"quarterly":                   {email.Id, file.Id},
+	} {
+		res, err := s.Search(cloudsearch.ParseQuery(q, "", test.DefaultRegistry()))
+		if err != nil {
+			t.Fatal(q, ": ", err)
+		}
+		ids := []string{}
+		for _, r := range res {
+			ids = append(ids, r.Id)
+		}
+		sort.Strings(ids)
+		sort.Strings(expected)
+		if !reflect.DeepEqual(ids, expected) {
+			t.Fatal("Should search on ", q, ": ", ids)
+		}
+	}
+}
+
+func TestLanguageAnalysis(t *testing.T) {
+	s := searchable(t)
+	defer s.Close()
+
+	en := assertSave(cloudsearch.Result{ContentType: cloudsearch.Document, OriginalId: "en", Title: "The quarterly reports are in the shared folder"}, s, t)
+	pt := assertSave(cloudsearch.Result{ContentType: cloudsearch.Document, OriginalId: "pt", Title: "Os relatórios de vendas estão na pasta do projeto"}, s, t)
+	de := assertSave(cloudsearch.Result{ContentType: cloudsearch.Document, OriginalId: "de", Title: "Die Berichte über den Umsatz sind in dem Ordner"}, s, t)
+	unknown := assertSave(cloudsearch.Result{ContentType: cloudsearch.Document, OriginalId: "unknown", Title: "Café menu"}, s, t)
+
+	for text, expected := range map[string]string{
+		"report":    en.Id,      // stemmed
+		"relatorio": pt.Id,      // stemmed and folded
+		"bericht":   de.Id,      // stemmed
+		"cafe":      unknown.Id, // folded
+	} {
+		res, err := s.Search(cloudsearch.Query{Text: text})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 1 || res[0].Id != expected {
+			t.Fatal("Should find ", text, ": ", res)
+		}
+	}
+
+	res, err := s.Search(cloudsearch.Query{Text: "reports"})
+	if err != nil || len(res) != 1 || res[0].Snippet == nil || len(res[0].Snippet.Matches) != 1 {
+		t.Fatal("Should highlight stemmed matches ", err, res)
+	}
+}
@@ -0,0 +1,368 @@
+package bleve
+
+import (
+	"sync"
+	"time"
+
+	bl "github.com/blevesearch/bleve"
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// how many merged results are written at once, and how long they can wait to be written
+var (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = time.Second
+)
+
+// a results storage that queues merged results and indexes them in batches, so live results can be
+// streamed w/o waiting on the index. Everything else waits for the queue to be written first.
+type WriteBehindStorage struct {
+	*BleveResultStorage
+
+	batchSize int
+	interval  time.Duration
+
+	lock      sync.Mutex
+	pending   map[string]cloudsearch.Result // queued, most recent merge wins
+	flushing  map[string]cloudsearch.Result // being written
+	favorites map[string]bool
+
+	flushLock sync.Mutex // writes happen in order
+	full      chan bool
+	done      chan bool
+	stopped   sync.WaitGroup
+	closing   sync.Once
+}
+
+func NewWriteBehindStorage(storage *BleveResultStorage, batchSize int, interval time.Duration) (*WriteBehindStorage, error) {
+	s := &WriteBehindStorage{
+		BleveResultStorage: storage,
+		batchSize:          batchSize,
+		interval:           interval,
+		pending:            map[string]cloudsearch.Result{},
+		flushing:           map[string]cloudsearch.Result{},
+		favorites:          map[string]bool{},
+		full:               make(chan bool, 1),
+		done:               make(chan bool),
+	}
+
+	favs, err := s.BleveResultStorage.AllFavoritedIds()
+	if err != nil {
+		return nil, errors.Wrap(err, "loading favorites")
+	}
+	for _, id := range favs {
+		s.favorites[id] = true
+	}
+
+	s.stopped.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+func (s *WriteBehindStorage) run() {
+	defer s.stopped.Done()
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		case <-s.full:
+		}
+
+		if err := s.Flush(); err != nil {
+			logrus.Error("Couldn't write cached results: ", err)
+		}
+	}
+}
+
+// queue a result to be indexed. Favorites are kept, as with a regular merge.
+func (s *WriteBehindStorage) Merge(r cloudsearch.Result) (cloudsearch.Result, error) {
+	r, err := prepare(r)
+	if err != nil {
+		return r, err
+	}
+
+	s.lock.Lock()
+	r.Favorited = s.favorites[r.Id]
+	s.pending[r.Id] = r
+	full := len(s.pending) >= s.batchSize
+	s.lock.Unlock()
+
+	if full {
+		select {
+		case s.full <- true:
+		default: // a flush is already coming
+		}
+	}
+
+	return r, nil
+}
+
+// write everything queued so far
+func (s *WriteBehindStorage) Flush() error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+
+	s.lock.Lock()
+	s.flushing = s.pending
+	s.pending = map[string]cloudsearch.Result{}
+	batch := s.flushing
+	s.lock.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := s.writeBatch(batch)
+
+	s.lock.Lock()
+	if err != nil {
+		// queued again, unless they were merged again since
+		for id, r := range batch {
+			if _, ok := s.pending[id]; !ok {
+				s.pending[id] = r
+			}
+		}
+	}
+	s.flushing = map[string]cloudsearch.Result{}
+	s.lock.Unlock()
+
+	return err
+}
+
+func (s *WriteBehindStorage) writeBatch(batch map[string]cloudsearch.Result) error {
+	existing, err := s.existing(batch)
+	if err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(batch))
+	for id := range batch {
+		ids = append(ids, id)
+	}
+
+	m := cloudsearch.NewStopwatch("write_behind_flush")
+	defer m.Lap()
+	logrus.Debug("Writing cached results: ", len(batch))
+
+	// batches are mapped as they're built, so they're built w/ whatever index they're written to
+	return s.write(ids, func() error {
+		b := s.index.NewBatch()
+		for id, r := range batch {
+			if e, ok := existing[id]; ok {
+				r.Favorited = e.Favorited
+				if r.LastOpened.IsZero() {
+					r.LastOpened = e.LastOpened
+				}
+			}
+			if err := b.Index(id, searchable(r)); err != nil {
+				return errors.Wrap(err, "indexing "+id)
+			}
+		}
+		return s.index.Batch(b)
+	})
+}
+
+// the stored versions of a batch of results, fetched all at once
+func (s *WriteBehindStorage) existing(batch map[string]cloudsearch.Result) (map[string]cloudsearch.Result, error) {
+	ids := make([]string, 0, len(batch))
+	for id := range batch {
+		ids = append(ids, id)
+	}
+
+	req := bl.NewSearchRequestOptions(bl.NewDocIDQuery(ids), len(ids), 0, false)
+	req.Fields = []string{"Favorited", "LastOpened"}
+	found, err := s.index.Search(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading cached results")
+	}
+
+	res := map[string]cloudsearch.Result{}
+	for _, h := range found.Hits {
+		r := cloudsearch.Result{}
+		r.Favorited, _ = h.Fields["Favorited"].(bool)
+		if opened, ok := h.Fields["LastOpened"].(string); ok {
+			r.LastOpened, _ = time.Parse(time.RFC3339, opened)
+		}
+		res[h.ID] = r
+	}
+	return res, nil
+}
+
+// queued results are visible before they're written
+func (s *WriteBehindStorage) Get(resultId string) (*cloudsearch.Result, error) {
+	s.lock.Lock()
+	r, ok := s.pending[resultId]
+	if !ok {
+		r, ok = s.flushing[resultId]
+	}
+	s.lock.Unlock()
+	if ok {
+		return &r, nil
+	}
+
+	return s.BleveResultStorage.Get(resultId)
+}
+
+// write everything still queued and stop
+func (s *WriteBehindStorage) Close() {
+	s.closing.Do(func() {
+		close(s.done)
+		s.stopped.Wait()
+		if err := s.Flush(); err != nil {
+			logrus.Error("Couldn't write cached results: ", err)
+		}
+		s.BleveResultStorage.Close()
+	})
+}
+
+// drop everything, queued results included
+func (s *WriteBehindStorage) Truncate() error {
+	s.flushLock.Lock() // nothing gets written while truncating
+	defer s.flushLock.Unlock()
+
+	s.lock.Lock()
+	s.pending = map[string]cloudsearch.Result{}
+	s.favorites = map[string]bool{}
+	s.lock.Unlock()
+
+	return s.BleveResultStorage.Truncate()
+}
+
+func (s *WriteBehindStorage) Save(result cloudsearch.Result) (cloudsearch.Result, error) {
+	if err := s.Flush(); err != nil {
+		return result, err
+	}
+	r, err := s.BleveResultStorage.Save(result)
+	if err == nil {
+		s.setFavorite(r.Id, r.Favorited)
+	}
+	return r, err
+}
+
+func (s *WriteBehindStorage) Search(query cloudsearch.Query) ([]cloudsearch.Result, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.BleveResultStorage.Search(query)
+}
+
+func (s *WriteBehindStorage) Matching(query cloudsearch.Query) (<-chan cloudsearch.Result, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.BleveResultStorage.Matching(query)
+}
+
+func (s *WriteBehindStorage) All() (<-chan cloudsearch.Result, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.BleveResultStorage.All()
+}
+
+func (s *WriteBehindStorage) FindOlderThan(maxTime time.Time) (<-chan cloudsearch.Result, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.BleveResultStorage.FindOlderThan(maxTime)
+}
+
+func (s *WriteBehindStorage) FindCachedBefore(maxTime time.Time) (<-chan cloudsearch.Result, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.BleveResultStorage.FindCachedBefore(maxTime)
+}
+
+func (s *WriteBehindStorage) DeleteAllFromAccount(accountId string) ([]string, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	ids, err := s.BleveResultStorage.DeleteAllFromAccount(accountId)
+	for _, id := range ids {
+		s.setFavorite(id, false)
+	}
+	return ids, err
+}
+
+func (s *WriteBehindStorage) Delete(resultId string) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	err := s.BleveResultStorage.Delete(resultId)
+	if err == nil {
+		s.setFavorite(resultId, false)
+	}
+	return err
+}
+
+func (s *WriteBehindStorage) AllFavorited() ([]cloudsearch.Result, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.BleveResultStorage.AllFavorited()
+}
+
+func (s *WriteBehindStorage) AllFavoritedIds() ([]string, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+	return s.BleveResultStorage.AllFavoritedIds()
+}
+
+func (s *WriteBehindStorage) IsFavorite(resultId string) (bool, error) {
+	if err := s.Flush(); err != nil {
+		return false, err
+	}
+	return s.BleveResultStorage.IsFavorite(resultId)
+}
+
+func (s *WriteBehindStorage) MarkOpened(resultId string, at time.Time) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.BleveResultStorage.MarkOpened(resultId, at)
+}
+
+func (s *WriteBehindStorage) ToggleFavorite(resultId string) (bool, error) {
+	if err := s.Flush(); err != nil {
+		return false, err
+	}
+	fav, err := s.BleveResultStorage.ToggleFavorite(resultId)
+	if err == nil {
+		s.setFavorite(resultId, fav)
+	}
+	return fav, err
+}
+
+func (s *WriteBehindStorage) Size() (int64, error) {
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+	return s.BleveResultStorage.Size()
+}
+
+func (s *WriteBehindStorage) Compact() error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+	return s.BleveResultStorage.Compact()
+}
+
+func (s *WriteBehindStorage) setFavorite(resultId string, favorited bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if favorited {
+		s.favorites[resultId] = true
+	} else {
+		delete(s.favorites, resultId)
+	}
+}
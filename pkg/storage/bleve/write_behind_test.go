@@ -0,0 +1,200 @@
+package bleve_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/storage/bleve"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+func writeBehind(t testing.TB, batchSize int, interval time.Duration) *bleve.WriteBehindStorage {
+	s, err := bleve.NewWriteBehindStorage(searchable(t), batchSize, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestWriteBehind(t *testing.T) {
+	s := writeBehind(t, 1000, time.Hour)
+	defer s.Close()
+
+	fav := assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "fav", Title: "foo"}, s, t)
+	if _, err := s.ToggleFavorite(fav.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	merged := []cloudsearch.Result{}
+	for _, id := range []string{"fav", "1", "2"} {
+		r, err := s.Merge(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: id, Title: "foo " + id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		merged = append(merged, r)
+	}
+	if !merged[0].Favorited {
+		t.Fatal("Should keep favorites on merged results")
+	}
+
+	if r, err := s.Get(merged[1].Id); err != nil || r == nil {
+		t.Fatal("Should find queued results ", err, r)
+	}
+
+	res, err := s.Search(cloudsearch.Query{Text: "foo"})
+	if err != nil || len(res) != 3 {
+		t.Fatal("Should write queued results before searching ", err, res)
+	}
+
+	if r, err := s.BleveResultStorage.Get(merged[0].Id); err != nil || r == nil || !r.Favorited || r.Title != "foo fav" {
+		t.Fatal("Should merge w/ stored favorites ", err, r)
+	}
+}
+
+func TestWriteBehindFlushesInBackground(t *testing.T) {
+	s := writeBehind(t, 2, time.Hour)
+	defer s.Close()
+
+	r1, _ := s.Merge(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1"})
+	r2, _ := s.Merge(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "2"})
+
+	// a full batch gets written right away
+	for i := 0; i < 100; i++ {
+		a, _ := s.BleveResultStorage.Get(r1.Id)
+		b, _ := s.BleveResultStorage.Get(r2.Id)
+		if a != nil && b != nil {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("Should write full batches")
+}
+
+func TestWriteBehindDrainsOnClose(t *testing.T) {
+	dir := t.TempDir()
+	c := newCipher(t)
+	results, err := bleve.OpenResultStorage(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := bleve.NewWriteBehindStorage(results, 1000, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := s.Merge(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1"})
+	s.Close()
+
+	reopened, err := bleve.OpenResultStorage(dir, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	if found, err := reopened.Get(r.Id); err != nil || found == nil {
+		t.Fatal("Should write queued results when closing ", err, found)
+	}
+}
+
+func TestWriteBehindKeepsResultsThatFailedToBeWritten(t *testing.T) {
+	s := writeBehind(t, 1000, time.Hour)
+	r, _ := s.Merge(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1", Title: "foo"})
+
+	// the index is gone, so nothing can be written
+	s.BleveResultStorage.Close()
+	if err := s.Flush(); err == nil {
+		t.Fatal("Should fail to write to a closed index")
+	}
+	if found, err := s.Get(r.Id); err != nil || found == nil || found.Title != "foo" {
+		t.Fatal("Should keep results that couldn't be written queued ", err, found)
+	}
+}
+
+func TestWriteBehindTruncatesQueuedResults(t *testing.T) {
+	s := writeBehind(t, 1000, time.Hour)
+	defer s.Close()
+
+	stored := assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1", Title: "foo"}, s, t)
+	queued, _ := s.Merge(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "2", Title: "foo"})
+
+	if err := s.Truncate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{stored.Id, queued.Id} {
+		if r, err := s.Get(id); err != nil || r != nil {
+			t.Fatal("Should drop stored and queued results ", err, r)
+		}
+	}
+}
+
+// how long it takes to stream live results through a cached searchable, writing them to the cache
+func benchmarkStreaming(b *testing.B, results cloudsearch.ResultsStorage) {
+	remote := func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+		res := make(chan cloudsearch.Result)
+		go func() {
+			defer close(res)
+			for i := 0; i < 100; i++ {
+				res <- cloudsearch.Result{
+					ContentType: cloudsearch.File,
+					OriginalId:  strconv.Itoa(i),
+					Title:       "result " + strconv.Itoa(i),
+					Body:        "some content to index on result " + strconv.Itoa(i),
+					Timestamp:   time.Now(),
+				}
+			}
+		}()
+		return res
+	}
+
+	search := cloudsearch.NewCachedSearchable("bench", results, cloudsearch.NoopSearchable(), remote, cloudsearch.AccountData{}, cloudsearch.CachePolicy{})
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range search(cloudsearch.Query{SearchMode: cloudsearch.Live}, context.Background()) {
+		}
+	}
+}
+
+func BenchmarkStreaming(b *testing.B) {
+	b.Run("sync", func(b *testing.B) {
+		s := searchable(b)
+		defer s.Close()
+		benchmarkStreaming(b, s)
+	})
+
+	b.Run("writeBehind", func(b *testing.B) {
+		s := writeBehind(b, bleve.DefaultBatchSize, bleve.DefaultFlushInterval)
+		defer s.Close()
+		benchmarkStreaming(b, s)
+	})
+}
+
+func TestOpenedKeepsCacheTime(t *testing.T) {
+	s := writeBehind(t, 1000, time.Hour)
+	defer s.Close()
+
+	e := cloudsearch.NewMultiSearch(cloudsearch.Env{}, test.NewAccountsStorage(), s, test.DefaultRegistry(), func(q cloudsearch.Query) []cloudsearch.ResultFilter {
+		return []cloudsearch.ResultFilter{}
+	})
+
+	r := assertSave(cloudsearch.Result{ContentType: cloudsearch.File, OriginalId: "1", Title: "foo"}, s, t)
+	time.Sleep(1100 * time.Millisecond) // cache times are kept to the second
+
+	if err := e.Opened(*r); err != nil {
+		t.Fatal(err)
+	}
+
+	opened, err := s.Get(r.Id)
+	if err != nil || opened == nil {
+		t.Fatal("Should find the result ", err)
+	}
+	if opened.LastOpened.IsZero() || !opened.CachedAt.Equal(r.CachedAt) {
+		t.Fatal("Should only change when the result was opened ", opened.LastOpened, opened.CachedAt, r.CachedAt)
+	}
+}
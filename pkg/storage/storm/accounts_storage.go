@@ -2,36 +2,196 @@ package storm
 
 import (
 	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/secrets"
 	"errors"
 	"fmt"
 	"github.com/asdine/storm"
+	"github.com/sirupsen/logrus"
+	"sync"
 )
 
+const (
+	secretsBucket = "secrets"
+	envelopeKey   = "envelope"
+)
+
+// where the key protecting tokens comes from, given where it came from before (empty the first time)
+type KeySourceFunc func(previous string) (secrets.KeySource, error)
+
+// accounts w/ their tokens encrypted
 type AccountsStorage struct {
-	s *storm.DB
+	s    *storm.DB
+	keys KeySourceFunc
+
+	lock    sync.Mutex
+	dataKey []byte // only unsealed once tokens are needed
+	cipher  *secrets.Cipher
 }
 
-func NewAccountsStorage(storagePath string) (cloudsearch.AccountsStorage, error) {
+func NewAccountsStorage(storagePath string, keys KeySourceFunc) (*AccountsStorage, error) {
 	db, err := storm.Open(cloudsearch.FileAt(storagePath, "accounts.db"))
 	if err != nil {
 		return nil, err
 	}
 
-	return &AccountsStorage{
-		s: db,
-	}, nil
+	s := &AccountsStorage{
+		s:    db,
+		keys: keys,
+	}
+
+	if err := s.encryptPlaintext(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// accounts saved before tokens were encrypted get encrypted
+func (s *AccountsStorage) encryptPlaintext() error {
+	accts := make([]cloudsearch.AccountData, 0)
+	if err := s.s.All(&accts); err != nil {
+		return err
+	}
+
+	for _, a := range accts {
+		if isPlaintext(a.Token) || isPlaintext(a.RefreshToken) {
+			logrus.Info("Encrypting tokens for account ", a.ID)
+			if err := s.Save(&a); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func isPlaintext(s string) bool {
+	return s != "" && !secrets.IsEncrypted(s)
+}
+
+// the cipher for tokens, unsealing (or creating) the data key the first time
+func (s *AccountsStorage) unlock() (*secrets.Cipher, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.cipher != nil {
+		return s.cipher, nil
+	}
+
+	var dataKey []byte
+	env, err := s.envelope()
+	if err != nil {
+		return nil, err
+	}
+
+	if env == nil {
+		keys, err := s.keys("")
+		if err != nil {
+			return nil, err
+		}
+		if env, dataKey, err = secrets.NewEnvelope(keys); err != nil {
+			return nil, err
+		}
+		if err := s.s.Set(secretsBucket, envelopeKey, env); err != nil {
+			return nil, err
+		}
+	} else {
+		keys, err := s.keys(env.Source)
+		if err != nil {
+			return nil, err
+		}
+		if dataKey, err = env.Open(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := secrets.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	s.dataKey = dataKey
+	s.cipher = c
+	return c, nil
+}
+
+// the cipher for anything else kept on disk (eg the search index), w/ the same data key as tokens
+func (s *AccountsStorage) Cipher() (*secrets.Cipher, error) {
+	return s.unlock()
+}
+
+func (s *AccountsStorage) envelope() (*secrets.Envelope, error) {
+	env := &secrets.Envelope{}
+	err := s.s.Get(secretsBucket, envelopeKey, env)
+	if err == storm.ErrNotFound {
+		return nil, nil
+	}
+	return env, err
+}
+
+// seal the data key w/ a key from another source (or a new key from the same one)
+func (s *AccountsStorage) Rekey(keys secrets.KeySource) error {
+	if _, err := s.unlock(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	previous, err := s.envelope()
+	if err != nil {
+		return err
+	}
+	env, err := secrets.Seal(s.dataKey, keys)
+	if err != nil {
+		return err
+	}
+	if err := s.s.Set(secretsBucket, envelopeKey, env); err != nil {
+		return err
+	}
+
+	if err := previous.Forget(); err != nil {
+		logrus.Error("Couldn't remove the previous key: ", err)
+	}
+	return nil
 }
 
 func (s *AccountsStorage) All() ([]cloudsearch.AccountData, error) {
 	res := make([]cloudsearch.AccountData, 0)
 	err := s.s.All(&res)
-	return res, err
+	if err != nil {
+		return res, err
+	}
+	return res, s.decrypt(res)
 }
 
 func (s *AccountsStorage) Active() ([]cloudsearch.AccountData, error) {
 	res := make([]cloudsearch.AccountData, 0)
 	err := s.s.Find("Active", true, &res)
-	return res, err
+	if err != nil {
+		return res, err
+	}
+	return res, s.decrypt(res)
+}
+
+func (s *AccountsStorage) decrypt(accts []cloudsearch.AccountData) error {
+	for i := range accts {
+		a := &accts[i]
+		if !secrets.IsEncrypted(a.Token) && !secrets.IsEncrypted(a.RefreshToken) {
+			continue
+		}
+
+		c, err := s.unlock()
+		if err != nil {
+			return err
+		}
+		if a.Token, err = c.Decrypt(a.Token); err != nil {
+			return err
+		}
+		if a.RefreshToken, err = c.Decrypt(a.RefreshToken); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *AccountsStorage) Delete(id string) error {
@@ -52,7 +212,22 @@ func (s *AccountsStorage) Save(data *cloudsearch.AccountData) error {
 		return errors.New("Invalid id: must be an md5")
 	}
 
-	return s.s.Save(data)
+	// the caller keeps the plaintext tokens
+	encrypted := *data
+	if isPlaintext(data.Token) || isPlaintext(data.RefreshToken) {
+		c, err := s.unlock()
+		if err != nil {
+			return err
+		}
+		if encrypted.Token, err = c.Encrypt(data.Token); err != nil {
+			return err
+		}
+		if encrypted.RefreshToken, err = c.Encrypt(data.RefreshToken); err != nil {
+			return err
+		}
+	}
+
+	return s.s.Save(&encrypted)
 }
 
 func (s *AccountsStorage) Close() {
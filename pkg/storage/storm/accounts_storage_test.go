@@ -1,31 +1,56 @@
 package storm_test
 
 import (
-	"github.com/herval/cloudsearch/pkg/storage/storm"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
 	"testing"
 
+	st "github.com/asdine/storm"
 	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/secrets"
+	"github.com/herval/cloudsearch/pkg/storage/storm"
 )
 
-func TestStorage(t *testing.T) {
-	env := cloudsearch.Env{
-		StoragePath: "./../../../tmp",
-	}
-	storage, err := storm.NewAccountsStorage(env.StoragePath)
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "cloudsearch")
 	if err != nil {
 		t.Fatal(err)
 	}
+	return dir
+}
+
+func envKey(t *testing.T) storm.KeySourceFunc {
+	key, _ := secrets.RandomKey()
+	os.Setenv(secrets.KeyVar, base64.StdEncoding.EncodeToString(key))
+	t.Cleanup(func() {
+		os.Unsetenv(secrets.KeyVar)
+	})
+	return secrets.DefaultKeySource
+}
 
-	// cleanup
-	accs, err := storage.All()
+// the accounts as they're written on disk
+func stored(t *testing.T, dir string) []cloudsearch.AccountData {
+	db, err := st.Open(cloudsearch.FileAt(dir, "accounts.db"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	for _, a := range accs {
-		err = storage.Delete(a.ID)
-		if err != nil {
-			t.Fatal(err)
-		}
+	defer db.Close()
+
+	res := []cloudsearch.AccountData{}
+	if err := db.All(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestStorage(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	storage, err := storm.NewAccountsStorage(dir, envKey(t))
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	// save a bunch of new accounts
@@ -36,10 +61,11 @@ func TestStorage(t *testing.T) {
 		AccountType: cloudsearch.Dropbox,
 	}
 	googl := cloudsearch.AccountData{
-		Name:        "456",
-		ExternalId:  "456",
-		Token:       "googletoken",
-		AccountType: cloudsearch.Google,
+		Name:         "456",
+		ExternalId:   "456",
+		Token:        "googletoken",
+		RefreshToken: "googlerefresh",
+		AccountType:  cloudsearch.Google,
 	}
 	googl2 := cloudsearch.AccountData{
 		Name:        "678",
@@ -57,6 +83,9 @@ func TestStorage(t *testing.T) {
 	if err := storage.Save(&googl2); err != nil {
 		t.Fatal(err)
 	}
+	if googl.Token != "googletoken" {
+		t.Fatal("Should keep the saved account as it was ", googl)
+	}
 
 	accts, err := storage.All()
 	if err != nil {
@@ -66,6 +95,87 @@ func TestStorage(t *testing.T) {
 	if len(accts) != 3 {
 		t.Fatal("Expected accounts not found:", accts)
 	}
+	for _, a := range accts {
+		if a.ID == googl.ID && (a.Token != "googletoken" || a.RefreshToken != "googlerefresh") {
+			t.Fatal("Should decrypt tokens ", a)
+		}
+	}
+	storage.Close()
+
+	for _, a := range stored(t, dir) {
+		if !secrets.IsEncrypted(a.Token) || (a.RefreshToken != "" && !secrets.IsEncrypted(a.RefreshToken)) {
+			t.Fatal("Should encrypt tokens on disk ", a)
+		}
+	}
+}
+
+func TestEncryptsExistingAccounts(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// from before tokens were encrypted
+	db, err := st.Open(cloudsearch.FileAt(dir, "accounts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := cloudsearch.AccountData{ID: cloudsearch.Md5("1"), Name: "1", ExternalId: "1", Token: "token", Active: true}
+	if err := db.Save(&plain); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	storage, err := storm.NewAccountsStorage(dir, envKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	accts, err := storage.Active()
+	if err != nil || len(accts) != 1 || accts[0].Token != "token" {
+		t.Fatal("Should read existing accounts ", err, accts)
+	}
+	storage.Close()
 
-	//fmt.Println(accts)
+	if a := stored(t, dir); len(a) != 1 || !secrets.IsEncrypted(a[0].Token) {
+		t.Fatal("Should encrypt existing tokens ", a)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	defer os.Unsetenv(secrets.PassphraseVar)
+
+	storage, err := storm.NewAccountsStorage(dir, envKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Save(&cloudsearch.AccountData{Name: "1", ExternalId: "1", Token: "token"}); err != nil {
+		t.Fatal(err)
+	}
+
+	os.Setenv(secrets.PassphraseVar, "correct horse")
+	if err := storage.Rekey(secrets.Passphrase{}); err != nil {
+		t.Fatal("Should rekey ", err)
+	}
+	storage.Close()
+
+	// the env key isn't needed anymore
+	os.Unsetenv(secrets.KeyVar)
+	storage, err = storm.NewAccountsStorage(dir, secrets.DefaultKeySource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accts, err := storage.All(); err != nil || len(accts) != 1 || accts[0].Token != "token" {
+		t.Fatal("Should decrypt w/ the new key ", err, accts)
+	}
+	storage.Close()
+
+	os.Setenv(secrets.PassphraseVar, "wrong")
+	storage, err = storm.NewAccountsStorage(dir, secrets.DefaultKeySource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	if _, err := storage.All(); err == nil {
+		t.Fatal("Should not decrypt w/ the wrong passphrase")
+	}
 }
@@ -0,0 +1,81 @@
+package test
+
+import (
+    "sync"
+
+    "github.com/herval/cloudsearch/pkg"
+    "github.com/herval/cloudsearch/pkg/secrets"
+)
+
+// an in-memory accounts storage, for tests that don't need the real thing
+type AccountsStorage struct {
+    lock     sync.Mutex
+    accounts map[string]cloudsearch.AccountData
+}
+
+func NewAccountsStorage(accounts ...cloudsearch.AccountData) *AccountsStorage {
+    s := &AccountsStorage{
+        accounts: map[string]cloudsearch.AccountData{},
+    }
+    for _, a := range accounts {
+        s.accounts[a.ID] = a
+    }
+    return s
+}
+
+func (s *AccountsStorage) Close() {
+}
+
+func (s *AccountsStorage) All() ([]cloudsearch.AccountData, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    res := []cloudsearch.AccountData{}
+    for _, a := range s.accounts {
+        res = append(res, a)
+    }
+    return res, nil
+}
+
+func (s *AccountsStorage) Active() ([]cloudsearch.AccountData, error) {
+    all, err := s.All()
+    if err != nil {
+        return nil, err
+    }
+
+    res := []cloudsearch.AccountData{}
+    for _, a := range all {
+        if a.Active {
+            res = append(res, a)
+        }
+    }
+    return res, nil
+}
+
+func (s *AccountsStorage) Get(id string) cloudsearch.AccountData {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    return s.accounts[id]
+}
+
+func (s *AccountsStorage) Save(a *cloudsearch.AccountData) error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    s.accounts[a.ID] = *a
+    return nil
+}
+
+func (s *AccountsStorage) Delete(id string) error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    delete(s.accounts, id)
+    return nil
+}
+
+// tokens aren't encrypted in memory
+func (s *AccountsStorage) Rekey(keys secrets.KeySource) error {
+    return nil
+}
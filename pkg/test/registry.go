@@ -13,6 +13,7 @@ func DefaultRegistry() *cloudsearch.Registry {
         cloudsearch.Image,
         cloudsearch.Video,
     )
+    c.RegisterDefaultFilters()
 
     return c
 }
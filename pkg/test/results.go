@@ -0,0 +1,176 @@
+package test
+
+import (
+    "sync"
+    "time"
+
+    "github.com/herval/cloudsearch/pkg"
+)
+
+// an in-memory results storage, for tests that don't need a real index
+type ResultsStorage struct {
+    lock    sync.Mutex
+    results map[string]cloudsearch.Result
+
+    ResultSize  int64 // how much each result counts towards the size
+    Compactions int
+}
+
+func NewResultsStorage(results ...cloudsearch.Result) *ResultsStorage {
+    s := &ResultsStorage{
+        results: map[string]cloudsearch.Result{},
+    }
+    for _, r := range results {
+        s.results[r.Id] = r
+    }
+    return s
+}
+
+func (s *ResultsStorage) Close() {
+}
+
+func (s *ResultsStorage) Save(result cloudsearch.Result) (cloudsearch.Result, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    result.CachedAt = time.Now()
+    s.results[result.Id] = result
+    return result, nil
+}
+
+func (s *ResultsStorage) Merge(result cloudsearch.Result) (cloudsearch.Result, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    if existing, ok := s.results[result.Id]; ok {
+        result.Favorited = existing.Favorited
+        if result.LastOpened.IsZero() {
+            result.LastOpened = existing.LastOpened
+        }
+    }
+    result.CachedAt = time.Now()
+    s.results[result.Id] = result
+    return result, nil
+}
+
+// no text matching here - every result matches
+func (s *ResultsStorage) Search(query cloudsearch.Query) ([]cloudsearch.Result, error) {
+    return s.matching(func(r cloudsearch.Result) bool { return true }), nil
+}
+
+func (s *ResultsStorage) Matching(query cloudsearch.Query) (<-chan cloudsearch.Result, error) {
+    res, err := s.Search(query)
+    return s.stream(res), err
+}
+
+func (s *ResultsStorage) Get(resultId string) (*cloudsearch.Result, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    if r, ok := s.results[resultId]; ok {
+        return &r, nil
+    }
+    return nil, nil
+}
+
+func (s *ResultsStorage) All() (<-chan cloudsearch.Result, error) {
+    return s.stream(s.matching(func(r cloudsearch.Result) bool { return true })), nil
+}
+
+func (s *ResultsStorage) FindOlderThan(maxTime time.Time) (<-chan cloudsearch.Result, error) {
+    return s.stream(s.matching(func(r cloudsearch.Result) bool { return r.Timestamp.Before(maxTime) })), nil
+}
+
+func (s *ResultsStorage) FindCachedBefore(maxTime time.Time) (<-chan cloudsearch.Result, error) {
+    return s.stream(s.matching(func(r cloudsearch.Result) bool { return r.CachedAt.Before(maxTime) })), nil
+}
+
+func (s *ResultsStorage) DeleteAllFromAccount(accountId string) ([]string, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    ids := []string{}
+    for id, r := range s.results {
+        if r.AccountId == accountId {
+            ids = append(ids, id)
+            delete(s.results, id)
+        }
+    }
+    return ids, nil
+}
+
+func (s *ResultsStorage) Delete(resultId string) error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    delete(s.results, resultId)
+    return nil
+}
+
+func (s *ResultsStorage) AllFavorited() ([]cloudsearch.Result, error) {
+    return s.matching(func(r cloudsearch.Result) bool { return r.Favorited }), nil
+}
+
+func (s *ResultsStorage) AllFavoritedIds() ([]string, error) {
+    ids := []string{}
+    for _, r := range s.matching(func(r cloudsearch.Result) bool { return r.Favorited }) {
+        ids = append(ids, r.Id)
+    }
+    return ids, nil
+}
+
+func (s *ResultsStorage) Size() (int64, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    return int64(len(s.results)) * s.ResultSize, nil
+}
+
+func (s *ResultsStorage) Compact() error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    s.Compactions += 1
+    return nil
+}
+
+func (s *ResultsStorage) IsFavorite(resultId string) (bool, error) {
+    r, err := s.Get(resultId)
+    return r != nil && r.Favorited, err
+}
+
+func (s *ResultsStorage) MarkOpened(resultId string, at time.Time) error {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    if r, ok := s.results[resultId]; ok {
+        r.LastOpened = at
+        s.results[resultId] = r
+    }
+    return nil
+}
+
+func (s *ResultsStorage) ToggleFavorite(resultId string) (bool, error) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    r, ok := s.results[resultId]
+    if !ok {
+        return false, nil
+    }
+    r.Favorited = !r.Favorited
+    s.results[resultId] = r
+    return r.Favorited, nil
+}
+
+func (s *ResultsStorage) matching(f func(r cloudsearch.Result) bool) []cloudsearch.Result {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+    res := []cloudsearch.Result{}
+    for _, r := range s.results {
+        if f(r) {
+            res = append(res, r)
+        }
+    }
+    return res
+}
+
+func (s *ResultsStorage) stream(results []cloudsearch.Result) <-chan cloudsearch.Result {
+    res := make(chan cloudsearch.Result, len(results))
+    for _, r := range results {
+        res <- r
+    }
+    close(res)
+    return res
+}
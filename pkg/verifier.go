@@ -0,0 +1,200 @@
+package cloudsearch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// checks whether a cached result still exists on its source. Results that are gone come back w/ the
+// ResultNotFound status.
+type Verifier func(ctx context.Context, r Result) (Result, error)
+
+type VerifierBuilder func(account AccountData) (Verifier, error)
+
+func NotFound(r Result) Result {
+	r.Status = ResultNotFound
+	return r
+}
+
+// how long cached results are trusted before being checked against their source
+const DefaultCacheTTL = 7 * 24 * time.Hour
+
+type CacheTTL struct {
+	Default time.Duration
+	ByType  map[ContentType]time.Duration
+}
+
+func (t CacheTTL) For(contentType ContentType) time.Duration {
+	if d, ok := t.ByType[contentType]; ok {
+		return d
+	}
+	if t.Default > 0 {
+		return t.Default
+	}
+	return DefaultCacheTTL
+}
+
+func (t CacheTTL) IsStale(r Result, now time.Time) bool {
+	return !r.CachedAt.IsZero() && now.Sub(r.CachedAt) > t.For(r.ContentType)
+}
+
+// no result can go stale before this
+func (t CacheTTL) Shortest() time.Duration {
+	res := t.For("")
+	for _, d := range t.ByType {
+		if d < res {
+			res = d
+		}
+	}
+	return res
+}
+
+// how a cached searchable handles what it caches
+type CachePolicy struct {
+	Rules  ExclusionRules
+	TTL    CacheTTL
+	Verify Verifier // checks stale results against their source, when the service supports it
+}
+
+// save results that still exist (refreshing their cache time) and remove the ones that don't
+func ApplyVerified(results ResultsStorage, r Result) error {
+	switch r.Status {
+	case ResultNotFound:
+		logrus.Debug("Removing deleted content: ", r.Id)
+		return results.Delete(r.Id)
+	case ResultFound:
+		_, err := results.Merge(r)
+		return err
+	}
+	return nil
+}
+
+// how many results are checked at the same time
+var VerifyConcurrency = 4
+
+type VerifyStats struct {
+	Checked int `json:"checked"`
+	Removed int `json:"removed"`
+	Failed  int `json:"failed"`
+}
+
+// check every stale cached result against its source, removing the ones that don't exist anymore
+func VerifyStale(ctx context.Context, results ResultsStorage, accounts AccountsStorage, registry *Registry, ttl CacheTTL) (VerifyStats, error) {
+	stats := VerifyStats{}
+	now := time.Now()
+
+	accts, err := accounts.All()
+	if err != nil {
+		return stats, err
+	}
+	verifiers := map[string]Verifier{}
+	for _, a := range accts {
+		v, err := registry.Verifier(a)
+		if err != nil {
+			logrus.Error("Can't verify results for ", a.Description, ": ", err)
+			continue
+		}
+		if v != nil {
+			verifiers[a.ID] = v
+		}
+	}
+
+	found, err := results.FindCachedBefore(now.Add(-ttl.Shortest()))
+	if err != nil {
+		return stats, errors.Wrap(err, "listing cached results")
+	}
+
+	// verifying refreshes the cache time, so don't do it while iterating
+	stale := []Result{}
+	for r := range found {
+		if ttl.IsStale(r, now) && verifiers[r.AccountId] != nil {
+			stale = append(stale, r)
+		}
+	}
+
+	lock := sync.Mutex{}
+	sem := make(chan bool, VerifyConcurrency)
+	var wg sync.WaitGroup
+	for _, r := range stale {
+		if ctx.Err() != nil {
+			break
+		}
+
+		sem <- true
+		wg.Add(1)
+		go func(r Result) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			v, err := verifiers[r.AccountId](ctx, r)
+			if err == nil {
+				err = ApplyVerified(results, v)
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			stats.Checked += 1
+			if err != nil {
+				logrus.Error("Couldn't verify ", r.Id, ": ", err)
+				stats.Failed += 1
+			} else if v.Status == ResultNotFound {
+				stats.Removed += 1
+			}
+		}(r)
+	}
+	wg.Wait()
+
+	return stats, ctx.Err()
+}
+
+// results checked in the background while searching, so the same result isn't checked twice at once
+var verifying = struct {
+	sync.Mutex
+	ids map[string]bool
+	sem chan bool
+}{
+	ids: map[string]bool{},
+	sem: make(chan bool, VerifyConcurrency),
+}
+
+// check a stale result in the background, unless there's too much being checked already
+func verifyInBackground(results ResultsStorage, verify Verifier, r Result) {
+	verifying.Lock()
+	defer verifying.Unlock()
+	if verifying.ids[r.Id] {
+		return
+	}
+
+	select {
+	case verifying.sem <- true:
+	default:
+		return // it'll get checked on a later search
+	}
+	verifying.ids[r.Id] = true
+
+	go func() {
+		defer func() {
+			verifying.Lock()
+			delete(verifying.ids, r.Id)
+			verifying.Unlock()
+			<-verifying.sem
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+
+		v, err := verify(ctx, r)
+		if err == nil {
+			err = ApplyVerified(results, v)
+		}
+		if err != nil {
+			logrus.Error("Couldn't verify ", r.Id, ": ", err)
+		}
+	}()
+}
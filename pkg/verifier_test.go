@@ -0,0 +1,130 @@
+package cloudsearch_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/herval/cloudsearch/pkg"
+	"github.com/herval/cloudsearch/pkg/test"
+)
+
+// results whose original id is "gone" don't exist anymore
+func fakeVerifier(checked *[]string) cloudsearch.VerifierBuilder {
+	lock := sync.Mutex{}
+	return func(account cloudsearch.AccountData) (cloudsearch.Verifier, error) {
+		return func(ctx context.Context, r cloudsearch.Result) (cloudsearch.Result, error) {
+			lock.Lock()
+			*checked = append(*checked, r.Id)
+			lock.Unlock()
+			if r.OriginalId == "gone" {
+				return cloudsearch.NotFound(r), nil
+			}
+			return r, nil
+		}, nil
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	ttl := cloudsearch.CacheTTL{
+		Default: time.Hour,
+		ByType:  map[cloudsearch.ContentType]time.Duration{cloudsearch.Email: time.Minute},
+	}
+	now := time.Now()
+
+	if ttl.Shortest() != time.Minute {
+		t.Fatal("Should find the shortest ttl: ", ttl.Shortest())
+	}
+	if !ttl.IsStale(cloudsearch.Result{ContentType: cloudsearch.Email, CachedAt: now.Add(-time.Minute * 2)}, now) {
+		t.Fatal("Should use the content type's ttl")
+	}
+	if ttl.IsStale(cloudsearch.Result{ContentType: cloudsearch.File, CachedAt: now.Add(-time.Minute * 2)}, now) {
+		t.Fatal("Should use the default ttl")
+	}
+	if ttl.IsStale(cloudsearch.Result{ContentType: cloudsearch.File}, now) {
+		t.Fatal("Should not consider uncached results stale")
+	}
+	if (cloudsearch.CacheTTL{}).For(cloudsearch.File) != cloudsearch.DefaultCacheTTL {
+		t.Fatal("Should default to DefaultCacheTTL")
+	}
+}
+
+func TestVerifyStale(t *testing.T) {
+	old := time.Now().Add(-time.Hour * 2)
+	results := test.NewResultsStorage(
+		cloudsearch.Result{Id: "stale", OriginalId: "here", AccountId: "1", CachedAt: old},
+		cloudsearch.Result{Id: "deleted", OriginalId: "gone", AccountId: "1", CachedAt: old},
+		cloudsearch.Result{Id: "fresh", OriginalId: "gone", AccountId: "1", CachedAt: time.Now()},
+		cloudsearch.Result{Id: "unverifiable", OriginalId: "gone", AccountId: "2", CachedAt: old},
+	)
+	accounts := test.NewAccountsStorage(
+		cloudsearch.AccountData{ID: "1", AccountType: cloudsearch.Dropbox},
+		cloudsearch.AccountData{ID: "2", AccountType: cloudsearch.Google},
+	)
+
+	checked := []string{}
+	registry := cloudsearch.NewRegistry()
+	registry.RegisterVerifier(cloudsearch.Dropbox, fakeVerifier(&checked))
+
+	stats, err := cloudsearch.VerifyStale(context.Background(), results, accounts, registry, cloudsearch.CacheTTL{Default: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats.Checked != 2 || stats.Removed != 1 || stats.Failed != 0 {
+		t.Fatal("Should only check stale results w/ a verifier: ", stats, checked)
+	}
+	if r, _ := results.Get("deleted"); r != nil {
+		t.Fatal("Should remove deleted results")
+	}
+	if r, _ := results.Get("stale"); r == nil || !r.CachedAt.After(old) {
+		t.Fatal("Should refresh results that still exist")
+	}
+	for _, id := range []string{"fresh", "unverifiable"} {
+		if r, _ := results.Get(id); r == nil {
+			t.Fatal("Should keep results that weren't checked: ", id)
+		}
+	}
+}
+
+func TestStaleResultsAreVerifiedOnSearch(t *testing.T) {
+	account := cloudsearch.AccountData{ID: "1", AccountType: cloudsearch.Dropbox}
+	results := test.NewResultsStorage()
+
+	local := func(query cloudsearch.Query, ctx context.Context) <-chan cloudsearch.Result {
+		res := make(chan cloudsearch.Result, 2)
+		res <- cloudsearch.Result{Id: "deleted", OriginalId: "gone", AccountId: "1", CachedAt: time.Now().Add(-time.Hour * 2)}
+		res <- cloudsearch.Result{Id: "other", OriginalId: "gone", AccountId: "2", CachedAt: time.Now().Add(-time.Hour * 2)}
+		close(res)
+		return res
+	}
+
+	done := make(chan string, 2)
+	policy := cloudsearch.CachePolicy{
+		TTL: cloudsearch.CacheTTL{Default: time.Hour},
+		Verify: func(ctx context.Context, r cloudsearch.Result) (cloudsearch.Result, error) {
+			done <- r.Id
+			return cloudsearch.NotFound(r), nil
+		},
+	}
+
+	s := cloudsearch.NewCachedSearchable("test", results, local, cloudsearch.NoopSearchable(), account, policy)
+	found := 0
+	for range s(cloudsearch.Query{SearchMode: cloudsearch.Cache}, context.Background()) {
+		found += 1
+	}
+
+	if found != 2 {
+		t.Fatal("Should still return stale results: ", found)
+	}
+
+	select {
+	case id := <-done:
+		if id != "deleted" {
+			t.Fatal("Should only verify the account's own results: ", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Should verify stale results in the background")
+	}
+}